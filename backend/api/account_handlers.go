@@ -0,0 +1,224 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"social-network/database/models"
+	"social-network/services"
+)
+
+// DeleteAccountHandler schedules the current user's account for deletion after they
+// re-enter their password. The user is signed out everywhere straight away; the data is
+// erased once the grace period has passed, and logging in before then restores it.
+func (h *UserHandler) DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Password is required to delete your account")
+		return
+	}
+	if !services.CheckPasswordHash(req.Password, actor.PasswordHash) {
+		respondWithError(w, http.StatusForbidden, "Incorrect password")
+		return
+	}
+
+	now := time.Now()
+	if err := models.RequestAccountDeletion(actor.ID, now); err != nil {
+		log.Printf("Error scheduling deletion of account %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete account")
+		return
+	}
+	services.ClearSessionCookie(w, r)
+	go h.hub.DisconnectUser(actor.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message":             "Your account will be deleted. Log in again before then to keep it.",
+		"deletionScheduledAt": now.Add(services.AccountDeletionGracePeriod()),
+	})
+}
+
+// DeactivateAccountHandler hides the current user's profile, posts and follows from
+// everyone else after they re-enter their password. The user is signed out everywhere;
+// logging in again reactivates the account.
+func (h *UserHandler) DeactivateAccountHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Password is required to deactivate your account")
+		return
+	}
+	if !services.CheckPasswordHash(req.Password, actor.PasswordHash) {
+		respondWithError(w, http.StatusForbidden, "Incorrect password")
+		return
+	}
+
+	if err := models.DeactivateAccount(actor.ID, time.Now()); err != nil {
+		log.Printf("Error deactivating account %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to deactivate account")
+		return
+	}
+	services.ClearSessionCookie(w, r)
+	go h.hub.DisconnectUser(actor.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "Your account has been deactivated. Log in again to reactivate it.",
+	})
+}
+
+// isValidEmail reports whether email is a bare address such as "name@example.com".
+func isValidEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
+
+// ChangePasswordHandler replaces the current user's password after they re-enter the
+// current one. Every other session is signed out and its live connections are dropped;
+// the session making the request stays signed in.
+func (h *UserHandler) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.CurrentPassword == "" {
+		respondWithError(w, http.StatusBadRequest, "Your current password is required to change it")
+		return
+	}
+	if !services.CheckPasswordHash(req.CurrentPassword, actor.PasswordHash) {
+		respondWithError(w, http.StatusForbidden, "Incorrect password")
+		return
+	}
+	if err := services.ValidatePassword(req.NewPassword); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hash, err := services.HashPassword(req.NewPassword)
+	if err != nil {
+		log.Printf("Error hashing new password of %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to change password")
+		return
+	}
+	revoked, err := models.ChangePassword(actor.ID, hash, currentSessionToken(r), time.Now())
+	if err != nil {
+		log.Printf("Error changing password of %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to change password")
+		return
+	}
+	go h.hub.DisconnectSessions(actor.ID, revoked)
+	recordAudit(r, &models.AuditEntry{
+		ActorID:       actor.ID,
+		Action:        models.AuditPasswordChanged,
+		SubjectUserID: actor.ID,
+		Details:       map[string]interface{}{"method": "change", "revokedSessions": len(revoked)},
+	})
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message":         "Your password has been changed. Your other sessions were signed out.",
+		"revokedSessions": len(revoked),
+	})
+}
+
+// ChangeEmailHandler starts changing the current user's email address after they
+// re-enter their password. A verification link goes to the new address and the old one
+// is told about the change; the address only changes once the link is opened.
+func (h *UserHandler) ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Your password is required to change your email address")
+		return
+	}
+	if !services.CheckPasswordHash(req.Password, actor.PasswordHash) {
+		respondWithError(w, http.StatusForbidden, "Incorrect password")
+		return
+	}
+	if !isValidEmail(req.Email) {
+		respondWithError(w, http.StatusBadRequest, "Invalid email address")
+		return
+	}
+	if existing, err := models.GetUserByEmail(req.Email); err != nil {
+		log.Printf("Error looking up email for %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to change email address")
+		return
+	} else if existing != nil && existing.ID != actor.ID {
+		respondWithError(w, http.StatusConflict, models.ErrEmailInUse.Error())
+		return
+	}
+
+	err := h.verifier.RequestEmailChange(actor, req.Email)
+	switch {
+	case errors.Is(err, services.ErrEmailUnchanged):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, services.ErrVerificationRateLimited):
+		respondWithError(w, http.StatusTooManyRequests, err.Error())
+		return
+	case err != nil:
+		log.Printf("Error requesting email change for %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to change email address")
+		return
+	}
+	recordAudit(r, &models.AuditEntry{
+		ActorID:       actor.ID,
+		Action:        models.AuditEmailChangeRequested,
+		SubjectUserID: actor.ID,
+		Details:       map[string]interface{}{"to": req.Email},
+	})
+
+	respondWithJSON(w, http.StatusAccepted, map[string]string{
+		"message": "We sent a link to your new address. Your email changes once you open it.",
+	})
+}
+
+// AccountActivityHandler lists recent security-relevant events on the current user's
+// account, such as logins, failed login attempts and privacy changes. Staff who acted on
+// the account are not named and their IP address and user agent are not shown.
+func (h *UserHandler) AccountActivityHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	limit, offset := parsePagination(r, 50, 200)
+	entries, err := models.ListAccountActivity(actor.ID, limit, offset)
+	if err != nil {
+		log.Printf("Error listing account activity of %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to load account activity")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"activity": entries})
+}
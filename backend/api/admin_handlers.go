@@ -0,0 +1,251 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"social-network/database/models"
+	"social-network/services"
+	"social-network/websocket"
+
+	"github.com/gorilla/mux"
+)
+
+// AdminHandlers lets admins act on other users' accounts and content. Every action is
+// written to the audit log.
+type AdminHandlers struct {
+	hub    *websocket.Hub
+	images *services.ImageService
+}
+
+// NewAdminHandlers creates a new AdminHandlers.
+func NewAdminHandlers(hub *websocket.Hub, images *services.ImageService) *AdminHandlers {
+	return &AdminHandlers{hub: hub, images: images}
+}
+
+// adminTarget loads the admin making the request and the user in the path. It responds
+// with an error and returns nil users if either is missing, or if the admin is acting on
+// their own account.
+func adminTarget(w http.ResponseWriter, r *http.Request) (*models.User, *models.User) {
+	admin, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return nil, nil
+	}
+	target, err := models.GetUserByID(mux.Vars(r)["userId"])
+	if err != nil {
+		log.Printf("Error loading user %s: %v", mux.Vars(r)["userId"], err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to load user")
+		return nil, nil
+	}
+	if target == nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return nil, nil
+	}
+	if target.ID == admin.ID {
+		respondWithError(w, http.StatusBadRequest, "You cannot do this to your own account")
+		return nil, nil
+	}
+	return admin, target
+}
+
+// SuspendUserHandler suspends the user in the path until a given time, for a number of
+// days, or for good (a ban). They are signed out everywhere and their live connections
+// are dropped.
+func (h *AdminHandlers) SuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, target := adminTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	var req struct {
+		Until     string `json:"until"` // RFC 3339; takes precedence over days
+		Days      int    `json:"days"`
+		Permanent bool   `json:"permanent"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	now := time.Now()
+	var until time.Time
+	switch {
+	case req.Permanent:
+		until = models.BanUntil
+	case req.Until != "":
+		t, err := time.Parse(time.RFC3339, req.Until)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "until must be an RFC 3339 time")
+			return
+		}
+		until = t
+	case req.Days > 0:
+		until = now.AddDate(0, 0, req.Days)
+	default:
+		respondWithError(w, http.StatusBadRequest, "One of until, days or permanent is required")
+		return
+	}
+	if !until.After(now) {
+		respondWithError(w, http.StatusBadRequest, "A suspension must end in the future")
+		return
+	}
+	if target.HasRole(models.RoleAdmin) {
+		respondWithError(w, http.StatusForbidden, "Admins cannot be suspended; change their role first")
+		return
+	}
+
+	if err := models.SuspendAccount(target.ID, until, req.Reason); err != nil {
+		log.Printf("Error suspending user %s: %v", target.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to suspend user")
+		return
+	}
+	go h.hub.DisconnectUser(target.ID)
+	recordAudit(r, &models.AuditEntry{
+		ActorID:       admin.ID,
+		Action:        models.AuditAdminSuspendUser,
+		SubjectUserID: target.ID,
+		Details:       map[string]interface{}{"until": until.UTC(), "permanent": req.Permanent, "reason": req.Reason},
+	})
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "User suspended.", "until": until.UTC()})
+}
+
+// UnsuspendUserHandler ends the suspension of the user in the path.
+func (h *AdminHandlers) UnsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin, target := adminTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	lifted, err := models.LiftSuspension(target.ID, time.Now())
+	if err != nil {
+		log.Printf("Error lifting suspension of user %s: %v", target.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to unsuspend user")
+		return
+	}
+	if !lifted {
+		respondWithError(w, http.StatusConflict, "User is not suspended")
+		return
+	}
+	recordAudit(r, &models.AuditEntry{ActorID: admin.ID, Action: models.AuditAdminUnsuspendUser, SubjectUserID: target.ID})
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "User unsuspended."})
+}
+
+// RevokeSessionsHandler signs the user in the path out of every session and drops their
+// live connections.
+func (h *AdminHandlers) RevokeSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	admin, target := adminTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	revoked, err := models.DeleteSessionsForUser(target.ID)
+	if err != nil {
+		log.Printf("Error revoking sessions of user %s: %v", target.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to sign user out")
+		return
+	}
+	go h.hub.DisconnectUser(target.ID)
+	recordAudit(r, &models.AuditEntry{
+		ActorID:       admin.ID,
+		Action:        models.AuditAdminRevokeSessions,
+		SubjectUserID: target.ID,
+		Details:       map[string]interface{}{"sessions": revoked},
+	})
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "User signed out everywhere.", "sessions": revoked})
+}
+
+// SetRoleHandler changes the role of the user in the path.
+func (h *AdminHandlers) SetRoleHandler(w http.ResponseWriter, r *http.Request) {
+	admin, target := adminTarget(w, r)
+	if target == nil {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !models.IsValidRole(req.Role) {
+		respondWithError(w, http.StatusBadRequest, "Role must be user, moderator or admin")
+		return
+	}
+
+	if err := models.SetUserRole(target.ID, req.Role); err != nil {
+		log.Printf("Error setting role of user %s: %v", target.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to change role")
+		return
+	}
+	recordAudit(r, &models.AuditEntry{
+		ActorID:       admin.ID,
+		Action:        models.AuditAdminSetRole,
+		SubjectUserID: target.ID,
+		Details:       map[string]interface{}{"from": target.Role, "to": req.Role},
+	})
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Role updated.", "role": req.Role})
+}
+
+// RemoveContentHandler deletes a post, comment or chat message and releases the media it
+// referenced.
+func (h *AdminHandlers) RemoveContentHandler(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	vars := mux.Vars(r)
+	targetType, targetID := vars["targetType"], vars["targetId"]
+	if targetType != models.ReportTargetPost && targetType != models.ReportTargetComment && targetType != models.ReportTargetMessage {
+		respondWithError(w, http.StatusBadRequest, "Only posts, comments and messages can be removed")
+		return
+	}
+
+	owner, err := models.GetReportTargetOwner(targetType, targetID)
+	if err != nil {
+		log.Printf("Error looking up %s %s: %v", targetType, targetID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to remove content")
+		return
+	}
+
+	removed, err := services.RemoveContent(h.images, targetType, targetID)
+	if err != nil {
+		log.Printf("Error removing %s %s: %v", targetType, targetID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to remove content")
+		return
+	}
+	if !removed {
+		respondWithError(w, http.StatusNotFound, "Content not found")
+		return
+	}
+	recordAudit(r, &models.AuditEntry{
+		ActorID:       admin.ID,
+		Action:        models.AuditAdminRemoveContent,
+		SubjectUserID: owner,
+		TargetType:    targetType,
+		TargetID:      targetID,
+	})
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Content removed."})
+}
+
+// AuditLogHandler lists the audit log entries about the user in the path or actions
+// they took, newest first.
+func (h *AdminHandlers) AuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+	limit, offset := parsePagination(r, 50, 200)
+
+	entries, err := models.ListAuditEntriesInvolving(userID, limit, offset)
+	if err != nil {
+		log.Printf("Error listing audit log for %s: %v", userID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to load audit log")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"entries": entries})
+}
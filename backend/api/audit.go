@@ -0,0 +1,29 @@
+package api
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"social-network/database/models"
+)
+
+// recordAudit writes entry to the audit log with the request's client address and user
+// agent. A failure is logged but does not fail the request, since the action itself has
+// already happened.
+func recordAudit(r *http.Request, entry *models.AuditEntry) {
+	entry.IPAddress = clientIP(r)
+	entry.UserAgent = r.UserAgent()
+	if err := models.RecordAudit(entry); err != nil {
+		log.Printf("Error writing audit log entry %s by %s: %v", entry.Action, entry.ActorID, err)
+	}
+}
+
+// clientIP returns the address the request came from, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -18,12 +19,15 @@ import (
 
 // UserHandler holds dependencies for user-related handlers, like the WebSocket hub.
 type UserHandler struct {
-	hub *websocket.Hub
+	hub       *websocket.Hub
+	images    *services.ImageService
+	verifier  *services.EmailVerifier
+	twoFactor *services.TwoFactor
 }
 
 // NewUserHandlers creates a new UserHandler with its dependencies.
-func NewUserHandlers(h *websocket.Hub) *UserHandler {
-	return &UserHandler{hub: h}
+func NewUserHandlers(h *websocket.Hub, images *services.ImageService, verifier *services.EmailVerifier, twoFactor *services.TwoFactor) *UserHandler {
+	return &UserHandler{hub: h, images: images, verifier: verifier, twoFactor: twoFactor}
 }
 
 // --- Request/Response Structs remain the same ---
@@ -49,6 +53,16 @@ type UserResponse struct {
 	LastName  string `json:"lastName"`
 	Email     string `json:"email"`
 	Nickname  string `json:"nickname,omitempty"`
+	Role      string `json:"role,omitempty"`
+	// EmailVerified is false until the user confirms their address; until then they
+	// cannot post or send messages.
+	EmailVerified bool `json:"emailVerified"`
+	// TwoFactorEnabled is true when logging in also asks for an authenticator code.
+	TwoFactorEnabled bool `json:"twoFactorEnabled"`
+	// AccountRestored is set when logging in cancelled a pending account deletion.
+	AccountRestored bool `json:"accountRestored,omitempty"`
+	// AccountReactivated is set when logging in reactivated a deactivated account.
+	AccountReactivated bool `json:"accountReactivated,omitempty"`
 }
 
 // --- Handlers are now methods on the UserHandler struct ---
@@ -65,6 +79,14 @@ func (h *UserHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing required fields", http.StatusBadRequest)
 		return
 	}
+	if !isValidEmail(req.Email) {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if err := services.ValidatePassword(req.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	existingUser, _ := models.GetUserByEmail(req.Email)
 	if existingUser != nil {
@@ -96,9 +118,15 @@ func (h *UserHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The account works without verification, just with fewer capabilities, and the
+	// user can ask for another email, so a mail failure doesn't fail the registration.
+	if err := h.verifier.Send(user); err != nil {
+		log.Printf("ERROR: Failed to send verification email to user %s: %v", user.ID, err)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "User registered successfully"})
+	json.NewEncoder(w).Encode(map[string]string{"message": "User registered successfully. Check your email to verify your address."})
 }
 
 
@@ -111,12 +139,14 @@ func (h *UserHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var userID, userEmail, userFirstName, userLastName, userNickname, hashedPassword string
-	query := "SELECT id, email, first_name, last_name, nickname, password_hash FROM users WHERE email = ?"
-	log.Printf("LoginHandler: Executing DB query to find user: %s", req.Email)
-	err := database.DB.QueryRow(query, req.Email).Scan(&userID, &userEmail, &userFirstName, &userLastName, &userNickname, &hashedPassword)
+	var userID, hashedPassword string
+	var twoFactorEnabled bool
+	query := "SELECT id, password_hash, totp_enabled_at IS NOT NULL FROM users WHERE email = ?"
+	log.Println("LoginHandler: Executing DB query to find user.")
+	err := database.DB.QueryRow(query, req.Email).Scan(&userID, &hashedPassword, &twoFactorEnabled)
 	if err != nil {
 		log.Printf("LoginHandler: FAILED finding user in DB. Error: %v", err)
+		recordAudit(r, &models.AuditEntry{Action: models.AuditLoginFailed, Details: map[string]interface{}{"reason": "unknown_email"}})
 		respondWithError(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
@@ -124,19 +154,128 @@ func (h *UserHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 	if !services.CheckPasswordHash(req.Password, hashedPassword) {
 		log.Println("LoginHandler: FAILED password check.")
+		recordAudit(r, &models.AuditEntry{Action: models.AuditLoginFailed, SubjectUserID: userID, Details: map[string]interface{}{"reason": "wrong_password"}})
 		respondWithError(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
 	log.Println("LoginHandler: SUCCESS password check.")
 
-	sessionToken, expiryTime, err := createAndSaveSession(userID)
+	if !h.refuseSuspendedLogin(w, r, userID) {
+		return
+	}
+
+	// With 2FA on, the password only earns a short-lived pre-auth token, which
+	// TwoFactorLoginHandler exchanges for a session once the code checks out.
+	if twoFactorEnabled {
+		preAuthToken, expiresAt, err := h.twoFactor.StartLogin(userID)
+		if err != nil {
+			log.Printf("LoginHandler: FAILED starting two-factor login. Error: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to log in")
+			return
+		}
+		log.Printf("LoginHandler: Waiting for second factor of user %s.", userID)
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"twoFactorRequired": true,
+			"preAuthToken":      preAuthToken,
+			"expiresAt":         expiresAt,
+		})
+		return
+	}
+
+	h.completeLogin(w, r, userID, nil)
+}
+
+// TwoFactorLoginHandler finishes a login started by LoginHandler for a user with 2FA,
+// given the pre-auth token and a code from their authenticator app or a recovery code.
+func (h *UserHandler) TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PreAuthToken string `json:"preAuthToken"`
+		Code         string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	userID, method, err := h.twoFactor.FinishLogin(req.PreAuthToken, req.Code)
+	if errors.Is(err, models.ErrInvalidLoginChallenge) {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrInvalidTwoFactorCode) {
+		recordAudit(r, &models.AuditEntry{Action: models.AuditLoginFailed, SubjectUserID: userID, Details: map[string]interface{}{"reason": "wrong_2fa_code"}})
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("TwoFactorLoginHandler: FAILED checking code. Error: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+
+	// The account may have been suspended since the password was checked.
+	if !h.refuseSuspendedLogin(w, r, userID) {
+		return
+	}
+	h.completeLogin(w, r, userID, map[string]interface{}{"method": method})
+}
+
+// refuseSuspendedLogin responds with an error and returns false if userID may not log
+// in because their account is suspended.
+func (h *UserHandler) refuseSuspendedLogin(w http.ResponseWriter, r *http.Request, userID string) bool {
+	suspension, err := models.GetActiveSuspension(userID, time.Now())
+	if err != nil {
+		log.Printf("LoginHandler: FAILED checking account suspension. Error: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to log in")
+		return false
+	}
+	if suspension != nil {
+		log.Printf("LoginHandler: Refused login for suspended account %s.", userID)
+		recordAudit(r, &models.AuditEntry{Action: models.AuditLoginFailed, SubjectUserID: userID, Details: map[string]interface{}{"reason": "suspended"}})
+		respondWithError(w, http.StatusForbidden, suspension.Message())
+		return false
+	}
+	return true
+}
+
+// completeLogin logs in userID once they have proved who they are: it restores or
+// reactivates their account if needed, starts a session and responds with the user.
+func (h *UserHandler) completeLogin(w http.ResponseWriter, r *http.Request, userID string, auditDetails map[string]interface{}) {
+	// Logging in during the deletion grace period restores the account.
+	restored, err := models.CancelAccountDeletion(userID)
+	if err != nil {
+		log.Printf("LoginHandler: FAILED checking pending account deletion. Error: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+	if restored {
+		log.Printf("LoginHandler: Restored account %s scheduled for deletion.", userID)
+	}
+	reactivated, err := models.ReactivateAccount(userID)
+	if err != nil {
+		log.Printf("LoginHandler: FAILED reactivating account. Error: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+	if reactivated {
+		log.Printf("LoginHandler: Reactivated account %s.", userID)
+	}
+
+	user, err := models.GetUserByID(userID)
+	if err != nil || user == nil {
+		log.Printf("LoginHandler: FAILED loading user. Error: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+
+	sessionToken, expiryTime, err := createAndSaveSession(userID, r)
 	if err != nil {
 		log.Printf("LoginHandler: FAILED creating session. Error: %v", err)
 		respondWithError(w, http.StatusInternalServerError, "Failed to create session")
 		return
 	}
 
-	log.Printf("LoginHandler: Setting cookie with name 'social_network_session' and value '%s'", sessionToken)
+	log.Printf("LoginHandler: Setting cookie with name 'social_network_session' for user %s.", userID)
 	http.SetCookie(w, &http.Cookie{
 		Name:     "social_network_session",
 		Value:    sessionToken,
@@ -147,24 +286,40 @@ func (h *UserHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	})
 
 	log.Println("LoginHandler: Login successful. Sending response.")
+	recordAudit(r, &models.AuditEntry{ActorID: userID, Action: models.AuditLoginSucceeded, SubjectUserID: userID, Details: auditDetails})
 	respondWithJSON(w, http.StatusOK, UserResponse{
-		ID:        userID,
-		FirstName: userFirstName,
-		LastName:  userLastName,
-		Email:     userEmail,
-		Nickname:  userNickname,
+		ID:        user.ID,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Email:     user.Email,
+		Nickname:  user.Nickname,
+		Role:      user.Role,
+
+		EmailVerified:      user.EmailVerified,
+		TwoFactorEnabled:   user.TwoFactorEnabled,
+		AccountRestored:    restored,
+		AccountReactivated: reactivated,
 	})
 }
 
-func createAndSaveSession(userID string) (string, time.Time, error) {
+// createAndSaveSession starts a session for userID, remembering the address and browser
+// it was started from so the user can recognise it in their session list.
+func createAndSaveSession(userID string, r *http.Request) (string, time.Time, error) {
 	tokenUUID, err := uuid.NewRandom()
 	if err != nil { return "", time.Time{}, err }
 	token := tokenUUID.String()
-	expiry := time.Now().Add(7 * 24 * time.Hour)
-
-	log.Printf("createAndSaveSession: Attempting to INSERT token '%s' for user '%s' into DB.", token, userID)
-	query := "INSERT INTO sessions (token, user_id, expiry) VALUES (?, ?, ?)"
-	_, err = database.DB.Exec(query, token, userID, expiry)
+	now := time.Now().UTC()
+	expiry := services.SessionExpiry(now, now)
+
+	log.Printf("createAndSaveSession: Attempting to INSERT session for user '%s' into DB.", userID)
+	err = models.CreateSession(&models.Session{
+		Token:     token,
+		UserID:    userID,
+		ExpiresAt: expiry,
+		CreatedAt: now,
+		IPAddress: clientIP(r),
+		UserAgent: r.UserAgent(),
+	})
 	if err != nil {
 		log.Printf("createAndSaveSession: FAILED to insert session into DB. Error: %v", err)
 		return "", time.Time{}, err
@@ -175,6 +330,9 @@ func createAndSaveSession(userID string) (string, time.Time, error) {
 }
 
 func (h *UserHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if user, err := services.GetUserFromSession(r); err == nil && user != nil {
+		recordAudit(r, &models.AuditEntry{ActorID: user.ID, Action: models.AuditLogout, SubjectUserID: user.ID})
+	}
 	services.ClearSessionCookie(w, r)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -195,6 +353,10 @@ func (h *UserHandler) CurrentUserHandler(w http.ResponseWriter, r *http.Request)
 		LastName:  user.LastName,
 		Email:     user.Email,
 		Nickname:  user.Nickname,
+		Role:      user.Role,
+
+		EmailVerified:    user.EmailVerified,
+		TwoFactorEnabled: user.TwoFactorEnabled,
 	})
 }
 
@@ -224,6 +386,16 @@ func (h *UserHandler) FollowRequestHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	blocked, err := models.IsBlockedEitherWay(actor.ID, targetUserID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "You cannot follow this user", http.StatusForbidden)
+		return
+	}
+
 	// Check if already following
 	alreadyFollowing, err := models.AreFollowing(actor.ID, targetUserID)
 	if err != nil {
@@ -331,6 +503,13 @@ func (h *UserHandler) AcceptFollowRequestHandler(w http.ResponseWriter, r *http.
 		http.Error(w, "Failed to create follow relationship", http.StatusInternalServerError)
 		return
 	}
+	recordAudit(r, &models.AuditEntry{
+		ActorID:       actor.ID,
+		Action:        models.AuditFollowAccepted,
+		SubjectUserID: actor.ID,
+		TargetType:    "user",
+		TargetID:      targetRequest.RequesterID,
+	})
 
 	// Get requester info for notification
 	requester, err := models.GetUserByID(targetRequest.RequesterID)
@@ -392,6 +571,13 @@ func (h *UserHandler) DeclineFollowRequestHandler(w http.ResponseWriter, r *http
 		http.Error(w, "Failed to decline request", http.StatusInternalServerError)
 		return
 	}
+	recordAudit(r, &models.AuditEntry{
+		ActorID:       actor.ID,
+		Action:        models.AuditFollowDeclined,
+		SubjectUserID: actor.ID,
+		TargetType:    "user",
+		TargetID:      targetRequest.RequesterID,
+	})
 
 	// Get requester info for notification
 	requester, err := models.GetUserByID(targetRequest.RequesterID)
@@ -489,20 +675,14 @@ func (h *UserHandler) GetFollowRequestsHandler(w http.ResponseWriter, r *http.Re
 	var response []map[string]interface{}
 	for _, req := range requests {
 		requester, err := models.GetUserByID(req.RequesterID)
-		if err != nil {
+		if err != nil || requester == nil {
 			log.Printf("Error getting requester info for request %s: %v", req.ID, err)
 			continue
 		}
 
 		response = append(response, map[string]interface{}{
-			"id": req.ID,
-			"requester": map[string]interface{}{
-				"id":         requester.ID,
-				"firstName":  requester.FirstName,
-				"lastName":   requester.LastName,
-				"nickname":   requester.Nickname,
-				"avatarPath": requester.AvatarPath,
-			},
+			"id":        req.ID,
+			"requester": serializeUser(requester, actor),
 			"createdAt": req.CreatedAt,
 		})
 	}
@@ -529,20 +709,14 @@ func (h *UserHandler) GetMyFollowRequestsHandler(w http.ResponseWriter, r *http.
 	var response []map[string]interface{}
 	for _, req := range requests {
 		recipient, err := models.GetUserByID(req.TargetID)
-		if err != nil {
+		if err != nil || recipient == nil {
 			log.Printf("Error getting recipient info for request %s: %v", req.ID, err)
 			continue
 		}
 
 		response = append(response, map[string]interface{}{
-			"id": req.ID,
-			"recipient": map[string]interface{}{
-				"id":         recipient.ID,
-				"firstName":  recipient.FirstName,
-				"lastName":   recipient.LastName,
-				"nickname":   recipient.Nickname,
-				"avatarPath": recipient.AvatarPath,
-			},
+			"id":        req.ID,
+			"recipient": serializeUser(recipient, actor),
 			"createdAt": req.CreatedAt,
 		})
 	}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"social-network/database/models"
+	"social-network/services"
+
+	"github.com/gorilla/mux"
+)
+
+// BlockUserHandler blocks the user in the path for the current user. Follows between
+// the two users and pending follow requests are removed, so both users' lists are refreshed.
+func (h *UserHandler) BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	targetUserID := mux.Vars(r)["userId"]
+	if targetUserID == "" || targetUserID == actor.ID {
+		respondWithError(w, http.StatusBadRequest, "Invalid target user")
+		return
+	}
+	target, err := models.GetUserByID(targetUserID)
+	if err != nil || target == nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if err := models.BlockUser(actor.ID, target.ID); err != nil {
+		log.Printf("Error blocking user %s for %s: %v", target.ID, actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to block user")
+		return
+	}
+
+	go h.hub.SendUserListUpdate(actor.ID)
+	go h.hub.SendUserListUpdate(target.ID)
+	go h.hub.SendFollowRequestUpdate(actor.ID)
+	go h.hub.SendFollowRequestUpdate(target.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "User blocked."})
+}
+
+// UnblockUserHandler lifts a block the current user placed on the user in the path.
+func (h *UserHandler) UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	targetUserID := mux.Vars(r)["userId"]
+	if targetUserID == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid target user")
+		return
+	}
+
+	if err := models.UnblockUser(actor.ID, targetUserID); err != nil {
+		log.Printf("Error unblocking user %s for %s: %v", targetUserID, actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to unblock user")
+		return
+	}
+
+	go h.hub.SendUserListUpdate(actor.ID)
+	go h.hub.SendUserListUpdate(targetUserID)
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "User unblocked."})
+}
+
+// ListBlockedUsersHandler returns the users the current user has blocked.
+func (h *UserHandler) ListBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	blocked, err := models.ListBlockedUsers(actor.ID)
+	if err != nil {
+		log.Printf("Error listing blocked users of %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list blocked users")
+		return
+	}
+
+	users := make([]map[string]interface{}, 0, len(blocked))
+	for _, b := range blocked {
+		u, err := models.GetUserByID(b.UserID)
+		if err != nil || u == nil {
+			continue
+		}
+		entry := serializeUser(u, actor)
+		entry["blockedAt"] = b.BlockedAt
+		users = append(users, entry)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"blocked": users})
+}
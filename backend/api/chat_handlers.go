@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"time"
 
@@ -17,13 +18,14 @@ import (
 
 // ChatHandlers holds dependencies for chat-related handlers.
 type ChatHandlers struct {
-	hub *websocket.Hub
+	hub    *websocket.Hub
+	images *services.ImageService
 }
 
 // NewChatHandlers creates a new ChatHandlers.
 
-func NewChatHandlers(hub *websocket.Hub) *ChatHandlers {
-	return &ChatHandlers{hub: hub}
+func NewChatHandlers(hub *websocket.Hub, images *services.ImageService) *ChatHandlers {
+	return &ChatHandlers{hub: hub, images: images}
 }
 
 // GetPrivateConversationHandler fetches the message history between the logged-in user and another user.
@@ -93,7 +95,7 @@ func (h *ChatHandlers) GetGroupConversationHandler(w http.ResponseWriter, r *htt
 // getPrivateMessages queries the database for the conversation between two users.
 func getPrivateMessages(userID1, userID2 int) ([]models.Message, error) {
 	query := `
-		SELECT id, sender_id, recipient_id, group_id, content, created_at FROM chat_messages
+		SELECT id, sender_id, recipient_id, group_id, content, attachment_path, created_at FROM chat_messages
 		WHERE (sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)
 		ORDER BY created_at ASC
 		LIMIT 100` // Always use LIMIT for chat history to prevent fetching huge datasets.
@@ -110,7 +112,7 @@ func getPrivateMessages(userID1, userID2 int) ([]models.Message, error) {
 // getPrivateMessagesWithStrings queries the database for the conversation between two users using string IDs.
 func getPrivateMessagesWithStrings(userID1, userID2 string) ([]models.Message, error) {
 	query := `
-		SELECT id, sender_id, recipient_id, group_id, content, created_at FROM chat_messages
+		SELECT id, sender_id, recipient_id, group_id, content, attachment_path, created_at FROM chat_messages
 		WHERE (sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)
 		ORDER BY created_at ASC
 		LIMIT 100`
@@ -127,7 +129,7 @@ func getPrivateMessagesWithStrings(userID1, userID2 string) ([]models.Message, e
 // getGroupMessages queries the database for all messages in a specific group.
 func getGroupMessages(groupID string) ([]models.Message, error) {
 	query := `
-		SELECT id, sender_id, recipient_id, group_id, content, created_at FROM chat_messages
+		SELECT id, sender_id, recipient_id, group_id, content, attachment_path, created_at FROM chat_messages
 		WHERE group_id = ?
 		ORDER BY created_at ASC
 		LIMIT 100`
@@ -147,12 +149,15 @@ func scanMessages(rows *sql.Rows) ([]models.Message, error) {
 	var messages []models.Message
 	for rows.Next() {
 		var msg models.Message
-		var recipientID, groupID sql.NullString // Use sql.NullString for nullable columns.
+		var senderID, recipientID, groupID, attachmentPath sql.NullString // Use sql.NullString for nullable columns.
 
-		if err := rows.Scan(&msg.ID, &msg.SenderID, &recipientID, &groupID, &msg.Content, &msg.CreatedAt); err != nil {
+		if err := rows.Scan(&msg.ID, &senderID, &recipientID, &groupID, &msg.Content, &attachmentPath, &msg.CreatedAt); err != nil {
 			return nil, err
 		}
 
+		// Group messages from deleted accounts are kept without a sender.
+		msg.SenderID = senderID.String
+
 		// Only assign the string if the database value was not NULL.
 		if recipientID.Valid {
 			msg.RecipientID = recipientID.String
@@ -160,11 +165,20 @@ func scanMessages(rows *sql.Rows) ([]models.Message, error) {
 		if groupID.Valid {
 			msg.GroupID = groupID.String
 		}
+		msg.AttachmentPath = attachmentPath.String
+		setMessageAttachmentVariants(&msg)
 		messages = append(messages, msg)
 	}
 	return messages, rows.Err()
 }
 
+// setMessageAttachmentVariants fills in the thumbnail and medium paths derived from the attachment.
+func setMessageAttachmentVariants(msg *models.Message) {
+	msg.AttachmentThumbnail = services.VariantPath(msg.AttachmentPath, services.ThumbnailVariant)
+	msg.AttachmentMedium = services.VariantPath(msg.AttachmentPath, services.MediumVariant)
+	msg.AttachmentAnimated = services.IsAnimated(msg.AttachmentPath)
+}
+
 // GetConversationsHandler returns a list of all conversations for the current user
 func (h *ChatHandlers) GetConversationsHandler(w http.ResponseWriter, r *http.Request) {
 	currentUser, ok := r.Context().Value(services.UserContextKey).(*models.User)
@@ -222,7 +236,7 @@ func (h *ChatHandlers) SearchUsersHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	users, err := searchUsersForChat(currentUser.ID, query)
+	users, err := searchUsersForChat(currentUser, query)
 	if err != nil {
 		log.Printf("Error searching users: %v", err)
 		respondWithError(w, http.StatusInternalServerError, "Could not search users")
@@ -245,12 +259,31 @@ func (h *ChatHandlers) SendMessageHandler(w http.ResponseWriter, r *http.Request
 		Content     string `json:"content"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	// A multipart body may carry an "image" attachment alongside the text.
+	var file multipart.File
+	var fileHeader *multipart.FileHeader
+	if isMultipartRequest(r) {
+		if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Could not parse multipart form")
+			return
+		}
+		req.RecipientID = r.FormValue("recipientId")
+		req.Content = r.FormValue("content")
+		var err error
+		file, fileHeader, err = r.FormFile("image")
+		if err != nil && err != http.ErrMissingFile {
+			respondWithError(w, http.StatusBadRequest, "Could not read image file")
+			return
+		}
+		if file != nil {
+			defer file.Close()
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	if req.RecipientID == "" || req.Content == "" {
+	if req.RecipientID == "" || (req.Content == "" && file == nil) {
 		respondWithError(w, http.StatusBadRequest, "Recipient ID and content are required")
 		return
 	}
@@ -267,19 +300,42 @@ func (h *ChatHandlers) SendMessageHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Store the attachment only once we know the message is allowed.
+	var attachmentPath string
+	if file != nil {
+		contentType, err := h.images.ValidateImage(file, fileHeader)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		attachmentPath, err = h.images.SaveImage(file, contentType)
+		if services.IsImageRejected(err) {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			log.Printf("Error saving chat attachment: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to save image")
+			return
+		}
+	}
+
 	// Create the message
 	message := &models.Message{
-		SenderID:    currentUser.ID,
-		RecipientID: req.RecipientID,
-		Content:     req.Content,
-		CreatedAt:   time.Now(),
+		SenderID:       currentUser.ID,
+		RecipientID:    req.RecipientID,
+		Content:        req.Content,
+		AttachmentPath: attachmentPath,
+		CreatedAt:      time.Now(),
 	}
 
 	// Save the message to the database
 	if err := models.SaveMessage(message); err != nil {
+		h.images.ReleaseImage(attachmentPath)
 		respondWithError(w, http.StatusInternalServerError, "Error saving message")
 		return
 	}
+	setMessageAttachmentVariants(message)
 
 	// Send the message via WebSocket to the recipient if they're online
 	h.hub.SendMessageToUser(req.RecipientID, message)
@@ -405,37 +461,18 @@ func getUserConversations(userID string) ([]Conversation, error) {
 }
 
 // searchUsersForChat searches for users that the current user can message
-func searchUsersForChat(currentUserID, query string) ([]map[string]interface{}, error) {
-	searchQuery := `
-		SELECT id, first_name, last_name, nickname, avatar_path, is_public
-		FROM users
-		WHERE id != ?
-			AND (first_name LIKE ? OR last_name LIKE ? OR nickname LIKE ?)
-		LIMIT 20
-	`
-
-	searchTerm := "%" + query + "%"
-	rows, err := database.DB.Query(searchQuery, currentUserID, searchTerm, searchTerm, searchTerm)
+func searchUsersForChat(currentUser *models.User, query string) ([]map[string]interface{}, error) {
+	matches, err := models.SearchUsers(currentUser.ID, query, 20)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
 	var users []map[string]interface{}
-	for rows.Next() {
-		var id, firstName, lastName string
-		var nickname, avatarPath sql.NullString
-		var isPublic bool
-
-		err := rows.Scan(&id, &firstName, &lastName, &nickname, &avatarPath, &isPublic)
-		if err != nil {
-			return nil, err
-		}
-
+	for _, match := range matches {
 		// Check if current user can message this user
-		canMessage, err := models.CanUsersMessage(currentUserID, id)
+		canMessage, err := models.CanUsersMessage(currentUser.ID, match.ID)
 		if err != nil {
-			log.Printf("Error checking message permissions for user %s: %v", id, err)
+			log.Printf("Error checking message permissions for user %s: %v", match.ID, err)
 			continue
 		}
 
@@ -444,16 +481,8 @@ func searchUsersForChat(currentUserID, query string) ([]map[string]interface{},
 			continue
 		}
 
-		user := map[string]interface{}{
-			"id":         id,
-			"firstName":  firstName,
-			"lastName":   lastName,
-			"nickname":   nickname.String,
-			"avatarPath": avatarPath.String,
-			"isPublic":   isPublic,
-			"canMessage": canMessage,
-		}
-
+		user := serializeUser(match, currentUser)
+		user["canMessage"] = canMessage
 		users = append(users, user)
 	}
 
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"social-network/database/models"
+	"social-network/services"
+)
+
+// VerifyEmailHandler confirms the address an emailed verification link was sent to. It
+// doesn't need a session, so the link works in any browser.
+func (h *UserHandler) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	verified, err := h.verifier.Verify(req.Token)
+	if errors.Is(err, models.ErrInvalidVerificationToken) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, models.ErrEmailInUse) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error verifying email: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to verify email address")
+		return
+	}
+
+	entry := &models.AuditEntry{ActorID: verified.UserID, Action: models.AuditEmailVerified, SubjectUserID: verified.UserID}
+	if verified.Email != verified.PreviousEmail {
+		entry.Action = models.AuditEmailChanged
+		entry.Details = map[string]interface{}{"from": verified.PreviousEmail, "to": verified.Email}
+	}
+	recordAudit(r, entry)
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Your email address is verified."})
+}
+
+// ResendVerificationHandler sends the current user another verification email.
+func (h *UserHandler) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	err := h.verifier.Resend(user)
+	switch {
+	case errors.Is(err, services.ErrEmailAlreadyVerified):
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, services.ErrVerificationRateLimited):
+		respondWithError(w, http.StatusTooManyRequests, err.Error())
+		return
+	case err != nil:
+		log.Printf("Error resending verification email to %s: %v", user.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to send verification email")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Verification email sent."})
+}
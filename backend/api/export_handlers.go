@@ -0,0 +1,137 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"social-network/database/models"
+	"social-network/services"
+
+	"github.com/gorilla/mux"
+)
+
+// ExportHandlers lets users download a copy of their personal data.
+type ExportHandlers struct {
+	exporter *services.DataExporter
+}
+
+// NewExportHandlers creates a new ExportHandlers.
+func NewExportHandlers(exporter *services.DataExporter) *ExportHandlers {
+	return &ExportHandlers{exporter: exporter}
+}
+
+// RequestExportHandler starts building a personal data export. The archive is prepared
+// in the background and the user gets a notification with the download link when it is ready.
+func (h *ExportHandlers) RequestExportHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	export, err := h.exporter.Request(user.ID)
+	if errors.Is(err, models.ErrExportInProgress) {
+		respondWithError(w, http.StatusConflict, "Your previous data export is still being prepared")
+		return
+	}
+	if err != nil {
+		log.Printf("Error requesting data export for user %s: %v", user.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to start data export")
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, export)
+}
+
+// ListExportsHandler returns the current user's exports and their status.
+func (h *ExportHandlers) ListExportsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	exports, err := models.ListDataExportsForUser(user.ID)
+	if err != nil {
+		log.Printf("Error listing data exports for user %s: %v", user.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to load data exports")
+		return
+	}
+	response := make([]map[string]interface{}, 0, len(exports))
+	for _, export := range exports {
+		item := map[string]interface{}{
+			"id":        export.ID,
+			"status":    export.Status,
+			"createdAt": export.CreatedAt,
+		}
+		if export.CompletedAt != nil {
+			item["completedAt"] = export.CompletedAt
+		}
+		if export.Status == models.ExportReady {
+			item["size"] = export.Size
+			item["expiresAt"] = export.ExpiresAt
+			item["downloadUrl"] = services.DataExportDownloadPath(export.ID)
+		}
+		response = append(response, item)
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// DownloadExportHandler sends a finished export to its owner until the link expires.
+func (h *ExportHandlers) DownloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	export, err := models.GetDataExport(mux.Vars(r)["exportId"])
+	if err != nil {
+		log.Printf("Error loading data export: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to load data export")
+		return
+	}
+	// Someone else's export is reported as missing rather than forbidden.
+	if export == nil || export.UserID != user.ID {
+		respondWithError(w, http.StatusNotFound, "Data export not found")
+		return
+	}
+	if export.Status != models.ExportReady {
+		respondWithError(w, http.StatusConflict, "This data export is not ready")
+		return
+	}
+	if export.Expired(time.Now()) {
+		respondWithError(w, http.StatusGone, "This download link has expired, please request a new export")
+		return
+	}
+
+	signedURL, err := h.exporter.SignedURL(export)
+	if err != nil {
+		log.Printf("Error signing data export URL for %s: %v", export.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Could not load data export")
+		return
+	}
+	if signedURL != "" {
+		w.Header().Set("Cache-Control", "private, no-store")
+		http.Redirect(w, r, signedURL, http.StatusFound)
+		return
+	}
+
+	f, info, err := h.exporter.Open(export)
+	if errors.Is(err, services.ErrObjectNotFound) {
+		respondWithError(w, http.StatusGone, "This data export is no longer available")
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening data export %s: %v", export.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Could not load data export")
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="social-network-export-`+export.CreatedAt.Format("2006-01-02")+`.zip"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, "", info.ModTime, f)
+}
@@ -27,6 +27,10 @@ func (h *UserHandler) SendFollowRequestHandler(w http.ResponseWriter, r *http.Re
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
+	if blocked, err := models.IsBlockedEitherWay(actor.ID, targetUserID); err != nil || blocked {
+		http.Error(w, "You cannot follow this user", http.StatusForbidden)
+		return
+	}
 	if targetUser.IsPublic {
 		// Auto-follow
 		err := models.AcceptFollowRequest(actor.ID, targetUserID)
@@ -100,6 +104,10 @@ func (h *UserHandler) ListFollowersHandler(w http.ResponseWriter, r *http.Reques
 		http.Error(w, "Failed to list followers", http.StatusInternalServerError)
 		return
 	}
+	followers, ok := h.withoutBlockedUsers(w, r, userID, followers)
+	if !ok {
+		return
+	}
 	json.NewEncoder(w).Encode(map[string]interface{}{ "followers": followers })
 }
 
@@ -116,9 +124,39 @@ func (h *UserHandler) ListFollowingHandler(w http.ResponseWriter, r *http.Reques
 		http.Error(w, "Failed to list following", http.StatusInternalServerError)
 		return
 	}
+	following, ok := h.withoutBlockedUsers(w, r, userID, following)
+	if !ok {
+		return
+	}
 	json.NewEncoder(w).Encode(map[string]interface{}{ "following": following })
 }
 
+// withoutBlockedUsers drops the users the viewer blocked or was blocked by from ids.
+// If the list belongs to such a user it responds with 404 and returns false.
+func (h *UserHandler) withoutBlockedUsers(w http.ResponseWriter, r *http.Request, ownerID string, ids []string) ([]string, bool) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		return ids, true
+	}
+	blocked, err := models.GetBlockedUserIDs(actor.ID)
+	if err != nil {
+		log.Printf("Error loading blocked users of %s: %v", actor.ID, err)
+		http.Error(w, "Failed to load users", http.StatusInternalServerError)
+		return nil, false
+	}
+	if blocked[ownerID] {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	visible := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !blocked[id] {
+			visible = append(visible, id)
+		}
+	}
+	return visible, true
+}
+
 // ListPendingFollowRequestsHandler returns a list of pending follow requests for the current user.
 func (h *UserHandler) ListPendingFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
 	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
@@ -138,20 +176,14 @@ func (h *UserHandler) ListPendingFollowRequestsHandler(w http.ResponseWriter, r
 	var requests []map[string]interface{}
 	for _, followRequest := range followRequests {
 		requester, err := models.GetUserByID(followRequest.RequesterID)
-		if err != nil {
+		if err != nil || requester == nil {
 			log.Printf("Error getting requester info for ID %s: %v", followRequest.RequesterID, err)
 			continue
 		}
 		
 		requests = append(requests, map[string]interface{}{
-			"id": followRequest.ID,
-			"requester": map[string]interface{}{
-				"id":        requester.ID,
-				"firstName": requester.FirstName,
-				"lastName":  requester.LastName,
-				"nickname":  requester.Nickname,
-				"avatarPath": requester.AvatarPath,
-			},
+			"id":        followRequest.ID,
+			"requester": serializeUser(requester, actor),
 			"createdAt": followRequest.CreatedAt,
 		})
 	}
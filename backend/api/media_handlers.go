@@ -0,0 +1,204 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+
+	"social-network/database"
+	"social-network/database/models"
+	"social-network/services"
+
+	"github.com/gorilla/mux"
+)
+
+// MediaHandlers serves files stored through the ImageService.
+type MediaHandlers struct {
+	images *services.ImageService
+}
+
+// NewMediaHandlers creates a new MediaHandlers.
+func NewMediaHandlers(images *services.ImageService) *MediaHandlers {
+	return &MediaHandlers{images: images}
+}
+
+// ServeMediaHandler streams an uploaded file to an authenticated user after checking
+// that they may see the post, comment, avatar or chat message it belongs to.
+// Conditional (ETag) and Range requests are handled by http.ServeContent.
+func (h *MediaHandlers) ServeMediaHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	relativePath := mux.Vars(r)["path"]
+	if _, err := services.CleanKey(relativePath); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid media path")
+		return
+	}
+
+	// Thumbnails and medium copies share the access rules of the image they came from.
+	found, allowed, err := CanUserViewMedia(user.ID, services.OriginalPath(relativePath))
+	if err != nil {
+		log.Printf("Error checking media access for %s: %v", relativePath, err)
+		respondWithError(w, http.StatusInternalServerError, "Could not verify media access")
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Media not found")
+		return
+	}
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, "You do not have permission to view this media")
+		return
+	}
+
+	// Backends with signed URLs (S3) serve the bytes themselves; the URL is short-lived,
+	// so the access check above still decides who can fetch it.
+	signedURL, err := h.images.SignedImageURL(relativePath)
+	if err != nil {
+		log.Printf("Error signing media URL for %s: %v", relativePath, err)
+		respondWithError(w, http.StatusInternalServerError, "Could not load media")
+		return
+	}
+	if signedURL != "" {
+		w.Header().Set("Cache-Control", "private, no-store")
+		http.Redirect(w, r, signedURL, http.StatusFound)
+		return
+	}
+
+	f, info, err := h.images.OpenImage(relativePath)
+	if errors.Is(err, services.ErrObjectNotFound) {
+		respondWithError(w, http.StatusNotFound, "Media not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error opening media %s: %v", relativePath, err)
+		respondWithError(w, http.StatusInternalServerError, "Could not load media")
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("ETag", info.ETag)
+	// Access depends on the viewer, so shared caches must not store the response.
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, path.Base(info.Key), info.ModTime, f)
+}
+
+// CanUserViewMedia reports whether relativePath belongs to anything stored in the
+// database (found) and whether userID may see it. Identical uploads share one file,
+// so the same path can be referenced several times; access is granted if any one of
+// those references is visible to the user.
+func CanUserViewMedia(userID, relativePath string) (found bool, allowed bool, err error) {
+	// Avatars are shown next to names everywhere, so any signed-in user may load them.
+	// Older avatars were stored with an "uploads/" prefix relative to the working directory.
+	var exists bool
+	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE avatar_path = ? OR avatar_path = ?)",
+		relativePath, "uploads/"+relativePath).Scan(&exists)
+	if err != nil {
+		return false, false, err
+	}
+	if exists {
+		return true, true, nil
+	}
+
+	// Cover photos are part of the profile, so they follow the profile's privacy.
+	rows, err := database.DB.Query("SELECT id, is_public FROM users WHERE cover_path = ?", relativePath)
+	if err != nil {
+		return false, false, err
+	}
+	type coverRef struct {
+		ownerID  string
+		isPublic bool
+	}
+	var covers []coverRef
+	for rows.Next() {
+		var ref coverRef
+		if err := rows.Scan(&ref.ownerID, &ref.isPublic); err != nil {
+			rows.Close()
+			return false, false, err
+		}
+		covers = append(covers, ref)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, false, err
+	}
+	for _, ref := range covers {
+		found = true
+		if ref.isPublic || ref.ownerID == userID {
+			return true, true, nil
+		}
+		if allowed, err = models.AreFollowing(userID, ref.ownerID); err != nil || allowed {
+			return true, allowed, err
+		}
+	}
+
+	// Post images follow the post's privacy setting, and comment images are visible
+	// to anyone who can see the parent post.
+	rows, err = database.DB.Query(`
+		SELECT id FROM posts WHERE image_url = ?
+		UNION
+		SELECT post_id FROM comments WHERE image_url = ?`, relativePath, relativePath)
+	if err != nil {
+		return false, false, err
+	}
+	var postIDs []int
+	for rows.Next() {
+		var postID int
+		if err := rows.Scan(&postID); err != nil {
+			rows.Close()
+			return false, false, err
+		}
+		postIDs = append(postIDs, postID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, false, err
+	}
+	for _, postID := range postIDs {
+		found = true
+		if allowed, err = CanUserViewPost(userID, postID); err != nil || allowed {
+			return true, allowed, err
+		}
+	}
+
+	// Chat attachments are limited to the two participants or the group's members.
+	rows, err = database.DB.Query("SELECT sender_id, recipient_id, group_id FROM chat_messages WHERE attachment_path = ?", relativePath)
+	if err != nil {
+		return false, false, err
+	}
+	type chatRef struct {
+		senderID             string
+		recipientID, groupID sql.NullString
+	}
+	var refs []chatRef
+	for rows.Next() {
+		var ref chatRef
+		if err := rows.Scan(&ref.senderID, &ref.recipientID, &ref.groupID); err != nil {
+			rows.Close()
+			return false, false, err
+		}
+		refs = append(refs, ref)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, false, err
+	}
+	for _, ref := range refs {
+		found = true
+		if userID == ref.senderID || (ref.recipientID.Valid && userID == ref.recipientID.String) {
+			return true, true, nil
+		}
+		if ref.groupID.Valid {
+			if allowed, err = models.IsUserInGroup(userID, ref.groupID.String); err != nil || allowed {
+				return true, allowed, err
+			}
+		}
+	}
+	return found, false, nil
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"time"
 
 	"social-network/database"
 	"social-network/database/models"
 	"social-network/services"
+
+	"github.com/gorilla/mux"
 )
 
 // Define a new type for our context key to avoid collisions.
@@ -28,7 +31,7 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		sessionToken := cookie.Value
-		log.Printf("AuthMiddleware: Found session token: %s", sessionToken)
+		log.Println("AuthMiddleware: Found session token")
 
 		if sessionToken == "" {
 			log.Println("AuthMiddleware: Session token is empty")
@@ -38,10 +41,11 @@ func AuthMiddleware(next http.Handler) http.Handler {
 
 		// 3. Validate the session token against the database
 		var userID string // Keep as string since it's a UUID
-		query := "SELECT user_id FROM sessions WHERE token = ? AND expiry > CURRENT_TIMESTAMP"
-		err = database.DB.QueryRow(query, sessionToken).Scan(&userID)
+		var createdAt time.Time
+		query := "SELECT user_id, created_at FROM sessions WHERE token = ? AND expiry > CURRENT_TIMESTAMP"
+		err = database.DB.QueryRow(query, sessionToken).Scan(&userID, &createdAt)
 		if err != nil {
-			log.Printf("AuthMiddleware: Invalid session token '%s', error: %v", sessionToken, err)
+			log.Printf("AuthMiddleware: Invalid session token, error: %v", err)
 			respondWithError(w, http.StatusUnauthorized, "User not authenticated: invalid or expired session")
 			return
 		}
@@ -55,6 +59,16 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			respondWithError(w, http.StatusUnauthorized, "User not found")
 			return
 		}
+		if suspension := user.ActiveSuspension(time.Now()); suspension != nil {
+			log.Printf("AuthMiddleware: Refused request from suspended user %s", userID)
+			models.DeleteSession(sessionToken)
+			respondWithError(w, http.StatusForbidden, suspension.Message())
+			return
+		}
+		// Activity keeps the session alive, up to its absolute lifetime
+		if err := services.RenewSession(w, sessionToken, createdAt, clientIP(r), r.UserAgent()); err != nil {
+			log.Printf("AuthMiddleware: Failed to renew session for user %s: %v", userID, err)
+		}
 
 		// 5. Add the full user object to the context using the services context key
 		ctx := context.WithValue(r.Context(), services.UserContextKey, user)
@@ -90,3 +104,39 @@ func CORSMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// RequireRole only lets users with role, or a more privileged one, through. It must run
+// after AuthMiddleware.
+func RequireRole(role string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := r.Context().Value(services.UserContextKey).(*models.User)
+			if !ok {
+				respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+				return
+			}
+			if !user.HasRole(role) {
+				respondWithError(w, http.StatusForbidden, "You do not have permission to do this")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireVerifiedEmail only lets users who have verified their email address through.
+// It must run after AuthMiddleware.
+func RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(services.UserContextKey).(*models.User)
+		if !ok {
+			respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+			return
+		}
+		if !user.EmailVerified {
+			respondWithError(w, http.StatusForbidden, "Please verify your email address first")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
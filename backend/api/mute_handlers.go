@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"social-network/database/models"
+	"social-network/services"
+
+	"github.com/gorilla/mux"
+)
+
+// ListMutesHandler returns the users and keywords the current user has muted.
+func (h *UserHandler) ListMutesHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	muted, err := models.ListMutedUsers(actor.ID)
+	if err != nil {
+		log.Printf("Error listing muted users of %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list muted users")
+		return
+	}
+	keywords, err := models.ListMutedKeywords(actor.ID)
+	if err != nil {
+		log.Printf("Error listing muted keywords of %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list muted keywords")
+		return
+	}
+
+	users := make([]map[string]interface{}, 0, len(muted))
+	for _, m := range muted {
+		u, err := models.GetUserByID(m.UserID)
+		if err != nil || u == nil {
+			continue
+		}
+		entry := serializeUser(u, actor)
+		entry["mutedAt"] = m.MutedAt
+		users = append(users, entry)
+	}
+	words := make([]map[string]interface{}, 0, len(keywords))
+	for _, k := range keywords {
+		words = append(words, map[string]interface{}{"keyword": k.Keyword, "mutedAt": k.MutedAt})
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"users": users, "keywords": words})
+}
+
+// MuteUserHandler hides the posts of the user in the path from the current user's feed.
+func (h *UserHandler) MuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	targetUserID := mux.Vars(r)["userId"]
+	if targetUserID == "" || targetUserID == actor.ID {
+		respondWithError(w, http.StatusBadRequest, "Invalid target user")
+		return
+	}
+	target, err := models.GetUserByID(targetUserID)
+	if err != nil || target == nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if err := models.MuteUser(actor.ID, target.ID); err != nil {
+		log.Printf("Error muting user %s for %s: %v", target.ID, actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to mute user")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "User muted."})
+}
+
+// UnmuteUserHandler shows the posts of the user in the path in the current user's feed again.
+func (h *UserHandler) UnmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	targetUserID := mux.Vars(r)["userId"]
+	if targetUserID == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid target user")
+		return
+	}
+
+	if err := models.UnmuteUser(actor.ID, targetUserID); err != nil {
+		log.Printf("Error unmuting user %s for %s: %v", targetUserID, actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to unmute user")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "User unmuted."})
+}
+
+// MuteKeywordHandler mutes a keyword or hashtag for the current user.
+func (h *UserHandler) MuteKeywordHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Keyword string `json:"keyword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	keyword, err := models.AddMutedKeyword(actor.ID, req.Keyword)
+	if errors.Is(err, models.ErrInvalidKeyword) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error muting keyword for %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to mute keyword")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"keyword": keyword})
+}
+
+// UnmuteKeywordHandler unmutes the keyword in the path for the current user.
+func (h *UserHandler) UnmuteKeywordHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	err := models.RemoveMutedKeyword(actor.ID, mux.Vars(r)["keyword"])
+	if errors.Is(err, models.ErrInvalidKeyword) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error unmuting keyword for %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to unmute keyword")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Keyword unmuted."})
+}
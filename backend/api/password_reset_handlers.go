@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"social-network/database/models"
+	"social-network/services"
+	"social-network/websocket"
+)
+
+// PasswordResetHandlers lets users who forgot their password set a new one through a
+// link sent to their email address.
+type PasswordResetHandlers struct {
+	hub    *websocket.Hub
+	resets *services.PasswordResetter
+}
+
+// NewPasswordResetHandlers creates a new PasswordResetHandlers.
+func NewPasswordResetHandlers(hub *websocket.Hub, resets *services.PasswordResetter) *PasswordResetHandlers {
+	return &PasswordResetHandlers{hub: hub, resets: resets}
+}
+
+// RequestResetHandler emails a reset link to the given address. It answers the same way
+// whether or not an account uses the address.
+func (h *PasswordResetHandlers) RequestResetHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		respondWithError(w, http.StatusBadRequest, "Email is required")
+		return
+	}
+
+	// The email is sent in the background and the request is audited either way, so the
+	// response takes about as long whether or not the account exists.
+	userID, err := h.resets.Request(req.Email)
+	if err != nil {
+		log.Printf("Error looking up account for password reset: %v", err)
+	}
+	recordAudit(r, &models.AuditEntry{Action: models.AuditPasswordResetRequested, SubjectUserID: userID})
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message": "If an account uses this address, we've sent it a link to reset the password.",
+	})
+}
+
+// ConfirmResetHandler sets a new password using the token from a reset link, then signs
+// the user out everywhere and drops their live connections.
+func (h *PasswordResetHandlers) ConfirmResetHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	userID, err := h.resets.Confirm(req.Token, req.Password)
+	switch {
+	case errors.Is(err, services.ErrPasswordTooShort):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, models.ErrInvalidResetToken):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		log.Printf("Error resetting password: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	go h.hub.DisconnectUser(userID)
+	recordAudit(r, &models.AuditEntry{
+		ActorID:       userID,
+		Action:        models.AuditPasswordChanged,
+		SubjectUserID: userID,
+		Details:       map[string]interface{}{"method": "reset"},
+	})
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Your password has been reset. Please log in with your new password."})
+}
@@ -3,12 +3,15 @@ package api
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"social-network/database"
 	"social-network/database/models"
+	"social-network/services"
 
 	"github.com/gorilla/mux"
 )
@@ -19,7 +22,9 @@ type LikeRequest struct {
 }
 
 // PostHandlers holds dependencies for post-related handlers.
-type PostHandlers struct{}
+type PostHandlers struct {
+	images *services.ImageService
+}
 
 func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, map[string]string{"error": message})
@@ -32,17 +37,18 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 }
 
 // NewPostHandlers creates a new PostHandlers.
-func NewPostHandlers() *PostHandlers {
-	return &PostHandlers{}
+func NewPostHandlers(images *services.ImageService) *PostHandlers {
+	return &PostHandlers{images: images}
 }
 
 // LikePostHandler handles liking, disliking, or removing a vote from a post.
 func (h *PostHandlers) LikePostHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("userID").(string)
+	user, ok := r.Context().Value(services.UserContextKey).(*models.User)
 	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
+	userID := user.ID
 
 	vars := mux.Vars(r)
 	postID, err := strconv.Atoi(vars["postID"])
@@ -82,11 +88,12 @@ func (h *PostHandlers) LikePostHandler(w http.ResponseWriter, r *http.Request) {
 
 // LikeCommentHandler handles liking, disliking, or removing a vote from a comment.
 func (h *PostHandlers) LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("userID").(string)
+	user, ok := r.Context().Value(services.UserContextKey).(*models.User)
 	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
+	userID := user.ID
 
 	vars := mux.Vars(r)
 	commentID, err := strconv.Atoi(vars["commentID"])
@@ -155,10 +162,10 @@ func SetCommentLike(userID string, commentID, likeType int) error {
 func GetFeedForUser(userID string) ([]models.PostWithAuthor, error) {
 	// This query is now more complex. It uses subqueries to calculate
 	// like/dislike counts for each post and to check the current user's reaction.
-	const query = `
+	query := `
 		SELECT
-			p.id, p.user_id, p.content, p.image_url, p.privacy, p.created_at,
-			u.first_name, u.last_name, u.nickname, u.avatar_url,
+			p.id, p.user_id, p.content, COALESCE(p.image_url, ''), p.privacy, p.created_at,
+			u.first_name, u.last_name, COALESCE(u.nickname, ''), COALESCE(u.avatar_path, ''),
 			-- Subquery for like count
 			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.like_type = 1) AS like_count,
 			-- Subquery for dislike count
@@ -170,16 +177,24 @@ func GetFeedForUser(userID string) ([]models.PostWithAuthor, error) {
 		JOIN
 			users u ON p.user_id = u.id
 		WHERE
-			p.privacy = 'public'
-			OR p.user_id = ?
-			OR (p.privacy = 'almost_private' AND p.user_id IN (SELECT followed_id FROM followers WHERE follower_id = ?))
-			OR (p.privacy = 'private' AND EXISTS (SELECT 1 FROM post_allowed_users pau WHERE pau.post_id = p.id AND pau.user_id = ?))
+			-- Posts of deactivated authors are hidden until they log in again.
+			(p.user_id = ? OR ` + models.ActiveUserCondition + `)
+			-- So are the posts of anyone the user blocked or was blocked by.
+			AND ` + models.NotBlockedCondition("p.user_id") + `
+			-- Posts by muted users or with muted keywords stay hidden, except the user's own.
+			AND (p.user_id = ? OR ` + models.NotMutedCondition("p.user_id", "p.content") + `)
+			AND (
+				p.privacy = 'public'
+				OR p.user_id = ?
+				OR (p.privacy = 'almost_private' AND p.user_id IN (SELECT following_id FROM followers WHERE follower_id = ?))
+				OR (p.privacy = 'private' AND EXISTS (SELECT 1 FROM post_allowed_users pau WHERE pau.post_id = p.id AND pau.user_id = ?))
+			)
 		ORDER BY
 			p.created_at DESC
 		LIMIT 50;
 	`
 
-	rows, err := database.DB.Query(query, userID, userID, userID, userID, userID)
+	rows, err := database.DB.Query(query, userID, userID, userID, userID, userID, userID, userID, userID, userID, userID)
 	if err != nil {
 		log.Printf("Error querying user feed: %v", err)
 		return nil, err
@@ -197,24 +212,115 @@ func GetFeedForUser(userID string) ([]models.PostWithAuthor, error) {
 			log.Printf("Error scanning feed post: %v", err)
 			continue
 		}
+		setPostImageVariants(&p.Post)
 		posts = append(posts, p)
 	}
 	return posts, rows.Err()
 }
 
+// GetPostsForProfile retrieves one author's posts that the viewer is allowed to see,
+// newest first. limit and offset page through the author's timeline.
+func GetPostsForProfile(viewerID, authorID string, limit, offset int) ([]models.PostWithAuthor, error) {
+	// Same visibility rules as GetFeedForUser, restricted to a single author.
+	query := `
+		SELECT
+			p.id, p.user_id, p.content, COALESCE(p.image_url, ''), p.privacy, p.created_at,
+			u.first_name, u.last_name, COALESCE(u.nickname, ''), COALESCE(u.avatar_path, ''),
+			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.like_type = 1) AS like_count,
+			(SELECT COUNT(*) FROM post_likes pl WHERE pl.post_id = p.id AND pl.like_type = -1) AS dislike_count,
+			COALESCE((SELECT pl.like_type FROM post_likes pl WHERE pl.post_id = p.id AND pl.user_id = ?), 0) AS current_user_like_type
+		FROM
+			posts p
+		JOIN
+			users u ON p.user_id = u.id
+		WHERE
+			p.user_id = ?
+			AND (p.user_id = ? OR ` + models.ActiveUserCondition + `)
+			AND ` + models.NotBlockedCondition("p.user_id") + `
+			AND (
+				p.privacy = 'public'
+				OR p.user_id = ?
+				OR (p.privacy = 'almost_private' AND EXISTS (SELECT 1 FROM followers f WHERE f.follower_id = ? AND f.following_id = p.user_id))
+				OR (p.privacy = 'private' AND EXISTS (SELECT 1 FROM post_allowed_users pau WHERE pau.post_id = p.id AND pau.user_id = ?))
+			)
+		ORDER BY
+			p.created_at DESC, p.id DESC
+		LIMIT ? OFFSET ?;
+	`
+
+	rows, err := database.DB.Query(query, viewerID, authorID, viewerID, viewerID, viewerID, viewerID, viewerID, viewerID, limit, offset)
+	if err != nil {
+		log.Printf("Error querying profile posts: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []models.PostWithAuthor{}
+	for rows.Next() {
+		var p models.PostWithAuthor
+		if err := rows.Scan(
+			&p.ID, &p.UserID, &p.Content, &p.ImageURL, &p.Privacy, &p.CreatedAt,
+			&p.AuthorFirstName, &p.AuthorLastName, &p.AuthorNickname, &p.AuthorAvatarURL,
+			&p.LikeCount, &p.DislikeCount, &p.CurrentUserLikeType,
+		); err != nil {
+			log.Printf("Error scanning profile post: %v", err)
+			continue
+		}
+		setPostImageVariants(&p.Post)
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+// setPostImageVariants fills in the thumbnail and medium paths derived from the post's image.
+// Feeds show the static variants; the original (possibly animated) file is for detail views.
+func setPostImageVariants(p *models.Post) {
+	p.ImageThumbnail = services.VariantPath(p.ImageURL, services.ThumbnailVariant)
+	p.ImageMedium = services.VariantPath(p.ImageURL, services.MediumVariant)
+	p.ImageAnimated = services.IsAnimated(p.ImageURL)
+}
+
+// parsePagination reads the limit and offset query parameters, falling back to
+// defaultLimit and clamping the limit to maxLimit.
+func parsePagination(r *http.Request, defaultLimit, maxLimit int) (int, int) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// CreatePostHandler creates a post. It accepts either a JSON body or a multipart form
+// with the same fields plus an optional "image" file.
 func (h *PostHandlers) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("userID").(string)
+	user, ok := r.Context().Value(services.UserContextKey).(*models.User)
 	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
+	userID := user.ID
 	var req struct {
-		Content      string `json:"content"`
-		ImageURL     string `json:"image_url"`
-		Privacy      string `json:"privacy"`
-		AllowedUsers []int  `json:"allowed_users"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Content      string   `json:"content"`
+		Privacy      string   `json:"privacy"`
+		AllowedUsers []string `json:"allowed_users"`
+	}
+	var imagePath string
+	if isMultipartRequest(r) {
+		if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Could not parse multipart form")
+			return
+		}
+		req.Content = r.FormValue("content")
+		req.Privacy = r.FormValue("privacy")
+		req.AllowedUsers = splitFormList(r.MultipartForm.Value["allowed_users"])
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
@@ -230,14 +336,23 @@ func (h *PostHandlers) CreatePostHandler(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusBadRequest, "Private posts must specify at least one allowed user")
 		return
 	}
+	if isMultipartRequest(r) {
+		path, status, err := h.saveFormImage(r, "image")
+		if err != nil {
+			respondWithError(w, status, err.Error())
+			return
+		}
+		imagePath = path
+	}
 	post := models.Post{
 		UserID:   userID,
 		Content:  req.Content,
-		ImageURL: req.ImageURL,
+		ImageURL: imagePath,
 		Privacy:  req.Privacy,
 	}
 	postID, err := CreatePost(post)
 	if err != nil {
+		h.images.ReleaseImage(imagePath)
 		respondWithError(w, http.StatusInternalServerError, "Failed to create post")
 		return
 	}
@@ -248,15 +363,17 @@ func (h *PostHandlers) CreatePostHandler(w http.ResponseWriter, r *http.Request)
 		}
 	}
 	post.ID = postID
+	setPostImageVariants(&post)
 	respondWithJSON(w, http.StatusCreated, post)
 }
 
 func (h *PostHandlers) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("userID").(string)
+	user, ok := r.Context().Value(services.UserContextKey).(*models.User)
 	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
+	userID := user.ID
 	vars := mux.Vars(r)
 	postID, err := strconv.Atoi(vars["postID"])
 	if err != nil {
@@ -269,10 +386,16 @@ func (h *PostHandlers) CreateCommentHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 	var req struct {
-		Content  string `json:"content"`
-		ImageURL string `json:"image_url"`
+		Content string `json:"content"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	var imagePath string
+	if isMultipartRequest(r) {
+		if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Could not parse multipart form")
+			return
+		}
+		req.Content = r.FormValue("content")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
@@ -280,26 +403,39 @@ func (h *PostHandlers) CreateCommentHandler(w http.ResponseWriter, r *http.Reque
 		respondWithError(w, http.StatusBadRequest, "Comment content cannot be empty")
 		return
 	}
+	if isMultipartRequest(r) {
+		path, status, err := h.saveFormImage(r, "image")
+		if err != nil {
+			respondWithError(w, status, err.Error())
+			return
+		}
+		imagePath = path
+	}
 	comment := models.Comment{
 		PostID:   postID,
 		UserID:   userID,
 		Content:  req.Content,
-		ImageURL: req.ImageURL,
+		ImageURL: imagePath,
 	}
 	newComment, err := CreateComment(comment)
 	if err != nil {
+		h.images.ReleaseImage(imagePath)
 		respondWithError(w, http.StatusInternalServerError, "Failed to add comment")
 		return
 	}
+	newComment.ImageThumbnail = services.VariantPath(newComment.ImageURL, services.ThumbnailVariant)
+	newComment.ImageMedium = services.VariantPath(newComment.ImageURL, services.MediumVariant)
+	newComment.ImageAnimated = services.IsAnimated(newComment.ImageURL)
 	respondWithJSON(w, http.StatusCreated, newComment)
 }
 
 func (h *PostHandlers) GetFeedPostsHandler(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("userID").(string)
+	user, ok := r.Context().Value(services.UserContextKey).(*models.User)
 	if !ok {
 		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
 		return
 	}
+	userID := user.ID
 	posts, err := GetFeedForUser(userID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Could not retrieve feed")
@@ -308,6 +444,107 @@ func (h *PostHandlers) GetFeedPostsHandler(w http.ResponseWriter, r *http.Reques
 	respondWithJSON(w, http.StatusOK, posts)
 }
 
+// GetProfilePostsHandler returns a page of a user's posts filtered by what the
+// current user is allowed to see.
+func (h *PostHandlers) GetProfilePostsHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	targetUserID := mux.Vars(r)["userId"]
+	targetUser, err := models.GetUserByID(targetUserID)
+	if err != nil || targetUser == nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	// A private profile only shows its timeline to the owner and followers.
+	if !targetUser.IsPublic && actor.ID != targetUser.ID {
+		isFollower, err := models.AreFollowing(actor.ID, targetUser.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		if !isFollower {
+			respondWithError(w, http.StatusForbidden, "This profile is private.")
+			return
+		}
+	}
+
+	limit, offset := parsePagination(r, 20, 50)
+	// Fetch one extra row so we can tell the client whether another page exists.
+	posts, err := GetPostsForProfile(actor.ID, targetUser.ID, limit+1, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Could not retrieve posts")
+		return
+	}
+	hasMore := len(posts) > limit
+	if hasMore {
+		posts = posts[:limit]
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"posts":   posts,
+		"limit":   limit,
+		"offset":  offset,
+		"hasMore": hasMore,
+	})
+}
+
+// maxUploadMemory is how much of a multipart form is held in memory before spilling to disk.
+const maxUploadMemory = 10 << 20
+
+// isMultipartRequest reports whether the request body is multipart/form-data.
+func isMultipartRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data")
+}
+
+// splitFormList flattens repeated and comma-separated form values into one list.
+func splitFormList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+// saveFormImage validates and stores the optional image in the given form field.
+// It returns an empty path when no file was sent, and an HTTP status to use on error.
+func (h *PostHandlers) saveFormImage(r *http.Request, field string) (string, int, error) {
+	file, handler, err := r.FormFile(field)
+	if err == http.ErrMissingFile {
+		return "", http.StatusOK, nil
+	}
+	if err != nil {
+		return "", http.StatusBadRequest, errors.New("could not read image file")
+	}
+	defer file.Close()
+
+	contentType, err := h.images.ValidateImage(file, handler)
+	if err != nil {
+		if err == services.ErrImageTooLarge || err == services.ErrUnsupportedImageType {
+			return "", http.StatusBadRequest, err
+		}
+		return "", http.StatusInternalServerError, errors.New("could not read image file")
+	}
+
+	path, err := h.images.SaveImage(file, contentType)
+	if services.IsImageRejected(err) {
+		return "", http.StatusBadRequest, err
+	}
+	if err != nil {
+		log.Printf("Error saving %s upload: %v", field, err)
+		return "", http.StatusInternalServerError, errors.New("failed to save image")
+	}
+	return path, http.StatusOK, nil
+}
+
 func CreatePost(post models.Post) (int, error) {
 	stmt, err := database.DB.Prepare("INSERT INTO posts (user_id, content, image_url, privacy) VALUES (?, ?, ?, ?)")
 	if err != nil {
@@ -325,7 +562,7 @@ func CreatePost(post models.Post) (int, error) {
 	return int(id), nil
 }
 
-func AddAllowedUsersForPost(postID int, allowedUsers []int) error {
+func AddAllowedUsersForPost(postID int, allowedUsers []string) error {
 	stmt, err := database.DB.Prepare("INSERT INTO post_allowed_users (post_id, user_id) VALUES (?, ?)")
 	if err != nil {
 		return err
@@ -334,7 +571,7 @@ func AddAllowedUsersForPost(postID int, allowedUsers []int) error {
 	for _, userID := range allowedUsers {
 		_, err := stmt.Exec(postID, userID)
 		if err != nil {
-			log.Printf("Could not add user %d to post %d: %v", userID, postID, err)
+			log.Printf("Could not add user %s to post %d: %v", userID, postID, err)
 		}
 	}
 	return nil
@@ -353,13 +590,16 @@ func CanUserViewPost(userID string, postID int) (bool, error) {
 	if userID == authorID {
 		return true, nil
 	}
+	// Users who blocked each other can't see or interact with each other's posts.
+	if blocked, err := models.IsBlockedEitherWay(userID, authorID); err != nil || blocked {
+		return false, err
+	}
 	switch privacy {
 	case "public":
 		return true, nil
 	case "almost_private":
-		// You need a real follower check here
 		var isFollowing bool
-		err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = ? AND status = 'accepted')", userID, authorID).Scan(&isFollowing)
+		err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND following_id = ?)", userID, authorID).Scan(&isFollowing)
 		return isFollowing, err
 	case "private":
 		var count int
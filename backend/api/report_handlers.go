@@ -0,0 +1,326 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"social-network/database"
+	"social-network/database/models"
+	"social-network/services"
+	"social-network/websocket"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxReportDetailsLength = 1000
+	defaultSuspensionDays  = 7
+	maxSuspensionDays      = 365
+)
+
+// What a moderator can do with a report, and the resolution each action records.
+var moderationActions = map[string]string{
+	"dismiss":        models.ResolutionDismissed,
+	"remove_content": models.ResolutionContentRemoved,
+	"suspend_user":   models.ResolutionUserSuspended,
+}
+
+// What the reporter is told once their report has been handled.
+var resolutionMessages = map[string]string{
+	models.ResolutionDismissed:      "We reviewed your report and didn't find anything that breaks our rules.",
+	models.ResolutionContentRemoved: "Thanks for your report. We removed the content you reported.",
+	models.ResolutionUserSuspended:  "Thanks for your report. We suspended the account you reported.",
+}
+
+// ReportHandlers lets users report content and moderators work through the reports.
+type ReportHandlers struct {
+	hub    *websocket.Hub
+	images *services.ImageService
+}
+
+// NewReportHandlers creates a new ReportHandlers.
+func NewReportHandlers(hub *websocket.Hub, images *services.ImageService) *ReportHandlers {
+	return &ReportHandlers{hub: hub, images: images}
+}
+
+// CreateReportHandler files a report about a post, comment, chat message or profile the
+// current user can see.
+func (h *ReportHandlers) CreateReportHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		TargetType string `json:"targetType"`
+		TargetID   string `json:"targetId"`
+		Reason     string `json:"reason"`
+		Details    string `json:"details"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !models.IsValidReportTarget(req.TargetType) || req.TargetID == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid report target")
+		return
+	}
+	if !models.IsValidReportReason(req.Reason) {
+		respondWithError(w, http.StatusBadRequest, "Invalid report reason")
+		return
+	}
+	if len(req.Details) > maxReportDetailsLength {
+		respondWithError(w, http.StatusBadRequest, "Report details are too long")
+		return
+	}
+
+	owner, err := models.GetReportTargetOwner(req.TargetType, req.TargetID)
+	if err != nil {
+		log.Printf("Error looking up report target %s %s: %v", req.TargetType, req.TargetID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file report")
+		return
+	}
+	if owner == actor.ID {
+		respondWithError(w, http.StatusBadRequest, "You cannot report yourself")
+		return
+	}
+	visible, err := canReport(actor.ID, req.TargetType, req.TargetID)
+	if err != nil {
+		log.Printf("Error checking access to report target %s %s: %v", req.TargetType, req.TargetID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file report")
+		return
+	}
+	// Group messages of deleted accounts have no sender but can still be reported.
+	if !visible || (owner == "" && req.TargetType != models.ReportTargetMessage) {
+		respondWithError(w, http.StatusNotFound, "Reported content not found")
+		return
+	}
+
+	report := &models.Report{
+		ReporterID:   actor.ID,
+		TargetType:   req.TargetType,
+		TargetID:     req.TargetID,
+		TargetUserID: owner,
+		Reason:       req.Reason,
+		Details:      req.Details,
+	}
+	if err := models.CreateReport(report); errors.Is(err, models.ErrDuplicateReport) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		log.Printf("Error filing report for %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to file report")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, report)
+}
+
+// canReport reports whether userID can see the target of a report.
+func canReport(userID, targetType, targetID string) (bool, error) {
+	switch targetType {
+	case models.ReportTargetPost:
+		postID, err := strconv.Atoi(targetID)
+		if err != nil {
+			return false, nil
+		}
+		return CanUserViewPost(userID, postID)
+	case models.ReportTargetComment:
+		var postID int
+		err := database.DB.QueryRow("SELECT post_id FROM comments WHERE id = ?", targetID).Scan(&postID)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return CanUserViewPost(userID, postID)
+	case models.ReportTargetMessage:
+		return models.CanUserSeeMessage(userID, targetID)
+	default:
+		return true, nil
+	}
+}
+
+// ListReportsHandler returns the moderation queue. The status query parameter picks
+// open, in_review or resolved reports; without it every unresolved report is listed.
+func (h *ReportHandlers) ListReportsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != models.ReportOpen && status != models.ReportInReview && status != models.ReportResolved {
+		respondWithError(w, http.StatusBadRequest, "Invalid status")
+		return
+	}
+	limit, offset := parsePagination(r, 50, 200)
+
+	reports, err := models.ListReports(status, limit, offset)
+	if err != nil {
+		log.Printf("Error listing reports: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to list reports")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"reports": reports})
+}
+
+// GetReportHandler returns a single report.
+func (h *ReportHandlers) GetReportHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := models.GetReport(mux.Vars(r)["reportId"])
+	if err != nil {
+		log.Printf("Error loading report: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to load report")
+		return
+	}
+	if report == nil {
+		respondWithError(w, http.StatusNotFound, "Report not found")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// TriageReportHandler assigns a report to the current moderator and marks it as in review.
+func (h *ReportHandlers) TriageReportHandler(w http.ResponseWriter, r *http.Request) {
+	moderator, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	report, err := models.GetReport(mux.Vars(r)["reportId"])
+	if err != nil {
+		log.Printf("Error loading report: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to load report")
+		return
+	}
+	if report == nil {
+		respondWithError(w, http.StatusNotFound, "Report not found")
+		return
+	}
+
+	if err := models.TriageReport(report.ID, moderator.ID); errors.Is(err, models.ErrReportResolved) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		log.Printf("Error triaging report %s: %v", report.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update report")
+		return
+	}
+	report.Status, report.ModeratorID = models.ReportInReview, moderator.ID
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// ResolveReportHandler carries out a moderator's decision on a report: dismiss it,
+// remove the reported content, or suspend the reported user. Every reporter whose
+// report is closed by the decision is notified of the outcome.
+func (h *ReportHandlers) ResolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	moderator, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Action      string `json:"action"`
+		Note        string `json:"note"`
+		SuspendDays int    `json:"suspendDays"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	resolution, ok := moderationActions[req.Action]
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Action must be dismiss, remove_content or suspend_user")
+		return
+	}
+
+	report, err := models.GetReport(mux.Vars(r)["reportId"])
+	if err != nil {
+		log.Printf("Error loading report: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to load report")
+		return
+	}
+	if report == nil {
+		respondWithError(w, http.StatusNotFound, "Report not found")
+		return
+	}
+	if report.Status == models.ReportResolved {
+		respondWithError(w, http.StatusConflict, models.ErrReportResolved.Error())
+		return
+	}
+
+	now := time.Now()
+	switch resolution {
+	case models.ResolutionContentRemoved:
+		if report.TargetType == models.ReportTargetUser {
+			respondWithError(w, http.StatusBadRequest, "A profile cannot be removed; suspend the user instead")
+			return
+		}
+		// The content may already be gone, removed by its author or another moderator.
+		if _, err := services.RemoveContent(h.images, report.TargetType, report.TargetID); err != nil {
+			log.Printf("Error removing %s %s for report %s: %v", report.TargetType, report.TargetID, report.ID, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to remove content")
+			return
+		}
+	case models.ResolutionUserSuspended:
+		if report.TargetUserID == "" {
+			respondWithError(w, http.StatusBadRequest, "The reported user no longer exists")
+			return
+		}
+		days := req.SuspendDays
+		if days == 0 {
+			days = defaultSuspensionDays
+		}
+		if days < 0 || days > maxSuspensionDays {
+			respondWithError(w, http.StatusBadRequest, "Suspensions last between 1 and 365 days")
+			return
+		}
+		target, err := models.GetUserByID(report.TargetUserID)
+		if err != nil || target == nil {
+			respondWithError(w, http.StatusBadRequest, "The reported user no longer exists")
+			return
+		}
+		if target.HasRole(models.RoleModerator) {
+			respondWithError(w, http.StatusForbidden, "Staff accounts can only be suspended by changing their role first")
+			return
+		}
+		reason := req.Note
+		if reason == "" {
+			reason = "Reported for " + report.Reason
+		}
+		if err := models.SuspendAccount(report.TargetUserID, now.AddDate(0, 0, days), reason); err != nil {
+			log.Printf("Error suspending user %s for report %s: %v", report.TargetUserID, report.ID, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to suspend user")
+			return
+		}
+		go h.hub.DisconnectUser(target.ID)
+	}
+
+	closed, err := models.ResolveReport(report.ID, moderator.ID, resolution, req.Note, now)
+	if errors.Is(err, models.ErrReportResolved) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error resolving report %s: %v", report.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to resolve report")
+		return
+	}
+
+	recordAudit(r, &models.AuditEntry{
+		ActorID:       moderator.ID,
+		Action:        models.AuditModerationResolve,
+		SubjectUserID: report.TargetUserID,
+		TargetType:    report.TargetType,
+		TargetID:      report.TargetID,
+		Details:       map[string]interface{}{"report": report.ID, "resolution": resolution, "closedReports": len(closed)},
+	})
+	for _, c := range closed {
+		go h.hub.SendNotification(c.ReporterID, "", "report_resolved", resolutionMessages[resolution])
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"resolved": closed})
+}
@@ -3,17 +3,24 @@ package api
 import (
 	"net/http"
 
+	"social-network/database/models"
+	"social-network/services"
 	"social-network/websocket"
 
 	"github.com/gorilla/mux"
 )
 
 // SetupRouter configures all the API routes for the application.
-func SetupRouter(hub *websocket.Hub) http.Handler {
+func SetupRouter(hub *websocket.Hub, imageService *services.ImageService, exporter *services.DataExporter, resets *services.PasswordResetter, verifier *services.EmailVerifier, twoFactor *services.TwoFactor) http.Handler {
 	// Instantiate all handler groups
-	userHandlers := NewUserHandlers(hub)
-	postHandlers := NewPostHandlers()
-	chatHandlers := NewChatHandlers(hub)
+	userHandlers := NewUserHandlers(hub, imageService, verifier, twoFactor)
+	postHandlers := NewPostHandlers(imageService)
+	chatHandlers := NewChatHandlers(hub, imageService)
+	mediaHandlers := NewMediaHandlers(imageService)
+	exportHandlers := NewExportHandlers(exporter)
+	reportHandlers := NewReportHandlers(hub, imageService)
+	adminHandlers := NewAdminHandlers(hub, imageService)
+	passwordResetHandlers := NewPasswordResetHandlers(hub, resets)
 
 	// Create the main router
 	router := mux.NewRouter()
@@ -27,7 +34,11 @@ func SetupRouter(hub *websocket.Hub) http.Handler {
 	// These routes do not need authentication but will still have CORS headers.
 	apiRouter.HandleFunc("/register", userHandlers.RegisterHandler).Methods("POST", "OPTIONS")
 	apiRouter.HandleFunc("/login", userHandlers.LoginHandler).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/login/2fa", userHandlers.TwoFactorLoginHandler).Methods("POST", "OPTIONS")
 	apiRouter.HandleFunc("/logout", userHandlers.LogoutHandler).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/password-reset/request", passwordResetHandlers.RequestResetHandler).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/password-reset/confirm", passwordResetHandlers.ConfirmResetHandler).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/verify-email", userHandlers.VerifyEmailHandler).Methods("POST", "OPTIONS")
 
 	// --- WebSocket Route ---
 	apiRouter.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
@@ -43,6 +54,18 @@ func SetupRouter(hub *websocket.Hub) http.Handler {
 	// --- Attach all protected handlers to the `auth` sub-router ---
 	// User & Follower Routes
 	auth.HandleFunc("/me", userHandlers.CurrentUserHandler).Methods("GET", "OPTIONS")
+	auth.HandleFunc("/me", userHandlers.DeleteAccountHandler).Methods("DELETE")
+	auth.HandleFunc("/me/deactivate", userHandlers.DeactivateAccountHandler).Methods("POST", "OPTIONS")
+	auth.HandleFunc("/me/password", userHandlers.ChangePasswordHandler).Methods("PUT", "OPTIONS")
+	auth.HandleFunc("/me/email", userHandlers.ChangeEmailHandler).Methods("PUT", "OPTIONS")
+	auth.HandleFunc("/me/verify-email/resend", userHandlers.ResendVerificationHandler).Methods("POST", "OPTIONS")
+	auth.HandleFunc("/me/2fa/enroll", userHandlers.EnrollTwoFactorHandler).Methods("POST", "OPTIONS")
+	auth.HandleFunc("/me/2fa/confirm", userHandlers.ConfirmTwoFactorHandler).Methods("POST", "OPTIONS")
+	auth.HandleFunc("/me/2fa/disable", userHandlers.DisableTwoFactorHandler).Methods("POST", "OPTIONS")
+	auth.HandleFunc("/me/activity", userHandlers.AccountActivityHandler).Methods("GET", "OPTIONS")
+	auth.HandleFunc("/me/sessions", userHandlers.ListSessionsHandler).Methods("GET", "OPTIONS")
+	auth.HandleFunc("/me/sessions/revoke-others", userHandlers.RevokeOtherSessionsHandler).Methods("POST", "OPTIONS")
+	auth.HandleFunc("/me/sessions/{sessionId}", userHandlers.RevokeSessionHandler).Methods("DELETE", "OPTIONS")
 	auth.HandleFunc("/users", userHandlers.GetAllUsersHandler).Methods("GET", "OPTIONS")
 	auth.HandleFunc("/follow/{userId}", userHandlers.FollowRequestHandler).Methods("POST", "OPTIONS")
 	auth.HandleFunc("/my-follow-requests", userHandlers.GetMyFollowRequestsHandler).Methods("GET", "OPTIONS")
@@ -54,6 +77,14 @@ func SetupRouter(hub *websocket.Hub) http.Handler {
 	auth.HandleFunc("/followers/{userId}", userHandlers.ListFollowersHandler).Methods("GET", "OPTIONS")
 	auth.HandleFunc("/following/{userId}", userHandlers.ListFollowingHandler).Methods("GET", "OPTIONS")
 	auth.HandleFunc("/follow-status/{userId}", userHandlers.CheckFollowRequestStatusHandler).Methods("GET", "OPTIONS")
+	auth.HandleFunc("/block/{userId}", userHandlers.BlockUserHandler).Methods("POST", "OPTIONS")
+	auth.HandleFunc("/unblock/{userId}", userHandlers.UnblockUserHandler).Methods("POST", "OPTIONS")
+	auth.HandleFunc("/blocks", userHandlers.ListBlockedUsersHandler).Methods("GET", "OPTIONS")
+	auth.HandleFunc("/mute/{userId}", userHandlers.MuteUserHandler).Methods("POST", "OPTIONS")
+	auth.HandleFunc("/unmute/{userId}", userHandlers.UnmuteUserHandler).Methods("POST", "OPTIONS")
+	auth.HandleFunc("/mutes", userHandlers.ListMutesHandler).Methods("GET", "OPTIONS")
+	auth.HandleFunc("/mutes/keywords", userHandlers.MuteKeywordHandler).Methods("POST", "OPTIONS")
+	auth.HandleFunc("/mutes/keywords/{keyword}", userHandlers.UnmuteKeywordHandler).Methods("DELETE", "OPTIONS")
 
 	// Notification Routes
 	auth.HandleFunc("/notifications", userHandlers.GetNotificationsHandler).Methods("GET", "OPTIONS")
@@ -61,24 +92,54 @@ func SetupRouter(hub *websocket.Hub) http.Handler {
 
 	// Profile Routes
 	auth.HandleFunc("/profile/{userId}", userHandlers.GetProfileHandler).Methods("GET", "OPTIONS")
+	auth.HandleFunc("/profile/{userId}/posts", postHandlers.GetProfilePostsHandler).Methods("GET", "OPTIONS")
 	auth.HandleFunc("/profile", userHandlers.UpdateProfileHandler).Methods("PUT", "OPTIONS")
 	auth.HandleFunc("/profile/avatar", userHandlers.UploadAvatarHandler).Methods("POST", "OPTIONS")
+	auth.HandleFunc("/profile/cover", userHandlers.UploadCoverHandler).Methods("POST", "OPTIONS")
 	auth.HandleFunc("/profile/toggle-privacy", userHandlers.ToggleProfilePrivacyHandler).Methods("POST", "OPTIONS")
 
 	// Post & Feed Routes
-	auth.HandleFunc("/posts", postHandlers.CreatePostHandler).Methods("POST")
+	// Posting and messaging need a verified email address.
+	auth.Handle("/posts", RequireVerifiedEmail(http.HandlerFunc(postHandlers.CreatePostHandler))).Methods("POST")
 	auth.HandleFunc("/posts/feed", postHandlers.GetFeedPostsHandler).Methods("GET")
-	auth.HandleFunc("/posts/{postID}/comment", postHandlers.CreateCommentHandler).Methods("POST")
+	auth.Handle("/posts/{postID}/comment", RequireVerifiedEmail(http.HandlerFunc(postHandlers.CreateCommentHandler))).Methods("POST")
 	auth.HandleFunc("/posts/{postID}/like", postHandlers.LikePostHandler).Methods("POST")
 	auth.HandleFunc("/comments/{commentID}/like", postHandlers.LikeCommentHandler).Methods("POST")
 
+	// Personal Data Export Routes
+	auth.HandleFunc("/exports", exportHandlers.RequestExportHandler).Methods("POST", "OPTIONS")
+	auth.HandleFunc("/exports", exportHandlers.ListExportsHandler).Methods("GET", "OPTIONS")
+	auth.HandleFunc("/exports/{exportId}/download", exportHandlers.DownloadExportHandler).Methods("GET", "OPTIONS")
+
+	// Reports & Moderation Routes
+	auth.HandleFunc("/reports", reportHandlers.CreateReportHandler).Methods("POST", "OPTIONS")
+	moderation := auth.PathPrefix("/moderation").Subrouter()
+	moderation.Use(RequireRole(models.RoleModerator))
+	moderation.HandleFunc("/reports", reportHandlers.ListReportsHandler).Methods("GET", "OPTIONS")
+	moderation.HandleFunc("/reports/{reportId}", reportHandlers.GetReportHandler).Methods("GET", "OPTIONS")
+	moderation.HandleFunc("/reports/{reportId}/triage", reportHandlers.TriageReportHandler).Methods("POST", "OPTIONS")
+	moderation.HandleFunc("/reports/{reportId}/resolve", reportHandlers.ResolveReportHandler).Methods("POST", "OPTIONS")
+
+	// Admin Routes
+	admin := auth.PathPrefix("/admin").Subrouter()
+	admin.Use(RequireRole(models.RoleAdmin))
+	admin.HandleFunc("/users/{userId}/suspend", adminHandlers.SuspendUserHandler).Methods("POST", "OPTIONS")
+	admin.HandleFunc("/users/{userId}/unsuspend", adminHandlers.UnsuspendUserHandler).Methods("POST", "OPTIONS")
+	admin.HandleFunc("/users/{userId}/logout", adminHandlers.RevokeSessionsHandler).Methods("POST", "OPTIONS")
+	admin.HandleFunc("/users/{userId}/role", adminHandlers.SetRoleHandler).Methods("PUT", "OPTIONS")
+	admin.HandleFunc("/users/{userId}/audit-log", adminHandlers.AuditLogHandler).Methods("GET", "OPTIONS")
+	admin.HandleFunc("/content/{targetType}/{targetId}", adminHandlers.RemoveContentHandler).Methods("DELETE", "OPTIONS")
+
+	// Media Routes
+	auth.HandleFunc("/media/{path:.+}", mediaHandlers.ServeMediaHandler).Methods("GET", "OPTIONS")
+
 	// Chat Routes
 	auth.HandleFunc("/chats/conversations", chatHandlers.GetConversationsHandler).Methods("GET", "OPTIONS")
 	auth.HandleFunc("/chats/private/{userID}", chatHandlers.GetPrivateConversationHandler).Methods("GET", "OPTIONS")
 	auth.HandleFunc("/chats/group/{groupID}", chatHandlers.GetGroupConversationHandler).Methods("GET", "OPTIONS")
 	auth.HandleFunc("/chats/can-message/{userID}", chatHandlers.CheckCanMessageHandler).Methods("GET", "OPTIONS")
 	auth.HandleFunc("/chats/search-users", chatHandlers.SearchUsersHandler).Methods("GET", "OPTIONS")
-	auth.HandleFunc("/chats/send", chatHandlers.SendMessageHandler).Methods("POST", "OPTIONS")
+	auth.Handle("/chats/send", RequireVerifiedEmail(http.HandlerFunc(chatHandlers.SendMessageHandler))).Methods("POST", "OPTIONS")
 
 	// The router with all its middleware and handlers is now complete.
 	return router
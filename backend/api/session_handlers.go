@@ -0,0 +1,111 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"social-network/database/models"
+	"social-network/services"
+
+	"github.com/gorilla/mux"
+)
+
+// sessionView is a session as shown to its owner.
+type sessionView struct {
+	*models.Session
+	Current bool `json:"current"`
+}
+
+// currentSessionToken returns the token of the session the request was made with.
+// AuthMiddleware has already checked it.
+func currentSessionToken(r *http.Request) string {
+	cookie, err := r.Cookie(services.SessionCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// ListSessionsHandler lists the current user's active sessions, marking the one the
+// request was made with.
+func (h *UserHandler) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	sessions, err := models.ListSessionsForUser(actor.ID)
+	if err != nil {
+		log.Printf("Error listing sessions of %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to load sessions")
+		return
+	}
+	current := currentSessionToken(r)
+	views := make([]sessionView, len(sessions))
+	for i, s := range sessions {
+		views[i] = sessionView{Session: s, Current: s.Token == current}
+	}
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"sessions": views})
+}
+
+// RevokeSessionHandler signs the current user out of one of their sessions and drops
+// the live connections opened with it. Revoking the current session is the same as
+// logging out.
+func (h *UserHandler) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	sessionID := mux.Vars(r)["sessionId"]
+	token, err := models.DeleteSessionByID(actor.ID, sessionID)
+	if err != nil {
+		log.Printf("Error revoking session %s of %s: %v", sessionID, actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+	if token == "" {
+		respondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	go h.hub.DisconnectSessions(actor.ID, []string{token})
+	recordAudit(r, &models.AuditEntry{
+		ActorID:       actor.ID,
+		Action:        models.AuditSessionsRevoked,
+		SubjectUserID: actor.ID,
+		Details:       map[string]interface{}{"session": sessionID},
+	})
+
+	if token == currentSessionToken(r) {
+		services.ClearSessionCookie(w, r)
+	}
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Session revoked."})
+}
+
+// RevokeOtherSessionsHandler signs the current user out of every session except the one
+// the request was made with, and drops the live connections opened with them.
+func (h *UserHandler) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	tokens, err := models.DeleteOtherSessions(actor.ID, currentSessionToken(r))
+	if err != nil {
+		log.Printf("Error revoking other sessions of %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to revoke sessions")
+		return
+	}
+	go h.hub.DisconnectSessions(actor.ID, tokens)
+	recordAudit(r, &models.AuditEntry{
+		ActorID:       actor.ID,
+		Action:        models.AuditSessionsRevoked,
+		SubjectUserID: actor.ID,
+		Details:       map[string]interface{}{"sessions": len(tokens), "allOthers": true},
+	})
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"message": "Signed out of all other sessions.", "sessions": len(tokens)})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"social-network/database/models"
+	"social-network/services"
+)
+
+// EnrollTwoFactorHandler gives the current user a new TOTP secret to add to their
+// authenticator app. 2FA stays off until they confirm a code with
+// ConfirmTwoFactorHandler; enrolling again replaces an unconfirmed secret.
+func (h *UserHandler) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	enrollment, err := h.twoFactor.BeginEnrollment(actor)
+	if errors.Is(err, models.ErrTwoFactorEnabled) {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Error starting 2FA enrollment for %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to set up two-factor authentication")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, enrollment)
+}
+
+// ConfirmTwoFactorHandler turns on 2FA for the current user once they enter a code from
+// their newly enrolled authenticator app, and returns their one-time recovery codes.
+func (h *UserHandler) ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		respondWithError(w, http.StatusBadRequest, "A code from your authenticator app is required")
+		return
+	}
+
+	codes, err := h.twoFactor.ConfirmEnrollment(actor.ID, req.Code)
+	switch {
+	case errors.Is(err, models.ErrTwoFactorEnabled):
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, models.ErrTwoFactorNotEnrolled), errors.Is(err, services.ErrInvalidTwoFactorCode):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		log.Printf("Error confirming 2FA enrollment for %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to set up two-factor authentication")
+		return
+	}
+	recordAudit(r, &models.AuditEntry{ActorID: actor.ID, Action: models.AuditTwoFactorEnabled, SubjectUserID: actor.ID})
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message":       "Two-factor authentication is on. Keep these recovery codes somewhere safe; each works once.",
+		"recoveryCodes": codes,
+	})
+}
+
+// DisableTwoFactorHandler turns off 2FA for the current user after they re-enter their
+// password, discarding their authenticator secret and recovery codes.
+func (h *UserHandler) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		respondWithError(w, http.StatusBadRequest, "Password is required to turn off two-factor authentication")
+		return
+	}
+	if !services.CheckPasswordHash(req.Password, actor.PasswordHash) {
+		respondWithError(w, http.StatusForbidden, "Incorrect password")
+		return
+	}
+	if !actor.TwoFactorEnabled {
+		respondWithError(w, http.StatusBadRequest, "Two-factor authentication is not enabled")
+		return
+	}
+
+	if err := models.DisableTOTP(actor.ID); err != nil {
+		log.Printf("Error disabling 2FA for %s: %v", actor.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to turn off two-factor authentication")
+		return
+	}
+	recordAudit(r, &models.AuditEntry{ActorID: actor.ID, Action: models.AuditTwoFactorDisabled, SubjectUserID: actor.ID})
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication is off."})
+}
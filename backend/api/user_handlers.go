@@ -2,8 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"social-network/database/models"
 	"social-network/services"
 	"github.com/gorilla/mux"
@@ -25,19 +29,32 @@ func (h *UserHandler) GetProfileHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Default: not allowed to view private profile
-	allowed := false
 	actor, actorOk := r.Context().Value(services.UserContextKey).(*models.User)
-	if targetUser.IsPublic {
-		allowed = true
-	} else if actorOk && actor.ID == targetUserID {
-		allowed = true // owner can view
-	} else if actorOk {
-		// Check if actor is a follower
-		isFollower, err := models.AreFollowing(actor.ID, targetUserID)
-		if err == nil && isFollower {
-			allowed = true
+	isOwner := actorOk && actor.ID == targetUserID
+	// A deactivated profile looks the same as one that never existed, and so does the
+	// profile of someone the viewer blocked or was blocked by.
+	if !targetUser.Active && !isOwner {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	blocked := map[string]bool{}
+	if actorOk {
+		if blocked, err = models.GetBlockedUserIDs(actor.ID); err != nil {
+			http.Error(w, "Failed to load profile", http.StatusInternalServerError)
+			return
 		}
 	}
+	if blocked[targetUserID] {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	isFollower := false
+	if actorOk && !isOwner {
+		// Check if actor is a follower
+		following, err := models.AreFollowing(actor.ID, targetUserID)
+		isFollower = err == nil && following
+	}
+	allowed := targetUser.IsPublic || isOwner || isFollower
 
 	if !allowed {
 		http.Error(w, "This profile is private.", http.StatusForbidden)
@@ -50,6 +67,9 @@ func (h *UserHandler) GetProfileHandler(w http.ResponseWriter, r *http.Request)
 		fmt.Printf("Error fetching followers for user %s: %v", targetUserID, errFollowers)
 	} else {
 		for _, id := range followerIDs {
+			if blocked[id] {
+				continue
+			}
 			user, err := models.GetUserByID(id)
 			if err == nil && user != nil {
 				followers = append(followers, user)
@@ -62,6 +82,9 @@ func (h *UserHandler) GetProfileHandler(w http.ResponseWriter, r *http.Request)
 		fmt.Printf("Error fetching following for user %s: %v", targetUserID, errFollowing)
 	} else {
 		for _, id := range followingIDs {
+			if blocked[id] {
+				continue
+			}
 			user, err := models.GetUserByID(id)
 			if err == nil && user != nil {
 				following = append(following, user)
@@ -69,38 +92,22 @@ func (h *UserHandler) GetProfileHandler(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	// Only return public info for followers/following
-	serializeUser := func(u *models.User) map[string]interface{} {
-		return map[string]interface{}{
-			"id":         u.ID,
-			"firstName":  u.FirstName,
-			"lastName":   u.LastName,
-			"nickname":   u.Nickname,
-			"avatarPath": u.AvatarPath,
-			"aboutMe":    u.AboutMe,
-			"isPublic":   u.IsPublic,
-		}
-	}
-
-	resp := map[string]interface{}{
-		"id":          targetUser.ID,
-		"firstName":   targetUser.FirstName,
-		"lastName":    targetUser.LastName,
-		"nickname":    targetUser.Nickname,
-		"email":       targetUser.Email,
-		"dateOfBirth": targetUser.DateOfBirth,
-		"avatarPath":  targetUser.AvatarPath,
-		"aboutMe":     targetUser.AboutMe,
-		"isPublic":    targetUser.IsPublic,
-		"followers":   make([]map[string]interface{}, 0),
-		"following":   make([]map[string]interface{}, 0),
-	}
+	// Email, birth date and the optional details are filtered by serializeUser.
+	viewer := actor // nil when the request is anonymous
+	resp := serializeUser(targetUser, viewer)
+	resp["avatarMedium"] = services.VariantPath(targetUser.AvatarPath, services.MediumVariant)
+	resp["coverPath"] = targetUser.CoverPath
+	resp["coverMedium"] = services.VariantPath(targetUser.CoverPath, services.MediumVariant)
+	followerViews := make([]map[string]interface{}, 0, len(followers))
 	for _, u := range followers {
-		resp["followers"] = append(resp["followers"].([]map[string]interface{}), serializeUser(u))
+		followerViews = append(followerViews, serializeUser(u, viewer))
 	}
+	followingViews := make([]map[string]interface{}, 0, len(following))
 	for _, u := range following {
-		resp["following"] = append(resp["following"].([]map[string]interface{}), serializeUser(u))
+		followingViews = append(followingViews, serializeUser(u, viewer))
 	}
+	resp["followers"] = followerViews
+	resp["following"] = followingViews
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
@@ -120,6 +127,17 @@ func (h *UserHandler) UpdateProfileHandler(w http.ResponseWriter, r *http.Reques
 		Nickname    string `json:"nickname"`
 		AboutMe     string `json:"aboutMe"`
 		IsPublic    *bool  `json:"isPublic"`
+
+		// Optional details; send "" to clear one. Visibility is "everyone", "followers" or "only_me".
+		Location           *string `json:"location"`
+		LocationVisibility string  `json:"locationVisibility"`
+		Website            *string `json:"website"`
+		WebsiteVisibility  string  `json:"websiteVisibility"`
+		Pronouns           *string `json:"pronouns"`
+		PronounsVisibility string  `json:"pronounsVisibility"`
+
+		EmailVisibility       string `json:"emailVisibility"`
+		DateOfBirthVisibility string `json:"dateOfBirthVisibility"`
 	}
 	var req UpdateProfileRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -148,6 +166,38 @@ func (h *UserHandler) UpdateProfileHandler(w http.ResponseWriter, r *http.Reques
 	if req.IsPublic != nil {
 		user.IsPublic = *req.IsPublic
 	}
+	if req.Location != nil {
+		user.Location = strings.TrimSpace(*req.Location)
+	}
+	if req.Website != nil {
+		user.Website = strings.TrimSpace(*req.Website)
+	}
+	if req.Pronouns != nil {
+		user.Pronouns = strings.TrimSpace(*req.Pronouns)
+	}
+	if err := validateProfileDetails(user); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, v := range []struct {
+		value  string
+		target *string
+	}{
+		{req.LocationVisibility, &user.LocationVisibility},
+		{req.WebsiteVisibility, &user.WebsiteVisibility},
+		{req.PronounsVisibility, &user.PronounsVisibility},
+		{req.EmailVisibility, &user.EmailVisibility},
+		{req.DateOfBirthVisibility, &user.DateOfBirthVisibility},
+	} {
+		if v.value == "" {
+			continue
+		}
+		if !models.IsValidVisibility(v.value) {
+			http.Error(w, "Visibility must be everyone, followers or only_me", http.StatusBadRequest)
+			return
+		}
+		*v.target = v.value
+	}
 
 	err = models.UpdateUserProfile(user)
 	if err != nil {
@@ -180,36 +230,139 @@ func (h *UserHandler) UploadAvatarHandler(w http.ResponseWriter, r *http.Request
 	}
 	defer file.Close()
 
-	// Only allow JPEG, PNG, GIF
-	allowedTypes := map[string]bool{"image/jpeg": true, "image/png": true, "image/gif": true}
-	if !allowedTypes[handler.Header.Get("Content-Type")] {
-		http.Error(w, "Unsupported file type", http.StatusBadRequest)
+	// Only allow JPEG, PNG, GIF, judged by the file's content rather than its headers
+	contentType, err := h.images.ValidateImage(file, handler)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Save file to disk (e.g., ./uploads/avatars/{userID}_{filename})
-	avatarPath := fmt.Sprintf("uploads/avatars/%s_%s", actor.ID, handler.Filename)
-	out, err := services.SaveUploadedFile(file, avatarPath)
+	// Re-encode and store the avatar (e.g., ./uploads/media/ab/{sha256}.jpg)
+	avatarPath, err := h.images.SaveImage(file, contentType)
+	if services.IsImageRejected(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to save avatar", http.StatusInternalServerError)
 		return
 	}
-	defer out.Close()
 
 	// Update user record
 	user, err := models.GetUserByID(actor.ID)
 	if err != nil || user == nil {
+		h.images.ReleaseImage(avatarPath)
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
+	previousAvatar := user.AvatarPath
 	user.AvatarPath = avatarPath
 	if err := models.UpdateUserProfile(user); err != nil {
+		h.images.ReleaseImage(avatarPath)
 		http.Error(w, "Failed to update avatar path", http.StatusInternalServerError)
 		return
 	}
+	// The replaced avatar is no longer referenced by this user.
+	if err := h.images.ReleaseImage(previousAvatar); err != nil {
+		log.Printf("Error releasing previous avatar %s: %v", previousAvatar, err)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Avatar uploaded successfully", "avatarPath": avatarPath})
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":         "Avatar uploaded successfully",
+		"avatarPath":      avatarPath,
+		"avatarThumbnail": services.VariantPath(avatarPath, services.ThumbnailVariant),
+	})
+}
+
+// UploadCoverHandler allows the authenticated user to upload/change their profile cover photo.
+func (h *UserHandler) UploadCoverHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := r.ParseMultipartForm(10 << 20) // 10MB max
+	if err != nil {
+		http.Error(w, "Could not parse multipart form", http.StatusBadRequest)
+		return
+	}
+
+	file, handler, err := r.FormFile("cover")
+	if err != nil {
+		http.Error(w, "Could not get cover file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	contentType, err := h.images.ValidateImage(file, handler)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	coverPath, err := h.images.SaveImage(file, contentType)
+	if services.IsImageRejected(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to save cover photo", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := models.GetUserByID(actor.ID)
+	if err != nil || user == nil {
+		h.images.ReleaseImage(coverPath)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	previousCover := user.CoverPath
+	user.CoverPath = coverPath
+	if err := models.UpdateUserProfile(user); err != nil {
+		h.images.ReleaseImage(coverPath)
+		http.Error(w, "Failed to update cover photo", http.StatusInternalServerError)
+		return
+	}
+	if err := h.images.ReleaseImage(previousCover); err != nil {
+		log.Printf("Error releasing previous cover %s: %v", previousCover, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":     "Cover photo uploaded successfully",
+		"coverPath":   coverPath,
+		"coverMedium": services.VariantPath(coverPath, services.MediumVariant),
+	})
+}
+
+// Length limits for the optional profile details.
+const (
+	maxLocationLength = 100
+	maxWebsiteLength  = 200
+	maxPronounsLength = 40
+)
+
+// validateProfileDetails checks the optional text fields of a profile.
+func validateProfileDetails(user *models.User) error {
+	if len(user.Location) > maxLocationLength {
+		return fmt.Errorf("location must be at most %d characters", maxLocationLength)
+	}
+	if len(user.Pronouns) > maxPronounsLength {
+		return fmt.Errorf("pronouns must be at most %d characters", maxPronounsLength)
+	}
+	if user.Website != "" {
+		if len(user.Website) > maxWebsiteLength {
+			return fmt.Errorf("website must be at most %d characters", maxWebsiteLength)
+		}
+		// Only plain web links, so the profile can't carry javascript: or data: URLs.
+		u, err := url.Parse(user.Website)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("website must be an http or https URL")
+		}
+	}
+	return nil
 }
 
 // GetAllUsersHandler returns a list of all users
@@ -221,27 +374,25 @@ func (h *UserHandler) GetAllUsersHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	actor, ok := r.Context().Value(services.UserContextKey).(*models.User)
+	blocked := map[string]bool{}
+	if ok {
+		if blocked, err = models.GetBlockedUserIDs(actor.ID); err != nil {
+			http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+			return
+		}
+	}
 	var filtered []map[string]interface{}
 	for _, user := range users {
-		if ok && user.ID == actor.ID {
+		if ok && user.ID == actor.ID || blocked[user.ID] {
 			continue
 		}
 		isFollowing := false
 		if ok {
 			isFollowing, _ = models.AreFollowing(actor.ID, user.ID)
 		}
-		filtered = append(filtered, map[string]interface{}{
-			"id":          user.ID,
-			"firstName":   user.FirstName,
-			"lastName":    user.LastName,
-			"nickname":    user.Nickname,
-			"email":       user.Email,
-			"dateOfBirth": user.DateOfBirth,
-			"avatarPath":  user.AvatarPath,
-			"aboutMe":     user.AboutMe,
-			"isPublic":    user.IsPublic,
-			"isFollowing": isFollowing,
-		})
+		view := serializeUser(user, actor)
+		view["isFollowing"] = isFollowing
+		filtered = append(filtered, view)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -272,18 +423,16 @@ func (h *UserHandler) GetNotificationsHandler(w http.ResponseWriter, r *http.Req
 			"read":      notif.Read,
 			"createdAt": notif.CreatedAt,
 		}
+		if notif.Link != "" {
+			notificationData["link"] = notif.Link
+		}
 
 		// Add actor details if available
 		if notif.ActorID != "" {
-			actor, err := models.GetUserByID(notif.ActorID)
-			if err == nil && actor != nil {
-				notificationData["actor"] = map[string]interface{}{
-					"id":        actor.ID,
-					"firstName": actor.FirstName,
-					"lastName":  actor.LastName,
-					"nickname":  actor.Nickname,
-					"avatarPath": actor.AvatarPath,
-				}
+			sender, err := models.GetUserByID(notif.ActorID)
+			if err == nil && sender != nil {
+				// Clients show the static thumbnail so animated avatars don't play in the list.
+				notificationData["actor"] = serializeUser(sender, actor)
 			}
 		}
 
@@ -342,6 +491,12 @@ func (h *UserHandler) ToggleProfilePrivacyHandler(w http.ResponseWriter, r *http
 		http.Error(w, "Failed to update profile privacy", http.StatusInternalServerError)
 		return
 	}
+	recordAudit(r, &models.AuditEntry{
+		ActorID:       actor.ID,
+		Action:        models.AuditPrivacyChanged,
+		SubjectUserID: actor.ID,
+		Details:       map[string]interface{}{"isPublic": newPrivacySetting},
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"social-network/database/models"
+	"social-network/services"
+)
+
+// serializeUser is the one place a user is turned into JSON for someone else to see.
+// Every endpoint that lists or embeds users (profiles, user lists, search, follower
+// lists, follow requests, notifications) goes through it, so fields with a visibility
+// setting are only ever included when that setting lets viewer see them. viewer may be
+// nil for anonymous requests.
+func serializeUser(u *models.User, viewer *models.User) map[string]interface{} {
+	isOwner := viewer != nil && viewer.ID == u.ID
+	isFollower := false
+	if viewer != nil && !isOwner && needsFollowerCheck(u) {
+		following, err := models.AreFollowing(viewer.ID, u.ID)
+		isFollower = err == nil && following
+	}
+
+	view := map[string]interface{}{
+		"id":              u.ID,
+		"firstName":       u.FirstName,
+		"lastName":        u.LastName,
+		"nickname":        u.Nickname,
+		"avatarPath":      u.AvatarPath,
+		"avatarThumbnail": services.VariantPath(u.AvatarPath, services.ThumbnailVariant),
+		"aboutMe":         u.AboutMe,
+		"isPublic":        u.IsPublic,
+	}
+	for _, f := range visibleFields(u) {
+		if models.CanSeeField(f.visibility, isOwner, isFollower) {
+			view[f.name] = f.value
+		}
+	}
+	if isOwner {
+		settings := map[string]string{}
+		for _, f := range visibleFields(u) {
+			settings[f.name] = f.visibility
+		}
+		view["fieldVisibility"] = settings
+	}
+	return view
+}
+
+// userField is a profile field guarded by its own visibility setting.
+type userField struct {
+	name       string
+	value      string
+	visibility string
+}
+
+func visibleFields(u *models.User) []userField {
+	return []userField{
+		{"email", u.Email, u.EmailVisibility},
+		{"dateOfBirth", u.DateOfBirth, u.DateOfBirthVisibility},
+		{"location", u.Location, u.LocationVisibility},
+		{"website", u.Website, u.WebsiteVisibility},
+		{"pronouns", u.Pronouns, u.PronounsVisibility},
+	}
+}
+
+// needsFollowerCheck reports whether any field is limited to followers, so the
+// follow relationship only has to be looked up when it can change the result.
+func needsFollowerCheck(u *models.User) bool {
+	for _, f := range visibleFields(u) {
+		if f.visibility == models.VisibilityFollowers {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+// Package dbtest gives tests a database with the same schema as the server.
+package dbtest
+
+import (
+	"database/sql"
+	"testing"
+
+	"social-network/database"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Open points database.DB at a new in-memory database with every migration applied,
+// and closes it when the test ends. Foreign keys are enforced, as they are by InitDB.
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", "file::memory:?_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("failed to open test db: %v", err)
+	}
+	// Each connection to an in-memory database gets a database of its own.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test db: %v", err)
+	}
+	database.DB = db
+	return db
+}
@@ -1,13 +1,13 @@
 CREATE TABLE IF NOT EXISTS users (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    id TEXT PRIMARY KEY,
     first_name TEXT NOT NULL,
     last_name TEXT NOT NULL,
     nickname TEXT,
     email TEXT NOT NULL UNIQUE,
-   
-    password_hash TEXT NOT NULL, 
-    date_of_birth TEXT,
+    password_hash TEXT NOT NULL,
+    date_of_birth TEXT NOT NULL,
+    avatar_path TEXT,
     about_me TEXT,
-    avatar_url TEXT,
-    profile_type TEXT DEFAULT 'public'
+    is_public INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
\ No newline at end of file
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS post_allowed_users;
+DROP TABLE IF EXISTS comments;
+DROP INDEX IF EXISTS idx_posts_user_created;
+DROP TABLE IF EXISTS posts;
@@ -0,0 +1,2 @@
+-- Up Migration: Lets a chat message carry an uploaded image.
+ALTER TABLE chat_messages ADD COLUMN attachment_path TEXT;
@@ -0,0 +1,8 @@
+-- Up Migration: Tracks deduplicated uploads so identical files are stored once.
+
+CREATE TABLE IF NOT EXISTS media_blobs (
+    hash TEXT PRIMARY KEY,                  -- Hex SHA-256 of the uploaded bytes
+    path TEXT NOT NULL UNIQUE,              -- Storage key of the processed original
+    ref_count INTEGER NOT NULL DEFAULT 1,   -- Posts, comments, avatars and messages using it
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,7 @@
+ALTER TABLE users DROP COLUMN pronouns_visibility;
+ALTER TABLE users DROP COLUMN pronouns;
+ALTER TABLE users DROP COLUMN website_visibility;
+ALTER TABLE users DROP COLUMN website;
+ALTER TABLE users DROP COLUMN location_visibility;
+ALTER TABLE users DROP COLUMN location;
+ALTER TABLE users DROP COLUMN cover_path;
@@ -0,0 +1,13 @@
+-- Up Migration: Adds a cover photo and optional location, website and pronouns to
+-- profiles. Each optional field has its own visibility: everyone, followers or only_me.
+
+ALTER TABLE users ADD COLUMN cover_path TEXT;
+ALTER TABLE users ADD COLUMN location TEXT;
+ALTER TABLE users ADD COLUMN location_visibility TEXT NOT NULL DEFAULT 'everyone'
+    CHECK(location_visibility IN ('everyone', 'followers', 'only_me'));
+ALTER TABLE users ADD COLUMN website TEXT;
+ALTER TABLE users ADD COLUMN website_visibility TEXT NOT NULL DEFAULT 'everyone'
+    CHECK(website_visibility IN ('everyone', 'followers', 'only_me'));
+ALTER TABLE users ADD COLUMN pronouns TEXT;
+ALTER TABLE users ADD COLUMN pronouns_visibility TEXT NOT NULL DEFAULT 'everyone'
+    CHECK(pronouns_visibility IN ('everyone', 'followers', 'only_me'));
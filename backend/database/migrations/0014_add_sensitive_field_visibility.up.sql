@@ -0,0 +1,7 @@
+-- Up Migration: Lets users choose who sees their email address and date of birth.
+-- Both default to the owner only, so existing accounts stop exposing them.
+
+ALTER TABLE users ADD COLUMN email_visibility TEXT NOT NULL DEFAULT 'only_me'
+    CHECK(email_visibility IN ('everyone', 'followers', 'only_me'));
+ALTER TABLE users ADD COLUMN date_of_birth_visibility TEXT NOT NULL DEFAULT 'only_me'
+    CHECK(date_of_birth_visibility IN ('everyone', 'followers', 'only_me'));
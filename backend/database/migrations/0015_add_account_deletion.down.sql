@@ -0,0 +1,21 @@
+CREATE TABLE chat_messages_old (
+    id TEXT PRIMARY KEY,
+    sender_id TEXT NOT NULL,
+    recipient_id TEXT,
+    group_id TEXT,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    attachment_path TEXT,
+    FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (recipient_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+);
+
+INSERT INTO chat_messages_old (id, sender_id, recipient_id, group_id, content, created_at, attachment_path)
+    SELECT id, sender_id, recipient_id, group_id, content, created_at, attachment_path FROM chat_messages
+    WHERE sender_id IS NOT NULL;
+
+DROP TABLE chat_messages;
+ALTER TABLE chat_messages_old RENAME TO chat_messages;
+
+ALTER TABLE users DROP COLUMN deletion_requested_at;
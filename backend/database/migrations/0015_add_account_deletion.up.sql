@@ -0,0 +1,26 @@
+-- Up Migration: Supports account deletion with a grace period.
+
+-- Set when the owner asks for the account to be deleted; logging in again clears it.
+ALTER TABLE users ADD COLUMN deletion_requested_at TIMESTAMP;
+
+-- Group messages from a deleted account are kept, anonymised, so the rest of the
+-- conversation still makes sense. That needs sender_id to be nullable, which SQLite
+-- can only do by rebuilding the table.
+CREATE TABLE chat_messages_new (
+    id TEXT PRIMARY KEY,
+    sender_id TEXT,                         -- NULL once the sender's account is deleted
+    recipient_id TEXT,                      -- For private messages, NULL for group messages
+    group_id TEXT,                          -- For group messages, NULL for private messages
+    content TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    attachment_path TEXT,
+    FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (recipient_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+);
+
+INSERT INTO chat_messages_new (id, sender_id, recipient_id, group_id, content, created_at, attachment_path)
+    SELECT id, sender_id, recipient_id, group_id, content, created_at, attachment_path FROM chat_messages;
+
+DROP TABLE chat_messages;
+ALTER TABLE chat_messages_new RENAME TO chat_messages;
@@ -0,0 +1,2 @@
+ALTER TABLE notifications DROP COLUMN link;
+DROP TABLE IF EXISTS data_exports;
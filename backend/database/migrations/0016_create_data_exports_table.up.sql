@@ -0,0 +1,18 @@
+-- Up Migration: Personal data exports, built in the background and downloadable for a limited time.
+
+CREATE TABLE IF NOT EXISTS data_exports (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    status TEXT NOT NULL CHECK(status IN ('pending', 'ready', 'failed')) DEFAULT 'pending',
+    storage_key TEXT,                       -- Where the ZIP archive is stored once ready
+    size INTEGER NOT NULL DEFAULT 0,        -- Archive size in bytes
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP,
+    expires_at TIMESTAMP,                   -- The download link stops working after this
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_user_created ON data_exports (user_id, created_at);
+
+-- Notifications can point somewhere, e.g. the download link of a finished export.
+ALTER TABLE notifications ADD COLUMN link TEXT;
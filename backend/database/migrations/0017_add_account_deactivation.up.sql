@@ -0,0 +1,5 @@
+-- Up Migration: Lets users temporarily deactivate their account.
+
+-- Set while the account is deactivated; logging in again clears it. Deactivated users
+-- are hidden from feeds, user lists, search and follower lists.
+ALTER TABLE users ADD COLUMN deactivated_at TIMESTAMP;
@@ -0,0 +1,17 @@
+-- Up Migration: Lets users mute other users and keywords in their feed.
+CREATE TABLE IF NOT EXISTS user_mutes (
+    muter_id TEXT NOT NULL,             -- The user who muted
+    muted_id TEXT NOT NULL,             -- The user whose posts are hidden from the muter
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (muter_id, muted_id),
+    FOREIGN KEY (muter_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (muted_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS muted_keywords (
+    user_id TEXT NOT NULL,
+    keyword TEXT NOT NULL,              -- Stored lower-cased; a hashtag keeps its leading '#'
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, keyword),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
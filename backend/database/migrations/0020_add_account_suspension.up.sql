@@ -0,0 +1,5 @@
+-- Up Migration: Lets moderators suspend an account until a given time.
+
+-- Set while the account is suspended; the suspension ends by itself once it has passed.
+ALTER TABLE users ADD COLUMN suspended_until TIMESTAMP;
+ALTER TABLE users ADD COLUMN suspension_reason TEXT;
@@ -0,0 +1,26 @@
+-- Up Migration: Lets users report content and profiles to the moderators.
+CREATE TABLE IF NOT EXISTS reports (
+    id TEXT PRIMARY KEY,
+    reporter_id TEXT NOT NULL,
+    target_type TEXT NOT NULL CHECK(target_type IN ('post', 'comment', 'message', 'user')),
+    target_id TEXT NOT NULL,                -- ID of the post, comment, chat message or user
+    target_user_id TEXT,                    -- Who wrote the reported content, or the reported user
+    reason TEXT NOT NULL CHECK(reason IN ('spam', 'harassment', 'hate', 'violence', 'nudity', 'misinformation', 'other')),
+    details TEXT,
+    status TEXT NOT NULL CHECK(status IN ('open', 'in_review', 'resolved')) DEFAULT 'open',
+    resolution TEXT CHECK(resolution IN ('dismissed', 'content_removed', 'user_suspended')),
+    moderator_id TEXT,                      -- The moderator who triaged or resolved the report
+    moderator_note TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP,
+    FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (target_user_id) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (moderator_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- The moderation queue lists reports by status, oldest first.
+CREATE INDEX IF NOT EXISTS idx_reports_status_created ON reports (status, created_at);
+
+-- A user can only have one unresolved report about the same thing.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_open_per_reporter
+    ON reports (reporter_id, target_type, target_id) WHERE status != 'resolved';
@@ -0,0 +1,3 @@
+-- Up Migration: Gives every user a role. Moderators work the report queue; admins can
+-- also suspend accounts, sign users out and change roles.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK(role IN ('user', 'moderator', 'admin'));
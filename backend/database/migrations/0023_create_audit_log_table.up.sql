@@ -0,0 +1,18 @@
+-- Up Migration: Records security-sensitive actions, starting with what admins and
+-- moderators do to other users' accounts and content.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor_id TEXT,                          -- Who did it; NULL for the system
+    action TEXT NOT NULL,                   -- e.g. 'admin.suspend_user'
+    subject_user_id TEXT,                   -- Whose account the action concerns
+    target_type TEXT,                       -- What was acted on when it is not the account itself
+    target_id TEXT,
+    details TEXT,                           -- Free-form JSON with anything else worth keeping
+    ip_address TEXT,
+    user_agent TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Entries are kept after the users are erased, so there are no foreign keys.
+CREATE INDEX IF NOT EXISTS idx_audit_log_subject ON audit_log (subject_user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor_id, created_at);
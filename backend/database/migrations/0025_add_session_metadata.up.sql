@@ -0,0 +1,14 @@
+-- Up Migration: Records where and when each session was used, so users can see their
+-- sessions and sign out of the ones they don't recognise.
+
+-- The token is the secret in the cookie; id is what the API uses to refer to a session.
+ALTER TABLE sessions ADD COLUMN id TEXT;
+ALTER TABLE sessions ADD COLUMN created_at TIMESTAMP;
+ALTER TABLE sessions ADD COLUMN last_used_at TIMESTAMP;
+ALTER TABLE sessions ADD COLUMN ip_address TEXT;     -- Last address the session was used from
+ALTER TABLE sessions ADD COLUMN user_agent TEXT;     -- Last browser the session was used from
+
+UPDATE sessions SET id = lower(hex(randomblob(16))), created_at = CURRENT_TIMESTAMP, last_used_at = CURRENT_TIMESTAMP;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_id ON sessions (id);
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions (user_id);
@@ -0,0 +1,19 @@
+-- Up Migration: New accounts must confirm their email address before they can post or
+-- send messages.
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+
+-- Accounts created before verification existed keep everything they could do.
+UPDATE users SET email_verified_at = CURRENT_TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+    token_hash TEXT PRIMARY KEY,            -- SHA-256 of the emailed token; the token itself is never stored
+    user_id TEXT NOT NULL,
+    email TEXT NOT NULL,                    -- The address the token was sent to, and the one it verifies
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,                      -- Set once the token has been used or superseded
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Resends are rate-limited by counting a user's recent tokens.
+CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_user ON email_verification_tokens (user_id, created_at);
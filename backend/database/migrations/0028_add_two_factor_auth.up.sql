@@ -0,0 +1,23 @@
+-- Up Migration: Optional TOTP two-factor authentication.
+ALTER TABLE users ADD COLUMN totp_secret TEXT;              -- Base32 secret; set during enrollment, before it is confirmed
+ALTER TABLE users ADD COLUMN totp_enabled_at TIMESTAMP;     -- Set once the user confirmed a code; 2FA is on while set
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER;        -- Time step of the last accepted code, so codes can't be replayed
+
+-- One-time codes for signing in without the authenticator app.
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    user_id TEXT NOT NULL,
+    code_hash TEXT NOT NULL,                -- SHA-256 of the code; the code itself is only shown once
+    used_at TIMESTAMP,
+    PRIMARY KEY (user_id, code_hash),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Logins that passed the password check and are waiting for the second factor.
+CREATE TABLE IF NOT EXISTS login_challenges (
+    token_hash TEXT PRIMARY KEY,            -- SHA-256 of the pre-auth token given to the client
+    user_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,    -- Codes tried so far; the challenge stops working after a few
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,260 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"social-network/database"
+)
+
+// RequestAccountDeletion schedules userID for erasure and signs it out everywhere.
+// The account stays in place until the grace period runs out, so logging in again can
+// still restore it.
+func RequestAccountDeletion(userID string, requestedAt time.Time) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET deletion_requested_at = ? WHERE id = ?", requestedAt.UTC(), userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeactivateAccount hides userID from other users until they log in again and signs
+// them out everywhere.
+func DeactivateAccount(userID string, deactivatedAt time.Time) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET deactivated_at = ? WHERE id = ?", deactivatedAt.UTC(), userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReactivateAccount makes a deactivated account visible again. It reports whether the
+// account was deactivated.
+func ReactivateAccount(userID string) (bool, error) {
+	res, err := database.DB.Exec("UPDATE users SET deactivated_at = NULL WHERE id = ? AND deactivated_at IS NOT NULL", userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Suspension describes why and until when an account is suspended.
+type Suspension struct {
+	Until  time.Time
+	Reason string
+}
+
+// BanUntil is the end of a permanent suspension, i.e. a ban.
+var BanUntil = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// Permanent reports whether the suspension is a ban.
+func (s *Suspension) Permanent() bool {
+	return !s.Until.Before(BanUntil)
+}
+
+// Message explains the suspension to the suspended user.
+func (s *Suspension) Message() string {
+	msg := "Your account is suspended until " + s.Until.UTC().Format(time.RFC1123) + "."
+	if s.Permanent() {
+		msg = "Your account has been banned."
+	}
+	if s.Reason != "" {
+		msg += " Reason: " + s.Reason
+	}
+	return msg
+}
+
+// SuspendAccount bars userID from logging in until the given time and signs them out
+// everywhere. Suspending an already suspended account replaces the earlier suspension.
+func SuspendAccount(userID string, until time.Time, reason string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET suspended_until = ?, suspension_reason = ? WHERE id = ?", until.UTC(), reason, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetActiveSuspension returns the suspension of userID that is still running at now,
+// or nil if the account is not suspended.
+func GetActiveSuspension(userID string, now time.Time) (*Suspension, error) {
+	var until sql.NullTime
+	var reason sql.NullString
+	err := database.DB.QueryRow("SELECT suspended_until, suspension_reason FROM users WHERE id = ?", userID).Scan(&until, &reason)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !until.Valid || !until.Time.After(now) {
+		return nil, nil
+	}
+	return &Suspension{Until: until.Time, Reason: reason.String}, nil
+}
+
+// LiftSuspension ends a suspension early. It reports whether the account was suspended.
+func LiftSuspension(userID string, now time.Time) (bool, error) {
+	res, err := database.DB.Exec("UPDATE users SET suspended_until = NULL, suspension_reason = NULL WHERE id = ? AND suspended_until > ?",
+		userID, now.UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CancelAccountDeletion clears a pending deletion request. It reports whether there
+// was one to clear.
+func CancelAccountDeletion(userID string) (bool, error) {
+	res, err := database.DB.Exec("UPDATE users SET deletion_requested_at = NULL WHERE id = ? AND deletion_requested_at IS NOT NULL", userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListAccountsDueForDeletion returns the users whose deletion was requested at or
+// before cutoff.
+func ListAccountsDueForDeletion(cutoff time.Time) ([]string, error) {
+	rows, err := database.DB.Query("SELECT id FROM users WHERE deletion_requested_at IS NOT NULL AND deletion_requested_at <= ?", cutoff.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// EraseUser permanently removes a user and everything tied to them in one transaction:
+// sessions, data exports, follows and follow requests in both directions, likes,
+// notifications they received or caused, their posts (with every comment and like on
+// them), their comments, and their private messages. Their group messages are kept but
+// anonymised, and groups they created pass to the longest-standing remaining member or
+// are removed when empty.
+//
+// It returns the media paths that the deleted rows referenced, once per reference, so
+// the caller can release the files after the transaction has committed.
+func EraseUser(userID string) ([]string, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	const ownPosts = "SELECT id FROM posts WHERE user_id = ?"
+	const affectedComments = "SELECT id FROM comments WHERE user_id = ? OR post_id IN (" + ownPosts + ")"
+	const orphanedGroups = `SELECT id FROM groups WHERE created_by = ?
+		AND NOT EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = groups.id AND gm.user_id != ?)`
+
+	var media []string
+	collect := func(query string, args ...interface{}) error {
+		rows, err := tx.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var p sql.NullString
+			if err := rows.Scan(&p); err != nil {
+				return err
+			}
+			if p.String != "" {
+				media = append(media, p.String)
+			}
+		}
+		return rows.Err()
+	}
+	for _, c := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{"SELECT avatar_path FROM users WHERE id = ?", []interface{}{userID}},
+		{"SELECT cover_path FROM users WHERE id = ?", []interface{}{userID}},
+		{"SELECT image_url FROM posts WHERE user_id = ?", []interface{}{userID}},
+		{"SELECT image_url FROM comments WHERE id IN (" + affectedComments + ")", []interface{}{userID, userID}},
+		{"SELECT attachment_path FROM chat_messages WHERE sender_id = ? OR recipient_id = ?", []interface{}{userID, userID}},
+		{"SELECT attachment_path FROM chat_messages WHERE sender_id != ? AND group_id IN (" + orphanedGroups + ")", []interface{}{userID, userID, userID}},
+	} {
+		if err := collect(c.query, c.args...); err != nil {
+			return nil, err
+		}
+	}
+
+	steps := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"DELETE FROM sessions WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM password_reset_tokens WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM email_verification_tokens WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM recovery_codes WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM login_challenges WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM data_exports WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM followers WHERE follower_id = ? OR following_id = ?", []interface{}{userID, userID}},
+		{"DELETE FROM follow_requests WHERE requester_id = ? OR target_id = ?", []interface{}{userID, userID}},
+		{"DELETE FROM user_blocks WHERE blocker_id = ? OR blocked_id = ?", []interface{}{userID, userID}},
+		{"DELETE FROM user_mutes WHERE muter_id = ? OR muted_id = ?", []interface{}{userID, userID}},
+		{"DELETE FROM muted_keywords WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM reports WHERE reporter_id = ?", []interface{}{userID}},
+		{"DELETE FROM notifications WHERE user_id = ? OR actor_id = ?", []interface{}{userID, userID}},
+		{"DELETE FROM comment_likes WHERE user_id = ? OR comment_id IN (" + affectedComments + ")", []interface{}{userID, userID, userID}},
+		{"DELETE FROM post_likes WHERE user_id = ? OR post_id IN (" + ownPosts + ")", []interface{}{userID, userID}},
+		{"DELETE FROM comments WHERE user_id = ? OR post_id IN (" + ownPosts + ")", []interface{}{userID, userID}},
+		{"DELETE FROM post_allowed_users WHERE user_id = ? OR post_id IN (" + ownPosts + ")", []interface{}{userID, userID}},
+		{"DELETE FROM posts WHERE user_id = ?", []interface{}{userID}},
+		{"DELETE FROM chat_messages WHERE recipient_id = ? OR (sender_id = ? AND group_id IS NULL)", []interface{}{userID, userID}},
+		{"UPDATE chat_messages SET sender_id = NULL, attachment_path = NULL WHERE sender_id = ?", []interface{}{userID}},
+		{`UPDATE groups SET created_by = (
+			SELECT gm.user_id FROM group_members gm WHERE gm.group_id = groups.id AND gm.user_id != ? ORDER BY gm.joined_at LIMIT 1)
+		WHERE created_by = ? AND EXISTS (SELECT 1 FROM group_members gm WHERE gm.group_id = groups.id AND gm.user_id != ?)`,
+			[]interface{}{userID, userID, userID}},
+		{"DELETE FROM chat_messages WHERE group_id IN (" + orphanedGroups + ")", []interface{}{userID, userID}},
+		{"DELETE FROM group_members WHERE user_id = ? OR group_id IN (" + orphanedGroups + ")", []interface{}{userID, userID, userID}},
+		{"DELETE FROM groups WHERE created_by = ?", []interface{}{userID}},
+		{"DELETE FROM users WHERE id = ?", []interface{}{userID}},
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step.query, step.args...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
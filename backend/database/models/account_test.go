@@ -0,0 +1,172 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"social-network/database"
+	"social-network/database/dbtest"
+)
+
+func setupAccountTestDB(t *testing.T) {
+	dbtest.Open(t)
+	_, err := database.DB.Exec(`
+		INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth, avatar_path) VALUES
+			('gone', 'Gone', 'G', 'gone@example.com', 'h', '2000-01-01', 'media/aa/avatar.jpg'),
+			('alice', 'Alice', 'A', 'alice@example.com', 'h', '2000-01-01', NULL),
+			('bob', 'Bob', 'B', 'bob@example.com', 'h', '2000-01-01', NULL);
+		INSERT INTO sessions (token, user_id, expiry) VALUES ('t1', 'gone', '2099-01-01'), ('t2', 'alice', '2099-01-01');
+		INSERT INTO data_exports (id, user_id, storage_key) VALUES ('e1', 'gone', 'exports/gone/e1.zip');
+		INSERT INTO followers (follower_id, following_id) VALUES ('gone', 'alice'), ('bob', 'gone'), ('alice', 'bob');
+		INSERT INTO follow_requests (id, requester_id, target_id) VALUES ('r1', 'gone', 'bob');
+		INSERT INTO notifications (id, user_id, actor_id, type, message) VALUES
+			('n1', 'alice', 'gone', 'follow', 'hi'), ('n2', 'gone', 'bob', 'follow', 'hi'), ('n3', 'alice', 'bob', 'follow', 'hi');
+		INSERT INTO posts (id, user_id, content, image_url) VALUES (1, 'gone', 'a', 'media/bb/post.jpg'), (2, 'alice', 'b', NULL);
+		INSERT INTO comments (id, post_id, user_id, content, image_url) VALUES
+			(10, 1, 'alice', 'c', 'media/cc/on-gone-post.jpg'), (11, 2, 'gone', 'd', NULL), (12, 2, 'bob', 'e', NULL);
+		INSERT INTO post_likes (user_id, post_id, like_type) VALUES ('alice', 1, 1), ('gone', 2, 1), ('bob', 2, 1);
+		INSERT INTO comment_likes (user_id, comment_id, like_type) VALUES ('bob', 10, 1), ('gone', 12, 1);
+		INSERT INTO groups (id, name, created_by) VALUES ('g1', 'One', 'gone'), ('g2', 'Two', 'gone');
+		INSERT INTO group_members VALUES ('g1', 'gone', '2024-01-01'), ('g1', 'alice', '2024-02-01'), ('g2', 'gone', '2024-01-01');
+		INSERT INTO chat_messages (id, sender_id, recipient_id, group_id, content, attachment_path) VALUES
+			('m1', 'gone', 'alice', NULL, 'f', 'media/dd/dm.jpg'),
+			('m2', 'alice', 'gone', NULL, 'g', NULL),
+			('m3', 'gone', NULL, 'g1', 'h', 'media/ee/group.jpg'),
+			('m4', 'alice', NULL, 'g1', 'i', NULL),
+			('m5', 'gone', NULL, 'g2', 'j', NULL);
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed tables: %v", err)
+	}
+}
+
+func countRows(t *testing.T, query string, args ...interface{}) int {
+	var n int
+	if err := database.DB.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func TestEraseUserRemovesEverything(t *testing.T) {
+	setupAccountTestDB(t)
+	media, err := EraseUser("gone")
+	if err != nil {
+		t.Fatalf("EraseUser failed: %v", err)
+	}
+
+	want := map[string]bool{
+		"media/aa/avatar.jpg": true, "media/bb/post.jpg": true, "media/cc/on-gone-post.jpg": true,
+		"media/dd/dm.jpg": true, "media/ee/group.jpg": true,
+	}
+	if len(media) != len(want) {
+		t.Fatalf("EraseUser returned media %v", media)
+	}
+	for _, p := range media {
+		if !want[p] {
+			t.Fatalf("unexpected media path %s", p)
+		}
+	}
+
+	for query, expected := range map[string]int{
+		"SELECT COUNT(*) FROM users":                                     2,
+		"SELECT COUNT(*) FROM sessions":                                  1,
+		"SELECT COUNT(*) FROM data_exports":                              0,
+		"SELECT COUNT(*) FROM followers":                                 1,
+		"SELECT COUNT(*) FROM follow_requests":                           0,
+		"SELECT COUNT(*) FROM notifications":                             1,
+		"SELECT COUNT(*) FROM posts":                                     1,
+		"SELECT COUNT(*) FROM comments":                                  1, // bob's comment on alice's post
+		"SELECT COUNT(*) FROM post_likes":                                1,
+		"SELECT COUNT(*) FROM comment_likes":                             0,
+		"SELECT COUNT(*) FROM chat_messages WHERE group_id IS NULL":      0,
+		"SELECT COUNT(*) FROM chat_messages WHERE group_id = 'g1'":       2,
+		"SELECT COUNT(*) FROM chat_messages WHERE sender_id IS NULL":     1, // anonymised group message
+		"SELECT COUNT(*) FROM chat_messages WHERE attachment_path != ''": 0,
+		"SELECT COUNT(*) FROM groups":                                    1,
+		"SELECT COUNT(*) FROM groups WHERE created_by = 'alice'":         1,
+		"SELECT COUNT(*) FROM group_members":                             1,
+	} {
+		if got := countRows(t, query); got != expected {
+			t.Errorf("%s = %d, want %d", query, got, expected)
+		}
+	}
+}
+
+func TestAccountDeletionRequestAndRestore(t *testing.T) {
+	setupAccountTestDB(t)
+	requested := time.Now().Add(-time.Hour)
+	if err := RequestAccountDeletion("gone", requested); err != nil {
+		t.Fatalf("RequestAccountDeletion failed: %v", err)
+	}
+	if n := countRows(t, "SELECT COUNT(*) FROM sessions WHERE user_id = 'gone'"); n != 0 {
+		t.Fatalf("sessions should be revoked, %d left", n)
+	}
+	due, err := ListAccountsDueForDeletion(time.Now())
+	if err != nil || len(due) != 1 || due[0] != "gone" {
+		t.Fatalf("ListAccountsDueForDeletion = %v, %v", due, err)
+	}
+	if due, _ := ListAccountsDueForDeletion(requested.Add(-time.Minute)); len(due) != 0 {
+		t.Fatalf("account should not be due before its grace period ends: %v", due)
+	}
+
+	restored, err := CancelAccountDeletion("gone")
+	if err != nil || !restored {
+		t.Fatalf("CancelAccountDeletion = %v, %v", restored, err)
+	}
+	if restored, _ := CancelAccountDeletion("gone"); restored {
+		t.Fatalf("second CancelAccountDeletion should report nothing to restore")
+	}
+	if due, _ := ListAccountsDueForDeletion(time.Now()); len(due) != 0 {
+		t.Fatalf("restored account still due for deletion: %v", due)
+	}
+}
+
+func TestDeactivatedAccountsAreHidden(t *testing.T) {
+	dbtest.Open(t)
+	_, err := database.DB.Exec(`
+		INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth, is_public)
+			VALUES ('u1', 'Alice', 'A', 'a@example.com', 'h', '2000-01-01', 1), ('u2', 'Bob', 'B', 'b@example.com', 'h', '2000-01-01', 1);
+		INSERT INTO followers (follower_id, following_id) VALUES ('u1', 'u2'), ('u2', 'u1');
+		INSERT INTO sessions (token, user_id, expiry) VALUES ('t1', 'u1', '2099-01-01');
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed tables: %v", err)
+	}
+
+	if err := DeactivateAccount("u1", time.Now()); err != nil {
+		t.Fatalf("DeactivateAccount failed: %v", err)
+	}
+	if n := countRows(t, "SELECT COUNT(*) FROM sessions WHERE user_id = 'u1'"); n != 0 {
+		t.Fatalf("sessions should be revoked, %d left", n)
+	}
+	if u, _ := GetUserByID("u1"); u == nil || u.Active {
+		t.Fatalf("deactivated user should still load but be inactive: %+v", u)
+	}
+	if users, _ := GetAllUsers(); len(users) != 1 || users[0].ID != "u2" {
+		t.Fatalf("GetAllUsers should skip deactivated users: %v", users)
+	}
+	if users, _ := SearchUsers("u2", "Alice", 10); len(users) != 0 {
+		t.Fatalf("SearchUsers should skip deactivated users: %v", users)
+	}
+	if ids, _ := ListFollowers("u2"); len(ids) != 0 {
+		t.Fatalf("ListFollowers should skip deactivated users: %v", ids)
+	}
+	if ids, _ := ListFollowing("u2"); len(ids) != 0 {
+		t.Fatalf("ListFollowing should skip deactivated users: %v", ids)
+	}
+
+	reactivated, err := ReactivateAccount("u1")
+	if err != nil || !reactivated {
+		t.Fatalf("ReactivateAccount = %v, %v", reactivated, err)
+	}
+	if u, _ := GetUserByID("u1"); u == nil || !u.Active {
+		t.Fatalf("reactivated user should be active: %+v", u)
+	}
+	if ids, _ := ListFollowers("u2"); len(ids) != 1 {
+		t.Fatalf("follows should reappear after reactivation: %v", ids)
+	}
+	if again, _ := ReactivateAccount("u1"); again {
+		t.Fatalf("reactivating an active account should report false")
+	}
+}
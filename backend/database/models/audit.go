@@ -0,0 +1,126 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"social-network/database"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditLoginSucceeded         = "auth.login"
+	AuditLoginFailed            = "auth.login_failed"
+	AuditLogout                 = "auth.logout"
+	AuditSessionsRevoked        = "auth.sessions_revoked"
+	AuditPasswordChanged        = "account.password_changed"
+	AuditPasswordResetRequested = "account.password_reset_requested"
+	AuditEmailVerified          = "account.email_verified"
+	AuditEmailChangeRequested   = "account.email_change_requested"
+	AuditEmailChanged           = "account.email_changed"
+	AuditTwoFactorEnabled       = "account.two_factor_enabled"
+	AuditTwoFactorDisabled      = "account.two_factor_disabled"
+	AuditPrivacyChanged         = "account.privacy_changed"
+	AuditFollowAccepted         = "follow.request_accepted"
+	AuditFollowDeclined         = "follow.request_declined"
+
+	AuditAdminSuspendUser    = "admin.suspend_user"
+	AuditAdminUnsuspendUser  = "admin.unsuspend_user"
+	AuditAdminRevokeSessions = "admin.revoke_sessions"
+	AuditAdminSetRole        = "admin.set_role"
+	AuditAdminRemoveContent  = "admin.remove_content"
+	AuditModerationResolve   = "moderation.resolve_report"
+)
+
+// AuditEntry is one row of the audit log.
+type AuditEntry struct {
+	ID            int64                  `json:"id"`
+	ActorID       string                 `json:"actorId,omitempty"`
+	Action        string                 `json:"action"`
+	SubjectUserID string                 `json:"subjectUserId,omitempty"`
+	TargetType    string                 `json:"targetType,omitempty"`
+	TargetID      string                 `json:"targetId,omitempty"`
+	Details       map[string]interface{} `json:"details,omitempty"`
+	IPAddress     string                 `json:"ipAddress,omitempty"`
+	UserAgent     string                 `json:"userAgent,omitempty"`
+	CreatedAt     time.Time              `json:"createdAt"`
+}
+
+// RecordAudit appends an entry to the audit log. The log is append-only: the database
+// refuses to change or delete entries once they are written.
+func RecordAudit(entry *AuditEntry) error {
+	var details sql.NullString
+	if len(entry.Details) > 0 {
+		b, err := json.Marshal(entry.Details)
+		if err != nil {
+			return err
+		}
+		details = sql.NullString{String: string(b), Valid: true}
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+
+	res, err := database.DB.Exec(`INSERT INTO audit_log (actor_id, action, subject_user_id, target_type, target_id, details, ip_address, user_agent, created_at)
+		VALUES (NULLIF(?, ''), ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?, NULLIF(?, ''), NULLIF(?, ''), ?)`,
+		entry.ActorID, entry.Action, entry.SubjectUserID, entry.TargetType, entry.TargetID, details, entry.IPAddress, entry.UserAgent, entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+	entry.ID, err = res.LastInsertId()
+	return err
+}
+
+const auditColumns = "id, actor_id, action, subject_user_id, target_type, target_id, details, ip_address, user_agent, created_at"
+
+// ListAccountActivity returns the entries about userID's own account, newest first, as
+// shown to userID. Staff who acted on the account are not named, and the IP address and
+// user agent they acted from are left out.
+func ListAccountActivity(userID string, limit, offset int) ([]*AuditEntry, error) {
+	entries, err := queryAuditEntries("SELECT "+auditColumns+" FROM audit_log WHERE subject_user_id = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?",
+		userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.ActorID != "" && e.ActorID != userID {
+			e.ActorID, e.IPAddress, e.UserAgent = "", "", ""
+		}
+	}
+	return entries, nil
+}
+
+// ListAuditEntriesInvolving returns the entries about userID's account or actions
+// userID took on others, newest first.
+func ListAuditEntriesInvolving(userID string, limit, offset int) ([]*AuditEntry, error) {
+	return queryAuditEntries("SELECT "+auditColumns+" FROM audit_log WHERE subject_user_id = ? OR actor_id = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?",
+		userID, userID, limit, offset)
+}
+
+func queryAuditEntries(query string, args ...interface{}) ([]*AuditEntry, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		e := &AuditEntry{}
+		var actor, subject, targetType, targetID, details, ip, agent sql.NullString
+		if err := rows.Scan(&e.ID, &actor, &e.Action, &subject, &targetType, &targetID, &details, &ip, &agent, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.ActorID, e.SubjectUserID = actor.String, subject.String
+		e.TargetType, e.TargetID = targetType.String, targetID.String
+		e.IPAddress, e.UserAgent = ip.String, agent.String
+		if details.Valid {
+			if err := json.Unmarshal([]byte(details.String), &e.Details); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
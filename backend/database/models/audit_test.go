@@ -0,0 +1,73 @@
+package models
+
+import (
+	"testing"
+
+	"social-network/database"
+	"social-network/database/dbtest"
+)
+
+func TestAuditLogIsAppendOnlyAndQueryable(t *testing.T) {
+	dbtest.Open(t)
+
+	entries := []*AuditEntry{
+		{ActorID: "u1", Action: AuditLoginSucceeded, SubjectUserID: "u1", IPAddress: "10.0.0.1", UserAgent: "test"},
+		{Action: AuditLoginFailed, SubjectUserID: "u1", Details: map[string]interface{}{"reason": "wrong_password"}},
+		{ActorID: "admin", Action: AuditAdminSuspendUser, SubjectUserID: "u2"},
+	}
+	for _, e := range entries {
+		if err := RecordAudit(e); err != nil {
+			t.Fatalf("RecordAudit failed: %v", err)
+		}
+	}
+
+	activity, err := ListAccountActivity("u1", 10, 0)
+	if err != nil || len(activity) != 2 {
+		t.Fatalf("ListAccountActivity = %v, %v", activity, err)
+	}
+	if activity[0].Action != AuditLoginFailed || activity[0].Details["reason"] != "wrong_password" {
+		t.Fatalf("newest entry should come first with its details: %+v", activity[0])
+	}
+	if activity[1].IPAddress != "10.0.0.1" || activity[1].UserAgent != "test" {
+		t.Fatalf("client details not stored: %+v", activity[1])
+	}
+
+	if involving, _ := ListAuditEntriesInvolving("admin", 10, 0); len(involving) != 1 || involving[0].SubjectUserID != "u2" {
+		t.Fatalf("ListAuditEntriesInvolving should include actions taken by the user: %v", involving)
+	}
+
+	if _, err := database.DB.Exec("UPDATE audit_log SET action = 'tampered'"); err == nil {
+		t.Fatal("updating the audit log should fail")
+	}
+	if _, err := database.DB.Exec("DELETE FROM audit_log"); err == nil {
+		t.Fatal("deleting from the audit log should fail")
+	}
+	if n := countRows(t, "SELECT COUNT(*) FROM audit_log"); n != 3 {
+		t.Fatalf("audit log should still hold 3 entries, got %d", n)
+	}
+}
+
+func TestAccountActivityHidesStaff(t *testing.T) {
+	dbtest.Open(t)
+
+	entries := []*AuditEntry{
+		{Action: AuditLoginFailed, SubjectUserID: "u1", IPAddress: "10.0.0.2", UserAgent: "attacker"},
+		{ActorID: "mod", Action: AuditAdminSuspendUser, SubjectUserID: "u1", IPAddress: "198.51.100.1", UserAgent: "staff-browser"},
+	}
+	for _, e := range entries {
+		if err := RecordAudit(e); err != nil {
+			t.Fatalf("RecordAudit failed: %v", err)
+		}
+	}
+
+	activity, err := ListAccountActivity("u1", 10, 0)
+	if err != nil || len(activity) != 2 {
+		t.Fatalf("ListAccountActivity = %v, %v", activity, err)
+	}
+	if staff := activity[0]; staff.Action != AuditAdminSuspendUser || staff.ActorID != "" || staff.IPAddress != "" || staff.UserAgent != "" {
+		t.Fatalf("staff action should not show who took it or from where: %+v", staff)
+	}
+	if failed := activity[1]; failed.IPAddress != "10.0.0.2" || failed.UserAgent != "attacker" {
+		t.Fatalf("failed login should keep the client details of the attempt: %+v", failed)
+	}
+}
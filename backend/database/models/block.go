@@ -0,0 +1,116 @@
+package models
+
+import (
+	"time"
+
+	"social-network/database"
+)
+
+// BlockedUser is an entry of a user's block list.
+type BlockedUser struct {
+	UserID    string
+	BlockedAt time.Time
+}
+
+// NotBlockedCondition returns an SQL condition that is true when the user in userColumn
+// and the viewer have not blocked each other. It takes the viewer's ID twice.
+func NotBlockedCondition(userColumn string) string {
+	return `NOT EXISTS (SELECT 1 FROM user_blocks ub
+		WHERE (ub.blocker_id = ? AND ub.blocked_id = ` + userColumn + `)
+		OR (ub.blocker_id = ` + userColumn + ` AND ub.blocked_id = ?))`
+}
+
+// BlockUser records that blockerID blocked blockedID. Follows in both directions, pending
+// follow requests and the notifications they sent each other are removed with it.
+// Blocking someone twice is not an error.
+func BlockUser(blockerID, blockedID string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	steps := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"INSERT OR IGNORE INTO user_blocks (blocker_id, blocked_id) VALUES (?, ?)", []interface{}{blockerID, blockedID}},
+		{"DELETE FROM followers WHERE (follower_id = ? AND following_id = ?) OR (follower_id = ? AND following_id = ?)",
+			[]interface{}{blockerID, blockedID, blockedID, blockerID}},
+		{"DELETE FROM follow_requests WHERE status = 'pending' AND ((requester_id = ? AND target_id = ?) OR (requester_id = ? AND target_id = ?))",
+			[]interface{}{blockerID, blockedID, blockedID, blockerID}},
+		{"DELETE FROM notifications WHERE (user_id = ? AND actor_id = ?) OR (user_id = ? AND actor_id = ?)",
+			[]interface{}{blockerID, blockedID, blockedID, blockerID}},
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step.query, step.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UnblockUser removes a block. Follows removed by the block are not restored.
+func UnblockUser(blockerID, blockedID string) error {
+	_, err := database.DB.Exec("DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?", blockerID, blockedID)
+	return err
+}
+
+// HasBlocked reports whether blockerID has blocked blockedID.
+func HasBlocked(blockerID, blockedID string) (bool, error) {
+	var exists bool
+	err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?)",
+		blockerID, blockedID).Scan(&exists)
+	return exists, err
+}
+
+// IsBlockedEitherWay reports whether either user has blocked the other.
+func IsBlockedEitherWay(user1ID, user2ID string) (bool, error) {
+	if user1ID == "" || user2ID == "" || user1ID == user2ID {
+		return false, nil
+	}
+	var exists bool
+	err := database.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_blocks
+		WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?))`,
+		user1ID, user2ID, user2ID, user1ID).Scan(&exists)
+	return exists, err
+}
+
+// ListBlockedUsers returns the users blockerID has blocked, most recent first.
+func ListBlockedUsers(blockerID string) ([]BlockedUser, error) {
+	rows, err := database.DB.Query("SELECT blocked_id, created_at FROM user_blocks WHERE blocker_id = ? ORDER BY created_at DESC", blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocked []BlockedUser
+	for rows.Next() {
+		var b BlockedUser
+		if err := rows.Scan(&b.UserID, &b.BlockedAt); err != nil {
+			return nil, err
+		}
+		blocked = append(blocked, b)
+	}
+	return blocked, rows.Err()
+}
+
+// GetBlockedUserIDs returns every user that userID has blocked or been blocked by.
+func GetBlockedUserIDs(userID string) (map[string]bool, error) {
+	rows, err := database.DB.Query(`SELECT blocked_id FROM user_blocks WHERE blocker_id = ?
+		UNION SELECT blocker_id FROM user_blocks WHERE blocked_id = ?`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
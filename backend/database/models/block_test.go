@@ -0,0 +1,62 @@
+package models
+
+import (
+	"testing"
+
+	"social-network/database"
+	"social-network/database/dbtest"
+)
+
+func TestBlockUserRemovesRelationships(t *testing.T) {
+	dbtest.Open(t)
+	_, err := database.DB.Exec(`
+		INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth, is_public)
+			VALUES ('u1', 'Alice', 'A', 'a@example.com', 'h', '2000-01-01', 1), ('u2', 'Bob', 'B', 'b@example.com', 'h', '2000-01-01', 0);
+		INSERT INTO followers (follower_id, following_id) VALUES ('u1', 'u2'), ('u2', 'u1');
+		INSERT INTO follow_requests (id, requester_id, target_id, status) VALUES ('r1', 'u2', 'u1', 'pending');
+		INSERT INTO notifications (id, user_id, actor_id, type, message, read) VALUES ('n1', 'u1', 'u2', 'follow_request', 'hi', 0);
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed tables: %v", err)
+	}
+
+	if err := BlockUser("u1", "u2"); err != nil {
+		t.Fatalf("BlockUser failed: %v", err)
+	}
+	if err := BlockUser("u1", "u2"); err != nil {
+		t.Fatalf("blocking twice should not fail: %v", err)
+	}
+
+	if n := countRows(t, "SELECT COUNT(*) FROM followers"); n != 0 {
+		t.Fatalf("follows should be removed both ways, %d left", n)
+	}
+	if n := countRows(t, "SELECT COUNT(*) FROM follow_requests"); n != 0 {
+		t.Fatalf("pending follow requests should be removed, %d left", n)
+	}
+	if n := countRows(t, "SELECT COUNT(*) FROM notifications"); n != 0 {
+		t.Fatalf("notifications between the users should be removed, %d left", n)
+	}
+	if ok, _ := CanUsersMessage("u2", "u1"); ok {
+		t.Fatal("blocked users should not be able to message each other")
+	}
+	if users, _ := SearchUsers("u2", "Alice", 10); len(users) != 0 {
+		t.Fatalf("SearchUsers should skip users blocking the searcher: %v", users)
+	}
+	err = CreateNotification(&Notification{UserID: "u1", ActorID: "u2", Type: "follow", Message: "Bob follows you."})
+	if err != ErrNotificationSuppressed {
+		t.Fatalf("CreateNotification should be suppressed, got %v", err)
+	}
+	if ids, _ := GetBlockedUserIDs("u2"); !ids["u1"] {
+		t.Fatalf("GetBlockedUserIDs should include the blocker: %v", ids)
+	}
+
+	if err := UnblockUser("u1", "u2"); err != nil {
+		t.Fatalf("UnblockUser failed: %v", err)
+	}
+	if blocked, _ := IsBlockedEitherWay("u1", "u2"); blocked {
+		t.Fatal("users should no longer be blocked after UnblockUser")
+	}
+	if users, _ := SearchUsers("u2", "Alice", 10); len(users) != 1 {
+		t.Fatalf("SearchUsers should find the user again after unblocking: %v", users)
+	}
+}
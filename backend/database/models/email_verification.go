@@ -0,0 +1,120 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"social-network/database"
+)
+
+// ErrInvalidVerificationToken is returned for an email verification token that doesn't
+// exist, has expired or has already been used.
+var ErrInvalidVerificationToken = errors.New("this verification link is invalid or has expired")
+
+// ErrEmailInUse is returned when verifying an address another account has taken since
+// the verification email was sent.
+var ErrEmailInUse = errors.New("this email address is already used by another account")
+
+// VerifiedEmail describes a successful verification. PreviousEmail differs from Email
+// when the verification completed a change of address.
+type VerifiedEmail struct {
+	UserID        string
+	Email         string
+	PreviousEmail string
+}
+
+// CreateEmailVerificationToken stores the hash of a new token verifying email for
+// userID. Earlier tokens the user hasn't used stop working, so only the latest email is
+// valid.
+func CreateEmailVerificationToken(userID, email, tokenHash string, now, expiresAt time.Time) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE email_verification_tokens SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now.UTC(), userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO email_verification_tokens (token_hash, user_id, email, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)`, tokenHash, userID, email, now.UTC(), expiresAt.UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListEmailVerificationRequests returns when verification emails were sent to userID
+// since the given time, newest first.
+func ListEmailVerificationRequests(userID string, since time.Time) ([]time.Time, error) {
+	rows, err := database.DB.Query(`
+		SELECT created_at FROM email_verification_tokens
+		WHERE user_id = ? AND created_at >= ?
+		ORDER BY created_at DESC`, userID, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sent []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		sent = append(sent, t)
+	}
+	return sent, rows.Err()
+}
+
+// VerifyEmail uses the verification token with tokenHash to make the address it was
+// sent to its user's verified email, replacing their current address if it differs. The
+// token can only be used once; it returns ErrInvalidVerificationToken if it is unknown,
+// used or expired, and ErrEmailInUse if another account has taken the address since.
+func VerifyEmail(tokenHash string, now time.Time) (*VerifiedEmail, error) {
+	now = now.UTC()
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	v := &VerifiedEmail{}
+	err = tx.QueryRow(`
+		UPDATE email_verification_tokens SET used_at = ?
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING user_id, email`, now, tokenHash, now).Scan(&v.UserID, &v.Email)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.QueryRow("SELECT email FROM users WHERE id = ?", v.UserID).Scan(&v.PreviousEmail); err != nil {
+		return nil, err
+	}
+	var taken bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = ? AND id != ?)", v.Email, v.UserID).Scan(&taken)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrEmailInUse
+	}
+
+	if _, err := tx.Exec("UPDATE users SET email = ?, email_verified_at = ? WHERE id = ?", v.Email, now, v.UserID); err != nil {
+		return nil, err
+	}
+	return v, tx.Commit()
+}
+
+// IsEmailVerified reports whether userID has verified their email address.
+func IsEmailVerified(userID string) (bool, error) {
+	var verified bool
+	err := database.DB.QueryRow("SELECT email_verified_at IS NOT NULL FROM users WHERE id = ?", userID).Scan(&verified)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return verified, err
+}
@@ -0,0 +1,290 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"social-network/database"
+
+	"github.com/google/uuid"
+)
+
+// Statuses of a personal data export.
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// ErrExportInProgress is returned when a user asks for an export while one is still being built.
+var ErrExportInProgress = errors.New("a data export is already being prepared")
+
+// DataExport represents a row of the 'data_exports' table.
+type DataExport struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"-"`
+	Status      string     `json:"status"`
+	StorageKey  string     `json:"-"`
+	Size        int64      `json:"size,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Expired reports whether a finished export can no longer be downloaded.
+func (e *DataExport) Expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !now.Before(*e.ExpiresAt)
+}
+
+const dataExportColumns = "id, user_id, status, storage_key, size, created_at, completed_at, expires_at"
+
+func scanDataExport(row interface{ Scan(...interface{}) error }) (*DataExport, error) {
+	e := &DataExport{}
+	var key sql.NullString
+	var completed, expires sql.NullTime
+	if err := row.Scan(&e.ID, &e.UserID, &e.Status, &key, &e.Size, &e.CreatedAt, &completed, &expires); err != nil {
+		return nil, err
+	}
+	e.StorageKey = key.String
+	if completed.Valid {
+		e.CompletedAt = &completed.Time
+	}
+	if expires.Valid {
+		e.ExpiresAt = &expires.Time
+	}
+	return e, nil
+}
+
+// CreateDataExport records a new pending export for userID. It returns
+// ErrExportInProgress if the user already has one pending.
+func CreateDataExport(userID string) (*DataExport, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var pending int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM data_exports WHERE user_id = ? AND status = ?", userID, ExportPending).Scan(&pending); err != nil {
+		return nil, err
+	}
+	if pending > 0 {
+		return nil, ErrExportInProgress
+	}
+
+	export := &DataExport{ID: uuid.NewString(), UserID: userID, Status: ExportPending, CreatedAt: time.Now().UTC()}
+	if _, err := tx.Exec("INSERT INTO data_exports (id, user_id, status, created_at) VALUES (?, ?, ?, ?)",
+		export.ID, export.UserID, export.Status, export.CreatedAt); err != nil {
+		return nil, err
+	}
+	return export, tx.Commit()
+}
+
+// GetDataExport retrieves an export by ID. Returns nil if there is none.
+func GetDataExport(exportID string) (*DataExport, error) {
+	export, err := scanDataExport(database.DB.QueryRow("SELECT "+dataExportColumns+" FROM data_exports WHERE id = ?", exportID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return export, err
+}
+
+// ListDataExportsForUser returns a user's exports, newest first.
+func ListDataExportsForUser(userID string) ([]*DataExport, error) {
+	return queryDataExports("SELECT "+dataExportColumns+" FROM data_exports WHERE user_id = ? ORDER BY created_at DESC", userID)
+}
+
+// ListPendingDataExports returns every export that has not been built yet, oldest first.
+func ListPendingDataExports() ([]*DataExport, error) {
+	return queryDataExports("SELECT "+dataExportColumns+" FROM data_exports WHERE status = ? ORDER BY created_at", ExportPending)
+}
+
+// ListExpiredDataExports returns the finished or failed exports whose time ran out before now.
+func ListExpiredDataExports(now time.Time) ([]*DataExport, error) {
+	return queryDataExports("SELECT "+dataExportColumns+" FROM data_exports WHERE expires_at IS NOT NULL AND expires_at <= ?", now.UTC())
+}
+
+func queryDataExports(query string, args ...interface{}) ([]*DataExport, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exports []*DataExport
+	for rows.Next() {
+		export, err := scanDataExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, export)
+	}
+	return exports, rows.Err()
+}
+
+// MarkDataExportReady records where a finished export was stored and until when it can be downloaded.
+func MarkDataExportReady(exportID, storageKey string, size int64, expiresAt time.Time) error {
+	_, err := database.DB.Exec(`UPDATE data_exports SET status = ?, storage_key = ?, size = ?, completed_at = ?, expires_at = ?
+		WHERE id = ?`, ExportReady, storageKey, size, time.Now().UTC(), expiresAt.UTC(), exportID)
+	return err
+}
+
+// MarkDataExportFailed records that an export could not be built. The row is kept
+// until expiresAt so the user can still see what happened.
+func MarkDataExportFailed(exportID string, expiresAt time.Time) error {
+	_, err := database.DB.Exec("UPDATE data_exports SET status = ?, completed_at = ?, expires_at = ? WHERE id = ?",
+		ExportFailed, time.Now().UTC(), expiresAt.UTC(), exportID)
+	return err
+}
+
+// DeleteDataExport removes an export's row.
+func DeleteDataExport(exportID string) error {
+	_, err := database.DB.Exec("DELETE FROM data_exports WHERE id = ?", exportID)
+	return err
+}
+
+// UserDataSection is one JSON file of a personal data export. Rows are keyed by column name.
+type UserDataSection struct {
+	Name string
+	Rows []map[string]interface{}
+}
+
+// userDataQueries lists what a personal data export contains. Each query takes the
+// user's ID once per placeholder. Password hashes and other secrets are never selected.
+var userDataQueries = []struct {
+	name  string
+	query string
+}{
+	{"profile", `SELECT id, first_name, last_name, nickname, email, date_of_birth, avatar_path, cover_path, about_me,
+		location, website, pronouns, is_public, email_visibility, date_of_birth_visibility, location_visibility,
+		website_visibility, pronouns_visibility, created_at
+		FROM users WHERE id = ?`},
+	{"posts", `SELECT p.id, p.content, p.image_url, p.privacy, p.created_at,
+		(SELECT GROUP_CONCAT(pa.user_id) FROM post_allowed_users pa WHERE pa.post_id = p.id) AS allowed_user_ids
+		FROM posts p WHERE p.user_id = ? ORDER BY p.created_at`},
+	{"comments", `SELECT id, post_id, content, image_url, created_at FROM comments WHERE user_id = ? ORDER BY created_at`},
+	{"likes", `SELECT 'post' AS target, post_id AS target_id, like_type, created_at FROM post_likes WHERE user_id = ?
+		UNION ALL
+		SELECT 'comment', comment_id, like_type, created_at FROM comment_likes WHERE user_id = ?
+		ORDER BY created_at`},
+	{"followers", `SELECT u.id, u.first_name, u.last_name, u.nickname, f.created_at AS since
+		FROM followers f JOIN users u ON u.id = f.follower_id WHERE f.following_id = ? ORDER BY f.created_at`},
+	{"following", `SELECT u.id, u.first_name, u.last_name, u.nickname, f.created_at AS since
+		FROM followers f JOIN users u ON u.id = f.following_id WHERE f.follower_id = ? ORDER BY f.created_at`},
+	{"follow_requests", `SELECT id, requester_id, target_id, status, created_at, updated_at
+		FROM follow_requests WHERE requester_id = ? OR target_id = ? ORDER BY created_at`},
+	{"notifications", `SELECT id, actor_id, type, message, link, read, created_at
+		FROM notifications WHERE user_id = ? ORDER BY created_at`},
+	// Private conversations in full, plus what the user wrote in groups.
+	{"messages", `SELECT id, sender_id, recipient_id, group_id, content, attachment_path, created_at
+		FROM chat_messages WHERE sender_id = ? OR recipient_id = ? ORDER BY created_at`},
+	// Session tokens are secrets, so only what the session list shows is included.
+	{"sessions", `SELECT id, created_at, last_used_at, expiry AS expires_at, ip_address, user_agent
+		FROM sessions WHERE user_id = ? ORDER BY created_at`},
+	{"blocks", `SELECT blocked_id, created_at FROM user_blocks WHERE blocker_id = ? ORDER BY created_at`},
+	{"mutes", `SELECT muted_id, created_at FROM user_mutes WHERE muter_id = ? ORDER BY created_at`},
+	{"muted_keywords", `SELECT keyword, created_at FROM muted_keywords WHERE user_id = ? ORDER BY created_at`},
+	// Reports the user filed, without the moderator who handled them or their notes.
+	{"reports", `SELECT id, target_type, target_id, reason, details, status, resolution, created_at, resolved_at
+		FROM reports WHERE reporter_id = ? ORDER BY created_at`},
+	// The account activity the user can see, as in ListAccountActivity: staff who acted on
+	// the account are left unnamed, and so are the IP address and user agent they used.
+	{"account_activity", `SELECT id, CASE WHEN actor_id = subject_user_id THEN actor_id END AS actor_id, action,
+		target_type, target_id, details,
+		CASE WHEN actor_id IS NULL OR actor_id = subject_user_id THEN ip_address END AS ip_address,
+		CASE WHEN actor_id IS NULL OR actor_id = subject_user_id THEN user_agent END AS user_agent, created_at
+		FROM audit_log WHERE subject_user_id = ? ORDER BY created_at, id`},
+}
+
+// CollectUserData gathers everything stored about a user for a personal data export.
+func CollectUserData(userID string) ([]UserDataSection, error) {
+	sections := make([]UserDataSection, 0, len(userDataQueries))
+	for _, q := range userDataQueries {
+		args := make([]interface{}, countPlaceholders(q.query))
+		for i := range args {
+			args[i] = userID
+		}
+		rows, err := queryRowMaps(q.query, args...)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, UserDataSection{Name: q.name, Rows: rows})
+	}
+	return sections, nil
+}
+
+// ListUserMediaPaths returns every upload that belongs to a user: their avatar and
+// cover photo and the images on their posts, comments and sent messages.
+func ListUserMediaPaths(userID string) ([]string, error) {
+	rows, err := database.DB.Query(`
+		SELECT avatar_path FROM users WHERE id = ?1
+		UNION
+		SELECT cover_path FROM users WHERE id = ?1
+		UNION
+		SELECT image_url FROM posts WHERE user_id = ?1
+		UNION
+		SELECT image_url FROM comments WHERE user_id = ?1
+		UNION
+		SELECT attachment_path FROM chat_messages WHERE sender_id = ?1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var p sql.NullString
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		if p.String != "" {
+			paths = append(paths, p.String)
+		}
+	}
+	return paths, rows.Err()
+}
+
+func countPlaceholders(query string) int {
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+		}
+	}
+	return n
+}
+
+// queryRowMaps runs query and returns each row as a column name to value map.
+func queryRowMaps(query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[col] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
@@ -62,9 +62,12 @@ func RemoveFollower(followerID, followingID string) error {
 	return err
 }
 
-// ListFollowers returns a list of user IDs who follow the given user.
+// ListFollowers returns a list of user IDs who follow the given user. Deactivated
+// accounts are left out.
 func ListFollowers(userID string) ([]string, error) {
-	rows, err := database.DB.Query(`SELECT follower_id FROM followers WHERE following_id = ?`, userID)
+	rows, err := database.DB.Query(`SELECT follower_id FROM followers
+		JOIN users ON users.id = follower_id
+		WHERE following_id = ? AND `+ActiveUserCondition, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -81,8 +84,11 @@ func ListFollowers(userID string) ([]string, error) {
 }
 
 // ListFollowing returns a list of user IDs whom the given user is following.
+// Deactivated accounts are left out.
 func ListFollowing(userID string) ([]string, error) {
-	rows, err := database.DB.Query(`SELECT following_id FROM followers WHERE follower_id = ?`, userID)
+	rows, err := database.DB.Query(`SELECT following_id FROM followers
+		JOIN users ON users.id = following_id
+		WHERE follower_id = ? AND `+ActiveUserCondition, userID)
 	if err != nil {
 		return nil, err
 	}
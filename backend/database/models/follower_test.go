@@ -1,57 +1,17 @@
 package models
 
 import (
-	"database/sql"
 	// "os"
 	"testing"
+
 	"social-network/database"
-	_ "github.com/mattn/go-sqlite3"
+	"social-network/database/dbtest"
 )
 
-func setupTestDB(t *testing.T) {
-	db, err := sql.Open("sqlite3", ":memory:")
-	if err != nil {
-		t.Fatalf("failed to open test db: %v", err)
-	}
-	database.DB = db
-	// Create users, followers, follow_requests tables
-	_, err = db.Exec(`
-		CREATE TABLE users (
-			id TEXT PRIMARY KEY,
-			first_name TEXT,
-			last_name TEXT,
-			nickname TEXT,
-			email TEXT,
-			password_hash TEXT,
-			date_of_birth TEXT,
-			avatar_path TEXT,
-			about_me TEXT,
-			is_public INTEGER,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);
-		CREATE TABLE followers (
-			follower_id TEXT,
-			following_id TEXT,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			PRIMARY KEY (follower_id, following_id)
-		);
-		CREATE TABLE follow_requests (
-			id TEXT PRIMARY KEY,
-			requester_id TEXT,
-			target_id TEXT,
-			status TEXT,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);
-	`)
-	if err != nil {
-		t.Fatalf("failed to create tables: %v", err)
-	}
-}
-
 func TestFollowRequestLifecycle(t *testing.T) {
-	setupTestDB(t)
+	dbtest.Open(t)
 	// Insert two users
-	_, err := database.DB.Exec(`INSERT INTO users (id, first_name, last_name, is_public) VALUES ('u1', 'Alice', 'A', 0), ('u2', 'Bob', 'B', 1)`)
+	_, err := database.DB.Exec(`INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth, is_public) VALUES ('u1', 'Alice', 'A', 'u1@example.com', 'h', '2000-01-01', 0), ('u2', 'Bob', 'B', 'u2@example.com', 'h', '2000-01-01', 1)`)
 	if err != nil {
 		t.Fatalf("failed to insert users: %v", err)
 	}
@@ -110,8 +70,8 @@ func TestFollowRequestLifecycle(t *testing.T) {
 }
 
 func TestCheckFollowRelationship(t *testing.T) {
-	setupTestDB(t)
-	_, err := database.DB.Exec(`INSERT INTO users (id, first_name, last_name, is_public) VALUES ('a', 'A', 'A', 1), ('b', 'B', 'B', 1)`)
+	dbtest.Open(t)
+	_, err := database.DB.Exec(`INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth, is_public) VALUES ('a', 'A', 'A', 'a@example.com', 'h', '2000-01-01', 1), ('b', 'B', 'B', 'b@example.com', 'h', '2000-01-01', 1)`)
 	if err != nil {
 		t.Fatalf("failed to insert users: %v", err)
 	}
@@ -140,8 +100,8 @@ func TestCheckFollowRelationship(t *testing.T) {
 }
 
 func TestDoubleFollowRequest(t *testing.T) {
-	setupTestDB(t)
-	_, err := database.DB.Exec(`INSERT INTO users (id, first_name, last_name, is_public) VALUES ('x', 'X', 'X', 1), ('y', 'Y', 'Y', 1)`)
+	dbtest.Open(t)
+	_, err := database.DB.Exec(`INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth, is_public) VALUES ('x', 'X', 'X', 'x@example.com', 'h', '2000-01-01', 1), ('y', 'Y', 'Y', 'y@example.com', 'h', '2000-01-01', 1)`)
 	if err != nil {
 		t.Fatalf("failed to insert users: %v", err)
 	}
@@ -167,7 +127,7 @@ func TestDoubleFollowRequest(t *testing.T) {
 
 func TestFollowFunctions_DBError(t *testing.T) {
 	// Simulate DB error by closing DB
-	setupTestDB(t)
+	dbtest.Open(t)
 	database.DB.Close()
 	if err := CreateFollowRequest("a", "b"); err == nil {
 		t.Fatalf("CreateFollowRequest should fail on closed DB")
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"strings"
+
+	"social-network/database"
+)
+
+// GetReferencedMediaPaths returns the relative path of every uploaded file that is still
+// referenced by a user avatar or cover photo, post, comment or chat message, that a deduplicated
+// blob still counts references to, or that holds a personal data export. Variants are not listed; they belong to whichever
+// original is referenced.
+func GetReferencedMediaPaths() (map[string]bool, error) {
+	rows, err := database.DB.Query(`
+		SELECT avatar_path FROM users WHERE avatar_path IS NOT NULL AND avatar_path != ''
+		UNION
+		SELECT cover_path FROM users WHERE cover_path IS NOT NULL AND cover_path != ''
+		UNION
+		SELECT image_url FROM posts WHERE image_url IS NOT NULL AND image_url != ''
+		UNION
+		SELECT image_url FROM comments WHERE image_url IS NOT NULL AND image_url != ''
+		UNION
+		SELECT attachment_path FROM chat_messages WHERE attachment_path IS NOT NULL AND attachment_path != ''
+		UNION
+		SELECT path FROM media_blobs WHERE ref_count > 0
+		UNION
+		SELECT storage_key FROM data_exports WHERE storage_key IS NOT NULL AND storage_key != ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := make(map[string]bool)
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		// Older avatars were stored with the upload directory in front of them.
+		p = strings.TrimPrefix(strings.TrimPrefix(p, "/"), "uploads/")
+		paths[p] = true
+	}
+	return paths, rows.Err()
+}
+
+// AcquireMediaBlob adds a reference to the stored blob with the given content hash and
+// returns its path. found is false when no such blob has been stored yet.
+func AcquireMediaBlob(hash string) (path string, found bool, err error) {
+	res, err := database.DB.Exec("UPDATE media_blobs SET ref_count = ref_count + 1 WHERE hash = ?", hash)
+	if err != nil {
+		return "", false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return "", false, err
+	}
+	err = database.DB.QueryRow("SELECT path FROM media_blobs WHERE hash = ?", hash).Scan(&path)
+	if err != nil {
+		return "", false, err
+	}
+	return path, true, nil
+}
+
+// RecordMediaBlob registers a newly stored blob with one reference. If the same content
+// was registered concurrently, the existing row gains a reference instead.
+func RecordMediaBlob(hash, path string) error {
+	_, err := database.DB.Exec(`
+		INSERT INTO media_blobs (hash, path, ref_count) VALUES (?, ?, 1)
+		ON CONFLICT(hash) DO UPDATE SET ref_count = ref_count + 1`, hash, path)
+	return err
+}
+
+// ReleaseMediaBlob drops one reference to the blob stored at path. tracked is false
+// for files stored before deduplication, which have no blob row; last is true when
+// the final reference went away and the blob row was removed.
+func ReleaseMediaBlob(path string) (tracked bool, last bool, err error) {
+	res, err := database.DB.Exec("UPDATE media_blobs SET ref_count = ref_count - 1 WHERE path = ?", path)
+	if err != nil {
+		return false, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, false, err
+	}
+	res, err = database.DB.Exec("DELETE FROM media_blobs WHERE path = ? AND ref_count <= 0", path)
+	if err != nil {
+		return true, false, err
+	}
+	n, err := res.RowsAffected()
+	return true, n > 0, err
+}
@@ -10,12 +10,19 @@ import (
 
 // Message represents a single chat message, for both private and group chats.
 type Message struct {
-	ID          string    `json:"id"`
-	SenderID    string    `json:"senderId"`
-	RecipientID string    `json:"recipientId,omitempty"` // Empty for group messages
-	GroupID     string    `json:"groupId,omitempty"`     // Empty for private messages
-	Content     string    `json:"content"`
-	CreatedAt   time.Time `json:"createdAt"`
+	ID             string    `json:"id"`
+	SenderID       string    `json:"senderId"`
+	RecipientID    string    `json:"recipientId,omitempty"` // Empty for group messages
+	GroupID        string    `json:"groupId,omitempty"`     // Empty for private messages
+	Content        string    `json:"content"`
+	AttachmentPath string    `json:"attachmentPath,omitempty"` // Relative path of an uploaded image, if any
+	CreatedAt      time.Time `json:"createdAt"`
+
+	// Scaled copies of the attachment, derived from AttachmentPath rather than stored.
+	// For an animated GIF these are static previews of its first frame.
+	AttachmentThumbnail string `json:"attachmentThumbnail,omitempty"`
+	AttachmentMedium    string `json:"attachmentMedium,omitempty"`
+	AttachmentAnimated  bool   `json:"attachmentAnimated,omitempty"`
 }
 
 // SaveMessage stores a new chat message in the database.
@@ -34,34 +41,45 @@ func SaveMessage(msg *Message) error {
 		group.String = msg.GroupID
 		group.Valid = true
 	}
+	var attachment sql.NullString
+	if msg.AttachmentPath != "" {
+		attachment.String = msg.AttachmentPath
+		attachment.Valid = true
+	}
 
 	stmt, err := database.DB.Prepare(`
-		INSERT INTO chat_messages (id, sender_id, recipient_id, group_id, content, created_at)
-		VALUES (?, ?, ?, ?, ?, ?)`)
+		INSERT INTO chat_messages (id, sender_id, recipient_id, group_id, content, attachment_path, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(msg.ID, msg.SenderID, recipient, group, msg.Content, msg.CreatedAt)
+	_, err = stmt.Exec(msg.ID, msg.SenderID, recipient, group, msg.Content, attachment, msg.CreatedAt)
 	return err
 }
 
 // CanUsersMessage checks if two users are allowed to chat.
-// Rules: Users can message if at least one follows the other (one-way follow is sufficient).
+// Rules: Users can message if at least one follows the other (one-way follow is sufficient)
+// and neither has blocked the other.
 func CanUsersMessage(senderID, recipientID string) (bool, error) {
 	// A user can always message themselves.
 	if senderID == recipientID {
 		return true, nil
 	}
 
+	blocked, err := IsBlockedEitherWay(senderID, recipientID)
+	if err != nil || blocked {
+		return false, err
+	}
+
 	// Check if at least one user follows the other (one-way relationship is sufficient)
 	var count int
 	query := `
 		SELECT COUNT(*) FROM followers
 		WHERE (follower_id = ? AND following_id = ?) OR (follower_id = ? AND following_id = ?)
 	`
-	err := database.DB.QueryRow(query, senderID, recipientID, recipientID, senderID).Scan(&count)
+	err = database.DB.QueryRow(query, senderID, recipientID, recipientID, senderID).Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -131,3 +149,13 @@ func GetGroupMemberIDs(groupID string) ([]string, error) {
 	}
 	return memberIDs, nil
 }
+
+// CanUserSeeMessage reports whether userID sent or received a message, either directly
+// or as a member of the group it was sent to.
+func CanUserSeeMessage(userID, messageID string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM chat_messages m WHERE m.id = ? AND (m.sender_id = ? OR m.recipient_id = ?
+		OR m.group_id IN (SELECT group_id FROM group_members WHERE user_id = ?)))`
+	err := database.DB.QueryRow(query, messageID, userID, userID, userID).Scan(&exists)
+	return exists, err
+}
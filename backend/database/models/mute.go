@@ -0,0 +1,145 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"social-network/database"
+)
+
+// MaxMutedKeywordLength caps the length of a muted keyword or hashtag.
+const MaxMutedKeywordLength = 100
+
+// ErrInvalidKeyword is returned when a muted keyword is empty or too long.
+var ErrInvalidKeyword = errors.New("keyword must be between 1 and 100 characters")
+
+// MutedUser is an entry of a user's mute list.
+type MutedUser struct {
+	UserID  string
+	MutedAt time.Time
+}
+
+// MutedKeyword is a word or hashtag a user no longer wants to see in their feed.
+type MutedKeyword struct {
+	Keyword string
+	MutedAt time.Time
+}
+
+// NotMutedCondition returns an SQL condition that is true when the content in
+// contentColumn, written by the user in userColumn, is neither by a user the viewer muted
+// nor contains one of the viewer's muted keywords. It takes the viewer's ID twice.
+// Keywords match case-insensitively as whole words or hashtags: muting "cat" doesn't hide
+// "category", and muting "#go" doesn't hide "#golang".
+func NotMutedCondition(userColumn, contentColumn string) string {
+	return `NOT EXISTS (SELECT 1 FROM user_mutes um WHERE um.muter_id = ? AND um.muted_id = ` + userColumn + `)
+		AND NOT EXISTS (SELECT 1 FROM muted_keywords mk
+			WHERE mk.user_id = ? AND instr(` + spacedWords("lower("+contentColumn+")") + `, ` + spacedWords("mk.keyword") + `) > 0)`
+}
+
+// keywordSeparators are the characters that end a word. "#" and "@" are not among them,
+// so hashtags and mentions stay whole.
+const keywordSeparators = " \t\n\r.,;:!?\"'`()[]{}<>/\\|*=~-–—…“”‘’«»"
+
+// spacedWords returns an SQL expression turning every separator in expr into a space
+// and padding the result with spaces, so a keyword prepared the same way is found in
+// content only as whole words.
+func spacedWords(expr string) string {
+	for _, r := range keywordSeparators {
+		if r == ' ' {
+			continue
+		}
+		expr = "replace(" + expr + ", " + sqlChar(r) + ", ' ')"
+	}
+	return "(' ' || " + expr + " || ' ')"
+}
+
+// sqlChar returns an SQL expression for the character r.
+func sqlChar(r rune) string {
+	if r < ' ' || r == '\'' {
+		return fmt.Sprintf("char(%d)", r)
+	}
+	return "'" + string(r) + "'"
+}
+
+// NormalizeKeyword trims and lower-cases a keyword so that the same word is only stored
+// once. A keyword needs at least one character that isn't a separator.
+func NormalizeKeyword(keyword string) (string, error) {
+	keyword = strings.ToLower(strings.TrimSpace(keyword))
+	if len(keyword) > MaxMutedKeywordLength || strings.Trim(keyword, keywordSeparators) == "" {
+		return "", ErrInvalidKeyword
+	}
+	return keyword, nil
+}
+
+// MuteUser hides mutedID's posts from muterID's feed. Unlike a block it leaves follows
+// alone and the muted user is not told. Muting someone twice is not an error.
+func MuteUser(muterID, mutedID string) error {
+	_, err := database.DB.Exec("INSERT OR IGNORE INTO user_mutes (muter_id, muted_id) VALUES (?, ?)", muterID, mutedID)
+	return err
+}
+
+// UnmuteUser removes a mute.
+func UnmuteUser(muterID, mutedID string) error {
+	_, err := database.DB.Exec("DELETE FROM user_mutes WHERE muter_id = ? AND muted_id = ?", muterID, mutedID)
+	return err
+}
+
+// ListMutedUsers returns the users muterID has muted, most recent first.
+func ListMutedUsers(muterID string) ([]MutedUser, error) {
+	rows, err := database.DB.Query("SELECT muted_id, created_at FROM user_mutes WHERE muter_id = ? ORDER BY created_at DESC", muterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var muted []MutedUser
+	for rows.Next() {
+		var m MutedUser
+		if err := rows.Scan(&m.UserID, &m.MutedAt); err != nil {
+			return nil, err
+		}
+		muted = append(muted, m)
+	}
+	return muted, rows.Err()
+}
+
+// AddMutedKeyword mutes a keyword or hashtag for userID and returns it as stored.
+func AddMutedKeyword(userID, keyword string) (string, error) {
+	keyword, err := NormalizeKeyword(keyword)
+	if err != nil {
+		return "", err
+	}
+	_, err = database.DB.Exec("INSERT OR IGNORE INTO muted_keywords (user_id, keyword) VALUES (?, ?)", userID, keyword)
+	return keyword, err
+}
+
+// RemoveMutedKeyword unmutes a keyword for userID.
+func RemoveMutedKeyword(userID, keyword string) error {
+	keyword, err := NormalizeKeyword(keyword)
+	if err != nil {
+		return err
+	}
+	_, err = database.DB.Exec("DELETE FROM muted_keywords WHERE user_id = ? AND keyword = ?", userID, keyword)
+	return err
+}
+
+// ListMutedKeywords returns the keywords userID has muted in alphabetical order.
+func ListMutedKeywords(userID string) ([]MutedKeyword, error) {
+	rows, err := database.DB.Query("SELECT keyword, created_at FROM muted_keywords WHERE user_id = ? ORDER BY keyword", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keywords []MutedKeyword
+	for rows.Next() {
+		var k MutedKeyword
+		if err := rows.Scan(&k.Keyword, &k.MutedAt); err != nil {
+			return nil, err
+		}
+		keywords = append(keywords, k)
+	}
+	return keywords, rows.Err()
+}
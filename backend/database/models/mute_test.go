@@ -0,0 +1,122 @@
+package models
+
+import (
+	"testing"
+
+	"social-network/database"
+	"social-network/database/dbtest"
+)
+
+func setupMuteTestDB(t *testing.T) {
+	dbtest.Open(t)
+	_, err := database.DB.Exec(`
+		INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth) VALUES
+			('u1', 'Alice', 'A', 'a@example.com', 'h', '2000-01-01'), ('u2', 'Bob', 'B', 'b@example.com', 'h', '2000-01-01'),
+			('u3', 'Carol', 'C', 'c@example.com', 'h', '2000-01-01');
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed users: %v", err)
+	}
+}
+
+func TestMutedUsersAndKeywordsAreFiltered(t *testing.T) {
+	setupMuteTestDB(t)
+	_, err := database.DB.Exec(`
+		INSERT INTO followers (follower_id, following_id) VALUES ('u1', 'u2');
+		INSERT INTO posts (id, user_id, content) VALUES
+			(1, 'u2', 'Hello there'), (2, 'u3', 'Loving the #GoLang meetup'), (3, 'u3', 'Quiet day');
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed tables: %v", err)
+	}
+
+	if err := MuteUser("u1", "u2"); err != nil {
+		t.Fatalf("MuteUser failed: %v", err)
+	}
+	if err := MuteUser("u1", "u2"); err != nil {
+		t.Fatalf("muting twice should not fail: %v", err)
+	}
+	keyword, err := AddMutedKeyword("u1", "  #golang ")
+	if err != nil || keyword != "#golang" {
+		t.Fatalf("AddMutedKeyword = %q, %v", keyword, err)
+	}
+	if _, err := AddMutedKeyword("u1", "   "); err != ErrInvalidKeyword {
+		t.Fatalf("empty keyword should be rejected, got %v", err)
+	}
+
+	visible := func() []int {
+		rows, err := database.DB.Query(`SELECT id FROM posts p WHERE `+NotMutedCondition("p.user_id", "p.content")+` ORDER BY id`, "u1", "u1")
+		if err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+		defer rows.Close()
+		var ids []int
+		for rows.Next() {
+			var id int
+			rows.Scan(&id)
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	if ids := visible(); len(ids) != 1 || ids[0] != 3 {
+		t.Fatalf("only the unmuted post should be visible, got %v", ids)
+	}
+	if ok, _ := AreFollowing("u1", "u2"); !ok {
+		t.Fatal("muting should not remove the follow")
+	}
+
+	if err := UnmuteUser("u1", "u2"); err != nil {
+		t.Fatalf("UnmuteUser failed: %v", err)
+	}
+	if err := RemoveMutedKeyword("u1", "#GoLang"); err != nil {
+		t.Fatalf("RemoveMutedKeyword failed: %v", err)
+	}
+	if ids := visible(); len(ids) != 3 {
+		t.Fatalf("all posts should be visible after unmuting, got %v", ids)
+	}
+	if muted, _ := ListMutedUsers("u1"); len(muted) != 0 {
+		t.Fatalf("ListMutedUsers should be empty: %v", muted)
+	}
+	if keywords, _ := ListMutedKeywords("u1"); len(keywords) != 0 {
+		t.Fatalf("ListMutedKeywords should be empty: %v", keywords)
+	}
+}
+
+func TestMutedKeywordsMatchWholeWords(t *testing.T) {
+	setupMuteTestDB(t)
+	_, err := database.DB.Exec(`
+		INSERT INTO posts (id, user_id, content) VALUES
+			(1, 'u2', 'Pick a category for your vacation photos'),
+			(2, 'u2', 'My cat''s new bed'),
+			(3, 'u2', 'Look at this CAT!'),
+			(4, 'u2', 'Excited about #golang'),
+			(5, 'u2', 'Writing some #Go, today'),
+			(6, 'u2', 'Moving to New York soon');
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed tables: %v", err)
+	}
+	for _, k := range []string{"cat", "#go", "new york"} {
+		if _, err := AddMutedKeyword("u1", k); err != nil {
+			t.Fatalf("AddMutedKeyword(%q) failed: %v", k, err)
+		}
+	}
+	if _, err := AddMutedKeyword("u1", " ... "); err != ErrInvalidKeyword {
+		t.Fatalf("a keyword of only punctuation should be rejected, got %v", err)
+	}
+
+	rows, err := database.DB.Query(`SELECT id FROM posts p WHERE `+NotMutedCondition("p.user_id", "p.content")+` ORDER BY id`, "u1", "u1")
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 4 {
+		t.Fatalf("muted keywords should only hide whole words and hashtags, visible posts: %v", ids)
+	}
+}
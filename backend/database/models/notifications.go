@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"social-network/database" 
 	"time"
 
@@ -15,12 +16,25 @@ type Notification struct {
 	ActorID   string
 	Type      string
 	Message   string
+	Link      string // Optional URL the notification leads to
 	Read      bool
 	CreatedAt time.Time
 }
 
+// ErrNotificationSuppressed is returned by CreateNotification when the recipient and the
+// actor have blocked each other, so nothing was saved.
+var ErrNotificationSuppressed = errors.New("notification suppressed by a block")
+
 // CreateNotification creates and saves a new notification to the database.
 func CreateNotification(notif *Notification) error {
+	blocked, err := IsBlockedEitherWay(notif.UserID, notif.ActorID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrNotificationSuppressed
+	}
+
 	notif.ID = uuid.NewString() // Generate a unique ID
 
 	var actorID sql.NullString
@@ -29,22 +43,28 @@ func CreateNotification(notif *Notification) error {
 		actorID.Valid = true
 	}
 
+	var link sql.NullString
+	if notif.Link != "" {
+		link.String = notif.Link
+		link.Valid = true
+	}
+
 	stmt, err := database.DB.Prepare(`
-		INSERT INTO notifications (id, user_id, actor_id, type, message, read)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO notifications (id, user_id, actor_id, type, message, link, read)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(notif.ID, notif.UserID, actorID, notif.Type, notif.Message, notif.Read)
+	_, err = stmt.Exec(notif.ID, notif.UserID, actorID, notif.Type, notif.Message, link, notif.Read)
 	return err
 }
 
 // GetNotificationsForUser fetches all notifications for a specific user.
 func GetNotificationsForUser(userID string) ([]Notification, error) {
-	query := "SELECT id, user_id, actor_id, type, message, read, created_at FROM notifications WHERE user_id = ? ORDER BY created_at DESC"
+	query := "SELECT id, user_id, actor_id, type, message, link, read, created_at FROM notifications WHERE user_id = ? ORDER BY created_at DESC"
 	rows, err := database.DB.Query(query, userID)
 	if err != nil {
 		return nil, err
@@ -54,7 +74,7 @@ func GetNotificationsForUser(userID string) ([]Notification, error) {
 	var notifications []Notification
 	for rows.Next() {
 		var notif Notification
-		var actorID sql.NullString
+		var actorID, link sql.NullString
 
 		// This is the clean, correct scan line.
 		err := rows.Scan(
@@ -63,6 +83,7 @@ func GetNotificationsForUser(userID string) ([]Notification, error) {
 			&actorID,
 			&notif.Type,
 			&notif.Message,
+			&link,
 			&notif.Read,
 			&notif.CreatedAt,
 		)
@@ -74,6 +95,7 @@ func GetNotificationsForUser(userID string) ([]Notification, error) {
 		if actorID.Valid {
 			notif.ActorID = actorID.String
 		}
+		notif.Link = link.String
 
 		notifications = append(notifications, notif)
 	}
@@ -1,37 +1,15 @@
 package models
 
 import (
-	"database/sql"
 	"testing"
-	"social-network/database"
-	_ "github.com/mattn/go-sqlite3"
+
+	"social-network/database/dbtest"
 )
 
 func setupNotifTestDB(t *testing.T) {
-	db, err := sql.Open("sqlite3", ":memory:")
-	if err != nil {
-		t.Fatalf("failed to open test db: %v", err)
-	}
-	database.DB = db
-	_, err = db.Exec(`
-		CREATE TABLE users (
-			id TEXT PRIMARY KEY,
-			first_name TEXT
-		);
-		CREATE TABLE notifications (
-			id TEXT PRIMARY KEY,
-			user_id TEXT,
-			actor_id TEXT,
-			type TEXT,
-			message TEXT,
-			read INTEGER,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);
-	`)
-	if err != nil {
-		t.Fatalf("failed to create tables: %v", err)
-	}
-	_, err = db.Exec(`INSERT INTO users (id, first_name) VALUES ('u1', 'Alice'), ('u2', 'Bob')`)
+	db := dbtest.Open(t)
+	_, err := db.Exec(`INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth) VALUES
+		('u1', 'Alice', 'A', 'a@example.com', 'h', '2000-01-01'), ('u2', 'Bob', 'B', 'b@example.com', 'h', '2000-01-01')`)
 	if err != nil {
 		t.Fatalf("failed to insert users: %v", err)
 	}
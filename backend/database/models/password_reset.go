@@ -0,0 +1,114 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"social-network/database"
+)
+
+// ErrInvalidResetToken is returned for a password reset token that doesn't exist, has
+// expired or has already been used.
+var ErrInvalidResetToken = errors.New("this password reset link is invalid or has expired")
+
+// CreatePasswordResetToken stores the hash of a new reset token for userID. Any earlier
+// token the user hasn't used yet stops working, so only the latest email is valid.
+func CreatePasswordResetToken(userID, tokenHash string, now, expiresAt time.Time) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE password_reset_tokens SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now.UTC(), userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO password_reset_tokens (token_hash, user_id, created_at, expires_at) VALUES (?, ?, ?, ?)",
+		tokenHash, userID, now.UTC(), expiresAt.UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// LastPasswordResetRequest returns when userID last asked for a reset email, or the zero
+// time if they never did.
+func LastPasswordResetRequest(userID string) (time.Time, error) {
+	var last time.Time
+	err := database.DB.QueryRow("SELECT created_at FROM password_reset_tokens WHERE user_id = ? ORDER BY created_at DESC LIMIT 1", userID).Scan(&last)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return last, err
+}
+
+// ResetPassword uses the reset token with tokenHash to replace its user's password,
+// signs them out everywhere and returns their ID. The token can only be used once; it
+// returns ErrInvalidResetToken if it is unknown, used or expired.
+func ResetPassword(tokenHash, passwordHash string, now time.Time) (string, error) {
+	now = now.UTC()
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRow(`
+		UPDATE password_reset_tokens SET used_at = ?
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING user_id`, now, tokenHash, now).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidResetToken
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := tx.Exec("UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, userID); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec("UPDATE password_reset_tokens SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now, userID); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return "", err
+	}
+	return userID, tx.Commit()
+}
+
+// ChangePassword replaces userID's password, cancels any reset links they were sent and
+// signs them out of every session except the one with keepToken. It returns the tokens
+// of the sessions it removed.
+func ChangePassword(userID, passwordHash, keepToken string, now time.Time) ([]string, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, userID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE password_reset_tokens SET used_at = ? WHERE user_id = ? AND used_at IS NULL", now.UTC(), userID); err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query("DELETE FROM sessions WHERE user_id = ? AND token != ? RETURNING token", userID, keepToken)
+	if err != nil {
+		return nil, err
+	}
+	var revoked []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		revoked = append(revoked, token)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return revoked, tx.Commit()
+}
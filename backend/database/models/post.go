@@ -10,19 +10,28 @@ type Post struct {
 	ImageURL  string    `json:"image_url,omitempty"`
 	Privacy   string    `json:"privacy"` // 'public', 'almost_private', 'private'
 	CreatedAt time.Time `json:"created_at"`
+
+	// Scaled copies of the image, derived from ImageURL rather than stored.
+	// For an animated GIF these are static previews of its first frame.
+	ImageThumbnail string `json:"image_thumbnail,omitempty"`
+	ImageMedium    string `json:"image_medium,omitempty"`
+	ImageAnimated  bool   `json:"image_animated,omitempty"`
 }
 
 // Comment represents a comment on a post.
 type Comment struct {
-	ID                int       `json:"id"`
-	PostID            int       `json:"post_id"`
-	UserID            string      `json:"user_id"`
-	Content           string    `json:"content"`
-	ImageURL          string    `json:"image_url,omitempty"`
-	CreatedAt         time.Time `json:"created_at"`
-	LikeCount         int       `json:"like_count"`
-	DislikeCount      int       `json:"dislike_count"`
-	CurrentUserLikeType int     `json:"current_user_like_type"` // 1 for like, -1 for dislike, 0 for none
+	ID                  int       `json:"id"`
+	PostID              int       `json:"post_id"`
+	UserID              string    `json:"user_id"`
+	Content             string    `json:"content"`
+	ImageURL            string    `json:"image_url,omitempty"`
+	ImageThumbnail      string    `json:"image_thumbnail,omitempty"`
+	ImageMedium         string    `json:"image_medium,omitempty"`
+	ImageAnimated       bool      `json:"image_animated,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+	LikeCount           int       `json:"like_count"`
+	DislikeCount        int       `json:"dislike_count"`
+	CurrentUserLikeType int       `json:"current_user_like_type"` // 1 for like, -1 for dislike, 0 for none
 }
 
 // PostWithAuthor is a special struct used for sending feed data to the frontend.
@@ -30,12 +39,12 @@ type Comment struct {
 type PostWithAuthor struct {
 	Post // Embeds all fields from the Post struct (ID, Content, etc.)
 
-	AuthorFirstName     string `json:"author_first_name"`
-	AuthorLastName      string `json:"author_last_name"`
-	AuthorNickname      string `json:"author_nickname,omitempty"`
-	AuthorAvatarURL     string `json:"author_avatar_url,omitempty"`
+	AuthorFirstName string `json:"author_first_name"`
+	AuthorLastName  string `json:"author_last_name"`
+	AuthorNickname  string `json:"author_nickname,omitempty"`
+	AuthorAvatarURL string `json:"author_avatar_url,omitempty"`
 
 	LikeCount           int `json:"like_count"`
 	DislikeCount        int `json:"dislike_count"`
 	CurrentUserLikeType int `json:"current_user_like_type"` // 1 for like, -1 for dislike, 0 for none
-}
\ No newline at end of file
+}
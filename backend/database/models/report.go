@@ -0,0 +1,329 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"social-network/database"
+
+	"github.com/google/uuid"
+)
+
+// What a report can be about.
+const (
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+	ReportTargetMessage = "message"
+	ReportTargetUser    = "user"
+)
+
+// Statuses of a report in the moderation queue.
+const (
+	ReportOpen     = "open"
+	ReportInReview = "in_review"
+	ReportResolved = "resolved"
+)
+
+// How a moderator resolved a report.
+const (
+	ResolutionDismissed      = "dismissed"
+	ResolutionContentRemoved = "content_removed"
+	ResolutionUserSuspended  = "user_suspended"
+)
+
+var reportReasons = map[string]bool{
+	"spam": true, "harassment": true, "hate": true, "violence": true,
+	"nudity": true, "misinformation": true, "other": true,
+}
+
+var (
+	// ErrDuplicateReport is returned when a user reports something they already have an unresolved report about.
+	ErrDuplicateReport = errors.New("you have already reported this")
+	// ErrReportResolved is returned when a resolved report is triaged or resolved again.
+	ErrReportResolved = errors.New("report is already resolved")
+)
+
+// IsValidReportTarget reports whether t is something that can be reported.
+func IsValidReportTarget(t string) bool {
+	return t == ReportTargetPost || t == ReportTargetComment || t == ReportTargetMessage || t == ReportTargetUser
+}
+
+// IsValidReportReason reports whether reason is one of the reasons a user can pick.
+func IsValidReportReason(reason string) bool {
+	return reportReasons[reason]
+}
+
+// Report represents a row of the 'reports' table.
+type Report struct {
+	ID            string     `json:"id"`
+	ReporterID    string     `json:"reporterId"`
+	TargetType    string     `json:"targetType"`
+	TargetID      string     `json:"targetId"`
+	TargetUserID  string     `json:"targetUserId,omitempty"`
+	Reason        string     `json:"reason"`
+	Details       string     `json:"details,omitempty"`
+	Status        string     `json:"status"`
+	Resolution    string     `json:"resolution,omitempty"`
+	ModeratorID   string     `json:"moderatorId,omitempty"`
+	ModeratorNote string     `json:"moderatorNote,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	ResolvedAt    *time.Time `json:"resolvedAt,omitempty"`
+}
+
+const reportColumns = `id, reporter_id, target_type, target_id, target_user_id, reason, details, status,
+	resolution, moderator_id, moderator_note, created_at, resolved_at`
+
+func scanReport(row interface{ Scan(...interface{}) error }) (*Report, error) {
+	r := &Report{}
+	var targetUser, details, resolution, moderator, note sql.NullString
+	var resolved sql.NullTime
+	if err := row.Scan(&r.ID, &r.ReporterID, &r.TargetType, &r.TargetID, &targetUser, &r.Reason, &details, &r.Status,
+		&resolution, &moderator, &note, &r.CreatedAt, &resolved); err != nil {
+		return nil, err
+	}
+	r.TargetUserID = targetUser.String
+	r.Details = details.String
+	r.Resolution = resolution.String
+	r.ModeratorID = moderator.String
+	r.ModeratorNote = note.String
+	if resolved.Valid {
+		r.ResolvedAt = &resolved.Time
+	}
+	return r, nil
+}
+
+// GetReportTargetOwner returns the author of the reported post, comment or message, or
+// the reported user themselves. It returns "" if the target does not exist.
+func GetReportTargetOwner(targetType, targetID string) (string, error) {
+	var query string
+	switch targetType {
+	case ReportTargetPost:
+		query = "SELECT user_id FROM posts WHERE id = ?"
+	case ReportTargetComment:
+		query = "SELECT user_id FROM comments WHERE id = ?"
+	case ReportTargetMessage:
+		query = "SELECT sender_id FROM chat_messages WHERE id = ?"
+	case ReportTargetUser:
+		query = "SELECT id FROM users WHERE id = ?"
+	default:
+		return "", nil
+	}
+	var owner sql.NullString
+	err := database.DB.QueryRow(query, targetID).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return owner.String, err
+}
+
+// CreateReport files a new open report. It returns ErrDuplicateReport if the reporter
+// already has an unresolved report about the same target.
+func CreateReport(report *Report) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM reports WHERE reporter_id = ? AND target_type = ? AND target_id = ? AND status != ?)",
+		report.ReporterID, report.TargetType, report.TargetID, ReportResolved).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrDuplicateReport
+	}
+
+	report.ID = uuid.NewString()
+	report.Status = ReportOpen
+	report.CreatedAt = time.Now().UTC()
+	if _, err := tx.Exec(`INSERT INTO reports (id, reporter_id, target_type, target_id, target_user_id, reason, details, status, created_at)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), ?, NULLIF(?, ''), ?, ?)`,
+		report.ID, report.ReporterID, report.TargetType, report.TargetID, report.TargetUserID, report.Reason, report.Details,
+		report.Status, report.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetReport retrieves a report by ID. Returns nil if there is none.
+func GetReport(reportID string) (*Report, error) {
+	report, err := scanReport(database.DB.QueryRow("SELECT "+reportColumns+" FROM reports WHERE id = ?", reportID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return report, err
+}
+
+// ListReports returns the reports with the given status, oldest first, so the queue is
+// worked through in order. An empty status lists every report that is not resolved yet.
+func ListReports(status string, limit, offset int) ([]*Report, error) {
+	query := "SELECT " + reportColumns + " FROM reports WHERE status = ? ORDER BY created_at, id LIMIT ? OFFSET ?"
+	args := []interface{}{status, limit, offset}
+	if status == "" {
+		query = "SELECT " + reportColumns + " FROM reports WHERE status != ? ORDER BY created_at, id LIMIT ? OFFSET ?"
+		args[0] = ReportResolved
+	}
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []*Report{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+// TriageReport marks a report as being reviewed by moderatorID.
+func TriageReport(reportID, moderatorID string) error {
+	res, err := database.DB.Exec("UPDATE reports SET status = ?, moderator_id = ? WHERE id = ? AND status != ?",
+		ReportInReview, moderatorID, reportID, ReportResolved)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = ErrReportResolved
+	}
+	return err
+}
+
+// ResolveReport closes a report with the moderator's decision and returns every report
+// that was closed by it. Dismissing only closes the given report; removing the content or
+// suspending its author also closes every other unresolved report about the same target,
+// since there is nothing left to review.
+func ResolveReport(reportID, moderatorID, resolution, note string, resolvedAt time.Time) ([]*Report, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	report, err := scanReport(tx.QueryRow("SELECT "+reportColumns+" FROM reports WHERE id = ?", reportID))
+	if err != nil {
+		return nil, err
+	}
+	if report.Status == ReportResolved {
+		return nil, ErrReportResolved
+	}
+
+	query := "SELECT " + reportColumns + " FROM reports WHERE id = ?"
+	args := []interface{}{reportID}
+	if resolution != ResolutionDismissed {
+		query = "SELECT " + reportColumns + " FROM reports WHERE target_type = ? AND target_id = ? AND status != ?"
+		args = []interface{}{report.TargetType, report.TargetID, ReportResolved}
+	}
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var closed []*Report
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		closed = append(closed, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	at := resolvedAt.UTC()
+	for _, r := range closed {
+		if _, err := tx.Exec(`UPDATE reports SET status = ?, resolution = ?, moderator_id = ?, moderator_note = NULLIF(?, ''), resolved_at = ?
+			WHERE id = ?`, ReportResolved, resolution, moderatorID, note, at, r.ID); err != nil {
+			return nil, err
+		}
+		r.Status, r.Resolution, r.ModeratorID, r.ModeratorNote, r.ResolvedAt = ReportResolved, resolution, moderatorID, note, &at
+	}
+	return closed, tx.Commit()
+}
+
+// RemoveContent deletes a post (with its comments and likes), a comment (with its likes)
+// or a chat message, and reports whether it existed. It also returns the media paths the
+// deleted rows referenced, once per reference, so the caller can release the files after
+// the transaction has committed.
+func RemoveContent(targetType, targetID string) (bool, []string, error) {
+	var mediaQueries, steps []string
+	switch targetType {
+	case ReportTargetPost:
+		mediaQueries = []string{
+			"SELECT image_url FROM posts WHERE id = ?1",
+			"SELECT image_url FROM comments WHERE post_id = ?1",
+		}
+		steps = []string{
+			"DELETE FROM comment_likes WHERE comment_id IN (SELECT id FROM comments WHERE post_id = ?1)",
+			"DELETE FROM comments WHERE post_id = ?1",
+			"DELETE FROM post_likes WHERE post_id = ?1",
+			"DELETE FROM post_allowed_users WHERE post_id = ?1",
+			"DELETE FROM posts WHERE id = ?1",
+		}
+	case ReportTargetComment:
+		mediaQueries = []string{"SELECT image_url FROM comments WHERE id = ?1"}
+		steps = []string{
+			"DELETE FROM comment_likes WHERE comment_id = ?1",
+			"DELETE FROM comments WHERE id = ?1",
+		}
+	case ReportTargetMessage:
+		mediaQueries = []string{"SELECT attachment_path FROM chat_messages WHERE id = ?1"}
+		steps = []string{"DELETE FROM chat_messages WHERE id = ?1"}
+	default:
+		return false, nil, errors.New("only posts, comments and messages can be removed")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return false, nil, err
+	}
+	defer tx.Rollback()
+
+	var media []string
+	for _, query := range mediaQueries {
+		rows, err := tx.Query(query, targetID)
+		if err != nil {
+			return false, nil, err
+		}
+		for rows.Next() {
+			var p sql.NullString
+			if err := rows.Scan(&p); err != nil {
+				rows.Close()
+				return false, nil, err
+			}
+			if p.String != "" {
+				media = append(media, p.String)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return false, nil, err
+		}
+	}
+
+	// The last step deletes the content itself.
+	var removed int64
+	for _, query := range steps {
+		res, err := tx.Exec(query, targetID)
+		if err != nil {
+			return false, nil, err
+		}
+		if removed, err = res.RowsAffected(); err != nil {
+			return false, nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, nil, err
+	}
+	return removed > 0, media, nil
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"social-network/database"
+	"social-network/database/dbtest"
+)
+
+func setupReportTestDB(t *testing.T) {
+	dbtest.Open(t)
+	_, err := database.DB.Exec(`
+		INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth, is_public) VALUES
+			('u1', 'Alice', 'A', 'a@example.com', 'h', '2000-01-01', 1), ('u2', 'Bob', 'B', 'b@example.com', 'h', '2000-01-01', 1),
+			('u3', 'Carol', 'C', 'c@example.com', 'h', '2000-01-01', 1), ('mod', 'Mo', 'M', 'm@example.com', 'h', '2000-01-01', 1);
+		INSERT INTO posts (id, user_id, content, image_url) VALUES (1, 'u3', 'spam spam spam', 'post.png');
+		INSERT INTO comments (id, post_id, user_id, content, image_url) VALUES (10, 1, 'u1', 'so true', 'comment.png');
+		INSERT INTO post_likes (user_id, post_id, like_type) VALUES ('u2', 1, 1);
+		INSERT INTO sessions (token, user_id, expiry) VALUES ('t3', 'u3', '2099-01-01');
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed tables: %v", err)
+	}
+}
+
+func TestReportLifecycle(t *testing.T) {
+	setupReportTestDB(t)
+
+	owner, err := GetReportTargetOwner(ReportTargetPost, "1")
+	if err != nil || owner != "u3" {
+		t.Fatalf("GetReportTargetOwner = %q, %v", owner, err)
+	}
+	if owner, _ := GetReportTargetOwner(ReportTargetPost, "99"); owner != "" {
+		t.Fatalf("missing post should have no owner, got %q", owner)
+	}
+
+	first := &Report{ReporterID: "u1", TargetType: ReportTargetPost, TargetID: "1", TargetUserID: "u3", Reason: "spam"}
+	second := &Report{ReporterID: "u2", TargetType: ReportTargetPost, TargetID: "1", TargetUserID: "u3", Reason: "other"}
+	for _, r := range []*Report{first, second} {
+		if err := CreateReport(r); err != nil {
+			t.Fatalf("CreateReport failed: %v", err)
+		}
+	}
+	if err := CreateReport(&Report{ReporterID: "u1", TargetType: ReportTargetPost, TargetID: "1", Reason: "hate"}); err != ErrDuplicateReport {
+		t.Fatalf("second report by the same user should be a duplicate, got %v", err)
+	}
+
+	if err := TriageReport(first.ID, "mod"); err != nil {
+		t.Fatalf("TriageReport failed: %v", err)
+	}
+	if open, _ := ListReports(ReportOpen, 10, 0); len(open) != 1 || open[0].ID != second.ID {
+		t.Fatalf("only the untriaged report should be open: %+v", open)
+	}
+	if unresolved, _ := ListReports("", 10, 0); len(unresolved) != 2 {
+		t.Fatalf("both reports should be unresolved: %+v", unresolved)
+	}
+
+	removed, media, err := RemoveContent(ReportTargetPost, "1")
+	if err != nil || !removed {
+		t.Fatalf("RemoveContent = %v, %v", removed, err)
+	}
+	if len(media) != 2 || media[0] != "post.png" || media[1] != "comment.png" {
+		t.Fatalf("RemoveContent should return the post's and its comments' images, got %v", media)
+	}
+	for _, table := range []string{"posts", "comments", "post_likes"} {
+		if n := countRows(t, "SELECT COUNT(*) FROM "+table); n != 0 {
+			t.Fatalf("%s should be empty after removing the post, %d left", table, n)
+		}
+	}
+
+	closed, err := ResolveReport(first.ID, "mod", ResolutionContentRemoved, "", time.Now())
+	if err != nil || len(closed) != 2 {
+		t.Fatalf("removing content should close every report about it: %v, %v", closed, err)
+	}
+	if got, _ := GetReport(second.ID); got.Status != ReportResolved || got.Resolution != ResolutionContentRemoved || got.ResolvedAt == nil {
+		t.Fatalf("sibling report not resolved: %+v", got)
+	}
+	if _, err := ResolveReport(first.ID, "mod", ResolutionDismissed, "", time.Now()); err != ErrReportResolved {
+		t.Fatalf("resolving twice should fail, got %v", err)
+	}
+	if err := TriageReport(first.ID, "mod"); err != ErrReportResolved {
+		t.Fatalf("triaging a resolved report should fail, got %v", err)
+	}
+}
+
+func TestDismissOnlyClosesOneReport(t *testing.T) {
+	setupReportTestDB(t)
+	first := &Report{ReporterID: "u1", TargetType: ReportTargetUser, TargetID: "u3", TargetUserID: "u3", Reason: "harassment"}
+	second := &Report{ReporterID: "u2", TargetType: ReportTargetUser, TargetID: "u3", TargetUserID: "u3", Reason: "harassment"}
+	CreateReport(first)
+	CreateReport(second)
+
+	closed, err := ResolveReport(first.ID, "mod", ResolutionDismissed, "not harassment", time.Now())
+	if err != nil || len(closed) != 1 || closed[0].ID != first.ID {
+		t.Fatalf("dismissing should only close that report: %v, %v", closed, err)
+	}
+	if got, _ := GetReport(second.ID); got.Status != ReportOpen {
+		t.Fatalf("other report should stay open: %+v", got)
+	}
+}
+
+func TestSuspendAccount(t *testing.T) {
+	setupReportTestDB(t)
+	now := time.Now()
+
+	if s, err := GetActiveSuspension("u3", now); err != nil || s != nil {
+		t.Fatalf("user should not start suspended: %+v, %v", s, err)
+	}
+	if err := SuspendAccount("u3", now.Add(48*time.Hour), "spam"); err != nil {
+		t.Fatalf("SuspendAccount failed: %v", err)
+	}
+	if n := countRows(t, "SELECT COUNT(*) FROM sessions WHERE user_id = 'u3'"); n != 0 {
+		t.Fatalf("sessions should be revoked, %d left", n)
+	}
+	s, err := GetActiveSuspension("u3", now)
+	if err != nil || s == nil || s.Reason != "spam" {
+		t.Fatalf("GetActiveSuspension = %+v, %v", s, err)
+	}
+	if s, _ := GetActiveSuspension("u3", now.Add(72*time.Hour)); s != nil {
+		t.Fatalf("suspension should have run out: %+v", s)
+	}
+	if u, _ := GetUserByID("u3"); u == nil || u.ActiveSuspension(now) == nil || u.ActiveSuspension(now.Add(72*time.Hour)) != nil {
+		t.Fatalf("loaded user should carry the suspension: %+v", u)
+	}
+
+	if err := SuspendAccount("u3", BanUntil, ""); err != nil {
+		t.Fatalf("SuspendAccount (ban) failed: %v", err)
+	}
+	s, _ = GetActiveSuspension("u3", now)
+	if s == nil || !s.Permanent() || s.Message() != "Your account has been banned." {
+		t.Fatalf("ban not recorded: %+v", s)
+	}
+	if lifted, err := LiftSuspension("u3", now); err != nil || !lifted {
+		t.Fatalf("LiftSuspension = %v, %v", lifted, err)
+	}
+	if s, _ := GetActiveSuspension("u3", now); s != nil {
+		t.Fatalf("suspension should be lifted: %+v", s)
+	}
+}
@@ -4,13 +4,34 @@ import (
 	"database/sql"
 	"social-network/database"
 	"time"
+
+	"github.com/google/uuid"
 )
 
-// Session represents the structure of the 'sessions' table.
+// SessionTouchInterval is how often a session's last use is written back, so that
+// busy clients don't turn every request into a write.
+const SessionTouchInterval = time.Minute
+
+// Session represents the structure of the 'sessions' table. The token is the secret
+// kept in the cookie and never leaves the server otherwise; the API refers to sessions
+// by ID.
 type Session struct {
-	Token     string
-	UserID    string
-	ExpiresAt time.Time
+	ID         string    `json:"id"`
+	Token      string    `json:"-"`
+	UserID     string    `json:"-"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	IPAddress  string    `json:"ipAddress,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+}
+
+const sessionColumns = "id, token, user_id, expiry, created_at, last_used_at, COALESCE(ip_address, ''), COALESCE(user_agent, '')"
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*Session, error) {
+	s := &Session{}
+	err := row.Scan(&s.ID, &s.Token, &s.UserID, &s.ExpiresAt, &s.CreatedAt, &s.LastUsedAt, &s.IPAddress, &s.UserAgent)
+	return s, err
 }
 
 // IsExpired checks if the session has expired.
@@ -18,24 +39,34 @@ func (s *Session) IsExpired() bool {
 	return s.ExpiresAt.Before(time.Now())
 }
 
-// CreateSession inserts a new session into the database.
+// CreateSession inserts a new session into the database, filling in its ID and
+// timestamps if they are not set.
 func CreateSession(session *Session) error {
-	stmt, err := database.DB.Prepare("INSERT INTO sessions (token, user_id, expiry) VALUES (?, ?, ?)")
+	if session.ID == "" {
+		session.ID = uuid.NewString()
+	}
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now().UTC()
+	}
+	if session.LastUsedAt.IsZero() {
+		session.LastUsedAt = session.CreatedAt
+	}
+
+	stmt, err := database.DB.Prepare(`INSERT INTO sessions (id, token, user_id, expiry, created_at, last_used_at, ip_address, user_agent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(session.Token, session.UserID, session.ExpiresAt)
+	_, err = stmt.Exec(session.ID, session.Token, session.UserID, session.ExpiresAt, session.CreatedAt,
+		session.LastUsedAt, session.IPAddress, session.UserAgent)
 	return err
 }
 
 // GetSessionByToken retrieves a session by its token. Returns nil if no session is found.
 func GetSessionByToken(token string) (*Session, error) {
-	session := &Session{}
-	err := database.DB.QueryRow("SELECT token, user_id, expiry FROM sessions WHERE token = ?", token).
-		Scan(&session.Token, &session.UserID, &session.ExpiresAt)
-
+	session, err := scanSession(database.DB.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE token = ?", token))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -45,8 +76,103 @@ func GetSessionByToken(token string) (*Session, error) {
 	return session, nil
 }
 
+// TouchSession records that a session was used at now from the given address and
+// browser, and moves its expiry to expiresAt. It only writes if the last recorded use
+// is older than SessionTouchInterval, and reports whether it did.
+func TouchSession(token, ipAddress, userAgent string, now, expiresAt time.Time) (bool, error) {
+	now = now.UTC()
+	res, err := database.DB.Exec(`
+		UPDATE sessions SET last_used_at = ?, ip_address = ?, user_agent = ?, expiry = ?
+		WHERE token = ? AND (last_used_at IS NULL OR last_used_at < ?)`,
+		now, ipAddress, userAgent, expiresAt.UTC(), token, now.Add(-SessionTouchInterval))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ListSessionsForUser returns a user's unexpired sessions, most recently used first.
+func ListSessionsForUser(userID string) ([]*Session, error) {
+	rows, err := database.DB.Query(`
+		SELECT `+sessionColumns+` FROM sessions
+		WHERE user_id = ? AND expiry > CURRENT_TIMESTAMP
+		ORDER BY last_used_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
 // DeleteSession removes a session from the database (used for logout).
 func DeleteSession(token string) error {
 	_, err := database.DB.Exec("DELETE FROM sessions WHERE token = ?", token)
 	return err
 }
+
+// DeleteSessionByID signs a user out of one of their sessions and returns its token,
+// or "" if the user has no session with that ID.
+func DeleteSessionByID(userID, sessionID string) (string, error) {
+	var token string
+	err := database.DB.QueryRow("DELETE FROM sessions WHERE id = ? AND user_id = ? RETURNING token", sessionID, userID).Scan(&token)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return token, err
+}
+
+// DeleteOtherSessions signs a user out of every session except the one with keepToken
+// and returns the tokens of the sessions it removed.
+func DeleteOtherSessions(userID, keepToken string) ([]string, error) {
+	rows, err := database.DB.Query("DELETE FROM sessions WHERE user_id = ? AND token != ? RETURNING token", userID, keepToken)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteExpiredSessions removes every session that expired before now and returns how
+// many were removed.
+func DeleteExpiredSessions(now time.Time) (int64, error) {
+	res, err := database.DB.Exec("DELETE FROM sessions WHERE expiry <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CountActiveSessions returns how many sessions are still valid at now.
+func CountActiveSessions(now time.Time) (int64, error) {
+	var n int64
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM sessions WHERE expiry > ?", now.UTC()).Scan(&n)
+	return n, err
+}
+
+// DeleteSessionsForUser signs a user out everywhere and returns how many sessions were removed.
+func DeleteSessionsForUser(userID string) (int64, error) {
+	res, err := database.DB.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
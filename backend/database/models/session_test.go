@@ -0,0 +1,118 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"social-network/database"
+	"social-network/database/dbtest"
+)
+
+func setupSessionTestDB(t *testing.T) {
+	dbtest.Open(t)
+	_, err := database.DB.Exec(`
+		INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth) VALUES
+			('u1', 'Alice', 'A', 'a@example.com', 'old', '2000-01-01'), ('u2', 'Bob', 'B', 'b@example.com', 'other', '2000-01-01');
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed users: %v", err)
+	}
+}
+
+func TestSessionListingAndRevocation(t *testing.T) {
+	setupSessionTestDB(t)
+	expiry := time.Now().Add(time.Hour)
+	old := time.Now().Add(-time.Hour).UTC()
+
+	sessions := []*Session{
+		{Token: "laptop", UserID: "u1", ExpiresAt: expiry, CreatedAt: old, IPAddress: "10.0.0.1", UserAgent: "Firefox"},
+		{Token: "phone", UserID: "u1", ExpiresAt: expiry, IPAddress: "10.0.0.2", UserAgent: "Safari"},
+		{Token: "tablet", UserID: "u1", ExpiresAt: expiry},
+		{Token: "stale", UserID: "u1", ExpiresAt: time.Now().Add(-time.Hour)},
+		{Token: "other", UserID: "u2", ExpiresAt: expiry},
+	}
+	for _, s := range sessions {
+		if err := CreateSession(s); err != nil {
+			t.Fatalf("CreateSession failed: %v", err)
+		}
+		if s.ID == "" || s.ID == s.Token {
+			t.Fatalf("session should get its own ID: %+v", s)
+		}
+	}
+
+	listed, err := ListSessionsForUser("u1")
+	if err != nil || len(listed) != 3 {
+		t.Fatalf("ListSessionsForUser = %v, %v", listed, err)
+	}
+	if listed[2].Token != "laptop" || listed[2].IPAddress != "10.0.0.1" || listed[2].UserAgent != "Firefox" {
+		t.Fatalf("least recently used session should come last with its details: %+v", listed[2])
+	}
+
+	renewed := time.Now().Add(2 * time.Hour)
+	if ok, err := TouchSession("laptop", "10.0.0.9", "Chrome", time.Now(), renewed); err != nil || !ok {
+		t.Fatalf("TouchSession = %v, %v", ok, err)
+	}
+	s, _ := GetSessionByToken("laptop")
+	if s.IPAddress != "10.0.0.9" || s.UserAgent != "Chrome" || !s.ExpiresAt.Equal(renewed.UTC()) {
+		t.Fatalf("touching an idle session should record where it was used and renew it: %+v", s)
+	}
+	if ok, _ := TouchSession("laptop", "10.0.0.10", "Chrome", time.Now(), renewed); ok {
+		t.Fatal("touching a recently used session should not write")
+	}
+
+	if token, err := DeleteSessionByID("u2", sessions[1].ID); err != nil || token != "" {
+		t.Fatalf("users must not revoke each other's sessions: %q, %v", token, err)
+	}
+	if token, err := DeleteSessionByID("u1", sessions[1].ID); err != nil || token != "phone" {
+		t.Fatalf("DeleteSessionByID = %q, %v", token, err)
+	}
+
+	revoked, err := DeleteOtherSessions("u1", "laptop")
+	if err != nil || len(revoked) != 2 {
+		t.Fatalf("DeleteOtherSessions = %v, %v", revoked, err)
+	}
+	if n := countRows(t, "SELECT COUNT(*) FROM sessions"); n != 2 {
+		t.Fatalf("only the kept session and the other user's session should remain, got %d", n)
+	}
+}
+
+func TestDeleteExpiredSessions(t *testing.T) {
+	setupSessionTestDB(t)
+	now := time.Now()
+	for token, expiry := range map[string]time.Time{"a": now.Add(-time.Hour), "b": now.Add(-time.Minute), "c": now.Add(time.Hour)} {
+		if err := CreateSession(&Session{Token: token, UserID: "u1", ExpiresAt: expiry.UTC()}); err != nil {
+			t.Fatalf("CreateSession failed: %v", err)
+		}
+	}
+
+	if n, err := DeleteExpiredSessions(now); err != nil || n != 2 {
+		t.Fatalf("DeleteExpiredSessions = %d, %v", n, err)
+	}
+	if n, err := CountActiveSessions(now); err != nil || n != 1 {
+		t.Fatalf("CountActiveSessions = %d, %v", n, err)
+	}
+}
+
+func TestChangePasswordKeepsCurrentSession(t *testing.T) {
+	setupSessionTestDB(t)
+	now := time.Now()
+	for _, s := range []*Session{{Token: "here", UserID: "u1"}, {Token: "there", UserID: "u1"}, {Token: "theirs", UserID: "u2"}} {
+		s.ExpiresAt = now.Add(time.Hour)
+		CreateSession(s)
+	}
+	CreatePasswordResetToken("u1", "pending", now, now.Add(time.Hour))
+
+	revoked, err := ChangePassword("u1", "new", "here", now)
+	if err != nil || len(revoked) != 1 || revoked[0] != "there" {
+		t.Fatalf("ChangePassword = %v, %v", revoked, err)
+	}
+	if n := countRows(t, "SELECT COUNT(*) FROM users WHERE password_hash = 'new'"); n != 1 {
+		t.Fatalf("only u1's password should change, %d changed", n)
+	}
+	if n := countRows(t, "SELECT COUNT(*) FROM sessions"); n != 2 {
+		t.Fatalf("the current session and other users' sessions should remain, got %d", n)
+	}
+	if _, err := ResetPassword("pending", "newer", now); err != ErrInvalidResetToken {
+		t.Fatalf("changing the password should cancel reset links, got %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"social-network/database"
+)
+
+var (
+	ErrTwoFactorEnabled      = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled  = errors.New("start setting up two-factor authentication first")
+	ErrInvalidLoginChallenge = errors.New("this login has expired; please enter your password again")
+)
+
+// TOTPState is a user's two-factor authentication setup.
+type TOTPState struct {
+	// Secret is the shared TOTP secret, or "" if the user never started enrolling.
+	Secret string
+	// Enabled is true once the user confirmed a code from their authenticator app.
+	Enabled bool
+	// LastStep is the time step of the last code accepted, which can't be used again.
+	LastStep int64
+}
+
+// GetTOTPState returns userID's two-factor setup.
+func GetTOTPState(userID string) (*TOTPState, error) {
+	var secret sql.NullString
+	var lastStep sql.NullInt64
+	state := &TOTPState{}
+	err := database.DB.QueryRow("SELECT totp_secret, totp_enabled_at IS NOT NULL, totp_last_step FROM users WHERE id = ?", userID).
+		Scan(&secret, &state.Enabled, &lastStep)
+	if err != nil {
+		return nil, err
+	}
+	state.Secret, state.LastStep = secret.String, lastStep.Int64
+	return state, nil
+}
+
+// SetPendingTOTPSecret starts enrolling userID with a new secret, replacing one from an
+// earlier enrollment they didn't finish. It returns ErrTwoFactorEnabled if 2FA is on.
+func SetPendingTOTPSecret(userID, secret string) error {
+	res, err := database.DB.Exec("UPDATE users SET totp_secret = ? WHERE id = ? AND totp_enabled_at IS NULL", secret, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+// EnableTOTP turns on 2FA for userID with their pending secret, after they confirmed the
+// code for step, and replaces their recovery codes with the given hashes.
+func EnableTOTP(userID string, step int64, recoveryCodeHashes []string, now time.Time) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE users SET totp_enabled_at = ?, totp_last_step = ?
+		WHERE id = ? AND totp_enabled_at IS NULL AND totp_secret IS NOT NULL`, now.UTC(), step, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrTwoFactorEnabled
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DisableTOTP turns off 2FA for userID and discards their secret and recovery codes.
+func DisableTOTP(userID string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL WHERE id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM login_challenges WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordTOTPStep marks the code for step as used. It reports false if that code, or a
+// later one, was already accepted, so the same code can't be used twice.
+func RecordTOTPStep(userID string, step int64) (bool, error) {
+	res, err := database.DB.Exec(`UPDATE users SET totp_last_step = ?
+		WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// UseRecoveryCode marks the recovery code with codeHash as used. It reports false if
+// userID has no such unused code.
+func UseRecoveryCode(userID, codeHash string, now time.Time) (bool, error) {
+	res, err := database.DB.Exec("UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+		now.UTC(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// CountUnusedRecoveryCodes returns how many recovery codes userID has left.
+func CountUnusedRecoveryCodes(userID string) (int, error) {
+	var n int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&n)
+	return n, err
+}
+
+// CreateLoginChallenge records that userID passed the password check and now has until
+// expiresAt to enter their second factor with the pre-auth token hashed as tokenHash.
+func CreateLoginChallenge(userID, tokenHash string, now, expiresAt time.Time) error {
+	_, err := database.DB.Exec("INSERT INTO login_challenges (token_hash, user_id, created_at, expires_at) VALUES (?, ?, ?, ?)",
+		tokenHash, userID, now.UTC(), expiresAt.UTC())
+	return err
+}
+
+// AttemptLoginChallenge counts an attempt at the challenge with tokenHash and returns
+// its user. It returns ErrInvalidLoginChallenge if the challenge is unknown, expired or
+// has had maxAttempts attempts already.
+func AttemptLoginChallenge(tokenHash string, now time.Time, maxAttempts int) (string, error) {
+	var userID string
+	err := database.DB.QueryRow(`
+		UPDATE login_challenges SET attempts = attempts + 1
+		WHERE token_hash = ? AND expires_at > ? AND attempts < ?
+		RETURNING user_id`, tokenHash, now.UTC(), maxAttempts).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidLoginChallenge
+	}
+	return userID, err
+}
+
+// DeleteLoginChallenge removes the challenge with tokenHash once it has been passed. It
+// reports false if it was already gone, e.g. used by a concurrent request.
+func DeleteLoginChallenge(tokenHash string) (bool, error) {
+	res, err := database.DB.Exec("DELETE FROM login_challenges WHERE token_hash = ?", tokenHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteExpiredLoginChallenges removes challenges that expired before now and returns
+// how many were removed.
+func DeleteExpiredLoginChallenges(now time.Time) (int64, error) {
+	res, err := database.DB.Exec("DELETE FROM login_challenges WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
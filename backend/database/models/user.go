@@ -20,6 +20,130 @@ type User struct {
 	AboutMe      string
 	IsPublic     bool
 	CreatedAt    time.Time
+
+	// Who may see the sensitive identity fields above.
+	EmailVisibility       string
+	DateOfBirthVisibility string
+
+	// Optional profile extras. Each text field has its own visibility setting.
+	CoverPath          string
+	Location           string
+	LocationVisibility string
+	Website            string
+	WebsiteVisibility  string
+	Pronouns           string
+	PronounsVisibility string
+
+	// Role decides what the user may do beyond using the site: RoleUser, RoleModerator or RoleAdmin.
+	Role string
+
+	// EmailVerified is false until the user opens the link sent to their address. Until
+	// then they cannot post or send messages.
+	EmailVerified bool
+
+	// TwoFactorEnabled is true when logging in also needs a code from an authenticator
+	// app or a recovery code.
+	TwoFactorEnabled bool
+
+	// Active is false while the account is deactivated or waiting to be deleted.
+	// Inactive users are hidden from everyone else until they log in again.
+	Active bool
+
+	// SuspendedUntil is set when a moderator or admin suspended the account. The
+	// suspension is over once it has passed; see ActiveSuspension.
+	SuspendedUntil   *time.Time
+	SuspensionReason string
+}
+
+// ActiveSuspension returns the user's suspension if it is still running at now, or nil.
+func (u *User) ActiveSuspension(now time.Time) *Suspension {
+	if u.SuspendedUntil == nil || !u.SuspendedUntil.After(now) {
+		return nil
+	}
+	return &Suspension{Until: *u.SuspendedUntil, Reason: u.SuspensionReason}
+}
+
+// Roles a user can have, from least to most privileged.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRanks = map[string]int{RoleUser: 0, RoleModerator: 1, RoleAdmin: 2}
+
+// IsValidRole reports whether role is one of the user roles.
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// HasRole reports whether the user's role is role or a more privileged one, so an admin
+// can do everything a moderator can.
+func (u *User) HasRole(role string) bool {
+	rank, ok := roleRanks[u.Role]
+	return ok && rank >= roleRanks[role]
+}
+
+// Who may see an individual profile field.
+const (
+	VisibilityEveryone  = "everyone"
+	VisibilityFollowers = "followers"
+	VisibilityOnlyMe    = "only_me"
+)
+
+// IsValidVisibility reports whether v is one of the field visibility settings.
+func IsValidVisibility(v string) bool {
+	return v == VisibilityEveryone || v == VisibilityFollowers || v == VisibilityOnlyMe
+}
+
+// CanSeeField reports whether a viewer may see a field with the given visibility.
+func CanSeeField(visibility string, isOwner, isFollower bool) bool {
+	switch visibility {
+	case VisibilityEveryone:
+		return true
+	case VisibilityFollowers:
+		return isOwner || isFollower
+	default:
+		return isOwner
+	}
+}
+
+// ActiveUserCondition is the SQL condition matching users who are neither deactivated nor
+// waiting to be deleted. It can be used on any query over the users table.
+const ActiveUserCondition = "(deactivated_at IS NULL AND deletion_requested_at IS NULL)"
+
+// userColumns is the column list every user query selects, in the order scanUser reads them.
+const userColumns = `id, first_name, last_name, nickname, email, password_hash, date_of_birth, avatar_path, about_me, is_public, created_at,
+	cover_path, location, location_visibility, website, website_visibility, pronouns, pronouns_visibility,
+	email_visibility, date_of_birth_visibility, role, suspended_until, suspension_reason, email_verified_at IS NOT NULL, totp_enabled_at IS NOT NULL, ` + ActiveUserCondition
+
+// scanUser reads one row selected with userColumns.
+func scanUser(row interface{ Scan(...interface{}) error }) (*User, error) {
+	user := &User{}
+	var nickname, avatar, aboutMe, cover, location, website, pronouns, suspensionReason sql.NullString
+	var suspendedUntil sql.NullTime
+	err := row.Scan(
+		&user.ID, &user.FirstName, &user.LastName, &nickname, &user.Email, &user.PasswordHash,
+		&user.DateOfBirth, &avatar, &aboutMe, &user.IsPublic, &user.CreatedAt,
+		&cover, &location, &user.LocationVisibility, &website, &user.WebsiteVisibility, &pronouns, &user.PronounsVisibility,
+		&user.EmailVisibility, &user.DateOfBirthVisibility, &user.Role, &suspendedUntil, &suspensionReason, &user.EmailVerified, &user.TwoFactorEnabled, &user.Active,
+	)
+	if err != nil {
+		return nil, err
+	}
+	user.Nickname = nickname.String
+	user.AvatarPath = avatar.String
+	user.AboutMe = aboutMe.String
+	user.CoverPath = cover.String
+	user.Location = location.String
+	user.Website = website.String
+	user.Pronouns = pronouns.String
+	if suspendedUntil.Valid {
+		user.SuspendedUntil = &suspendedUntil.Time
+	}
+	user.SuspensionReason = suspensionReason.String
+	return user, nil
 }
 
 // CreateUser inserts a new user into the database.
@@ -62,59 +186,34 @@ func CreateUser(user *User) error {
 
 // GetUserByEmail retrieves a user by their email address. Returns nil if no user is found.
 func GetUserByEmail(email string) (*User, error) {
-	user := &User{}
-	row := database.DB.QueryRow("SELECT id, first_name, last_name, nickname, email, password_hash, date_of_birth, avatar_path, about_me, is_public, created_at FROM users WHERE email = ?", email)
-
-	var avatar sql.NullString
-	var nickname sql.NullString
-	var aboutMe sql.NullString
-
-	err := row.Scan(
-		&user.ID, &user.FirstName, &user.LastName, &nickname, &user.Email, &user.PasswordHash,
-		&user.DateOfBirth, &avatar, &aboutMe, &user.IsPublic, &user.CreatedAt,
-	)
-
+	user, err := scanUser(database.DB.QueryRow("SELECT "+userColumns+" FROM users WHERE email = ?", email))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // No user found is not an application error
 		}
 		return nil, err // A real database error occurred
 	}
-
-	user.AvatarPath = avatar.String
-	user.Nickname = nickname.String
-	user.AboutMe = aboutMe.String
-
 	return user, nil
 }
 
 // GetUserByID retrieves a user by their unique ID. Returns nil if no user is found.
 func GetUserByID(id string) (*User, error) {
-	user := &User{}
-	row := database.DB.QueryRow("SELECT id, first_name, last_name, nickname, email, password_hash, date_of_birth, avatar_path, about_me, is_public, created_at FROM users WHERE id = ?", id)
-
-	var avatar sql.NullString
-	var nickname sql.NullString
-	var aboutMe sql.NullString
-
-	err := row.Scan(
-		&user.ID, &user.FirstName, &user.LastName, &nickname, &user.Email, &user.PasswordHash,
-		&user.DateOfBirth, &avatar, &aboutMe, &user.IsPublic, &user.CreatedAt,
-	)
-
+	user, err := scanUser(database.DB.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
-
-	user.AvatarPath = avatar.String
-	user.Nickname = nickname.String
-	user.AboutMe = aboutMe.String
-
 	return user, nil
 }
+
+// SetUserRole changes the role of a user.
+func SetUserRole(userID, role string) error {
+	_, err := database.DB.Exec("UPDATE users SET role = ? WHERE id = ?", role, userID)
+	return err
+}
+
 // SetUserProfilePrivacy updates the is_public flag for a given user.
 func SetUserProfilePrivacy(userID string, isPublic bool) error {
     stmt, err := database.DB.Prepare("UPDATE users SET is_public = ? WHERE id = ?")
@@ -130,7 +229,10 @@ func SetUserProfilePrivacy(userID string, isPublic bool) error {
 // UpdateUserProfile updates editable fields of a user in the database.
 func UpdateUserProfile(user *User) error {
 	stmt, err := database.DB.Prepare(`
-		UPDATE users SET first_name = ?, last_name = ?, nickname = ?, about_me = ?, is_public = ?, avatar_path = ? WHERE id = ?
+		UPDATE users SET first_name = ?, last_name = ?, nickname = ?, about_me = ?, is_public = ?, avatar_path = ?,
+			cover_path = ?, location = ?, location_visibility = ?, website = ?, website_visibility = ?, pronouns = ?, pronouns_visibility = ?,
+			email_visibility = ?, date_of_birth_visibility = ?
+		WHERE id = ?
 	`)
 	if err != nil {
 		return err
@@ -144,15 +246,24 @@ func UpdateUserProfile(user *User) error {
 		user.AboutMe,
 		user.IsPublic,
 		user.AvatarPath,
+		user.CoverPath,
+		user.Location,
+		defaultVisibility(user.LocationVisibility),
+		user.Website,
+		defaultVisibility(user.WebsiteVisibility),
+		user.Pronouns,
+		defaultVisibility(user.PronounsVisibility),
+		sensitiveVisibility(user.EmailVisibility),
+		sensitiveVisibility(user.DateOfBirthVisibility),
 		user.ID,
 	)
 	return err
 }
 
 
-// GetAllUsers retrieves all users from the database.
+// GetAllUsers retrieves all active users from the database.
 func GetAllUsers() ([]*User, error) {
-	rows, err := database.DB.Query("SELECT id, first_name, last_name, nickname, email, password_hash, date_of_birth, avatar_path, about_me, is_public, created_at FROM users")
+	rows, err := database.DB.Query("SELECT " + userColumns + " FROM users WHERE " + ActiveUserCondition)
 	if err != nil {
 		return nil, err
 	}
@@ -160,24 +271,55 @@ func GetAllUsers() ([]*User, error) {
 
 	var users []*User
 	for rows.Next() {
-		user := &User{}
-		var avatar sql.NullString
-		var nickname sql.NullString
-		var aboutMe sql.NullString
-		err := rows.Scan(
-			&user.ID, &user.FirstName, &user.LastName, &nickname, &user.Email, &user.PasswordHash,
-			&user.DateOfBirth, &avatar, &aboutMe, &user.IsPublic, &user.CreatedAt,
-		)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, err
 		}
-		user.AvatarPath = avatar.String
-		user.Nickname = nickname.String
-		user.AboutMe = aboutMe.String
 		users = append(users, user)
 	}
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 	return users, nil
-}
\ No newline at end of file
+}
+
+// defaultVisibility maps an unset visibility to the column default.
+func defaultVisibility(v string) string {
+	if v == "" {
+		return VisibilityEveryone
+	}
+	return v
+}
+
+// sensitiveVisibility maps an unset visibility on email or birth date to the column
+// default, which keeps them to the owner.
+func sensitiveVisibility(v string) string {
+	if v == "" {
+		return VisibilityOnlyMe
+	}
+	return v
+}
+
+// SearchUsers returns up to limit active users other than excludeID whose name or
+// nickname contains query, leaving out anyone excludeID has blocked or been blocked by.
+func SearchUsers(excludeID, query string, limit int) ([]*User, error) {
+	term := "%" + query + "%"
+	rows, err := database.DB.Query("SELECT "+userColumns+` FROM users
+		WHERE id != ? AND `+ActiveUserCondition+` AND `+NotBlockedCondition("users.id")+`
+		AND (first_name LIKE ? OR last_name LIKE ? OR nickname LIKE ?)
+		LIMIT ?`, excludeID, excludeID, excludeID, term, term, term, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
@@ -1,40 +1,13 @@
 package models
 
 import (
-	"database/sql"
 	"testing"
-	"social-network/database"
-	_ "github.com/mattn/go-sqlite3"
-)
 
-func setupUserTestDB(t *testing.T) {
-	db, err := sql.Open("sqlite3", ":memory:")
-	if err != nil {
-		t.Fatalf("failed to open test db: %v", err)
-	}
-	database.DB = db
-	_, err = db.Exec(`
-		CREATE TABLE users (
-			id TEXT PRIMARY KEY,
-			first_name TEXT,
-			last_name TEXT,
-			nickname TEXT,
-			email TEXT,
-			password_hash TEXT,
-			date_of_birth TEXT,
-			avatar_path TEXT,
-			about_me TEXT,
-			is_public INTEGER,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);
-	`)
-	if err != nil {
-		t.Fatalf("failed to create users table: %v", err)
-	}
-}
+	"social-network/database/dbtest"
+)
 
 func TestUserProfileLifecycle(t *testing.T) {
-	setupUserTestDB(t)
+	dbtest.Open(t)
 	user := &User{
 		ID:           "u1",
 		FirstName:    "Alice",
@@ -74,7 +47,7 @@ func TestUserProfileLifecycle(t *testing.T) {
 }
 
 func TestGetUserByEmail(t *testing.T) {
-	setupUserTestDB(t)
+	dbtest.Open(t)
 	user := &User{
 		ID:           "u2",
 		FirstName:    "Bob",
@@ -104,7 +77,7 @@ func TestGetUserByEmail(t *testing.T) {
 }
 
 func TestSetUserProfilePrivacy(t *testing.T) {
-	setupUserTestDB(t)
+	dbtest.Open(t)
 	user := &User{
 		ID:           "u3",
 		FirstName:    "Carol",
@@ -130,7 +103,7 @@ func TestSetUserProfilePrivacy(t *testing.T) {
 }
 
 func TestGetUserByID_NotFound(t *testing.T) {
-	setupUserTestDB(t)
+	dbtest.Open(t)
 	got, err := GetUserByID("doesnotexist")
 	if err != nil {
 		t.Fatalf("GetUserByID notfound error: %v", err)
@@ -138,4 +111,74 @@ func TestGetUserByID_NotFound(t *testing.T) {
 	if got != nil {
 		t.Fatalf("GetUserByID notfound should be nil, got: %+v", got)
 	}
-} 
\ No newline at end of file
+}
+
+func TestProfileDetailsAndVisibility(t *testing.T) {
+	dbtest.Open(t)
+	user := &User{
+		ID:           "u4",
+		FirstName:    "Dana",
+		LastName:     "D",
+		Email:        "dana@example.com",
+		PasswordHash: "hash4",
+		DateOfBirth:  "1997-10-10",
+		IsPublic:     true,
+	}
+	if err := CreateUser(user); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	got, err := GetUserByID("u4")
+	if err != nil || got == nil || got.LocationVisibility != VisibilityEveryone {
+		t.Fatalf("new users should default to everyone: %v, %+v", err, got)
+	}
+	if got.EmailVisibility != VisibilityOnlyMe || got.DateOfBirthVisibility != VisibilityOnlyMe {
+		t.Fatalf("email and birth date should default to only me: %+v", got)
+	}
+	got.CoverPath = "media/ab/cover.jpg"
+	got.Location = "Lisbon"
+	got.LocationVisibility = VisibilityFollowers
+	got.Pronouns = "they/them"
+	got.PronounsVisibility = VisibilityOnlyMe
+	if err := UpdateUserProfile(got); err != nil {
+		t.Fatalf("UpdateUserProfile failed: %v", err)
+	}
+	updated, err := GetUserByID("u4")
+	if err != nil || updated.CoverPath != "media/ab/cover.jpg" || updated.Location != "Lisbon" ||
+		updated.LocationVisibility != VisibilityFollowers || updated.PronounsVisibility != VisibilityOnlyMe ||
+		updated.WebsiteVisibility != VisibilityEveryone {
+		t.Fatalf("profile details did not persist: %v, %+v", err, updated)
+	}
+
+	if CanSeeField(VisibilityFollowers, false, false) || !CanSeeField(VisibilityFollowers, false, true) {
+		t.Fatalf("followers-only fields should be visible to followers only")
+	}
+	if CanSeeField(VisibilityOnlyMe, false, true) || !CanSeeField(VisibilityOnlyMe, true, false) {
+		t.Fatalf("only-me fields should be visible to the owner only")
+	}
+}
+
+func TestUserRoles(t *testing.T) {
+	dbtest.Open(t)
+	user := &User{ID: "u5", FirstName: "Eve", LastName: "E", Email: "eve@example.com", PasswordHash: "h", DateOfBirth: "2000-01-01"}
+	if err := CreateUser(user); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	got, _ := GetUserByID("u5")
+	if got.Role != RoleUser || got.HasRole(RoleModerator) {
+		t.Fatalf("new users should have the user role: %+v", got)
+	}
+
+	if err := SetUserRole("u5", RoleAdmin); err != nil {
+		t.Fatalf("SetUserRole failed: %v", err)
+	}
+	got, _ = GetUserByID("u5")
+	if !got.HasRole(RoleModerator) || !got.HasRole(RoleAdmin) {
+		t.Fatalf("admins should have every role: %+v", got)
+	}
+	if (&User{Role: RoleModerator}).HasRole(RoleAdmin) {
+		t.Fatal("moderators should not have the admin role")
+	}
+	if IsValidRole("owner") {
+		t.Fatal("unknown roles should be invalid")
+	}
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
@@ -42,26 +43,9 @@ func InitDB() (*sql.DB, error) {
 func applyMigrations() {
 	log.Println("Applying database migrations...")
 
-
-	_, b, _, _ := runtime.Caller(0)
-	basepath := filepath.Dir(b)
-	migrationsPath := filepath.Join(basepath, "migrations")
-	// The path must be in file:// format for the migrate library
-	migrationsURL := "file://" + migrationsPath
-
-
-	driver, err := sqlite3.WithInstance(DB, &sqlite3.Config{})
+	m, err := newMigrate(DB)
 	if err != nil {
-		log.Fatalf("could not create sqlite3 driver instance: %v", err)
-	}
-
-	m, err := migrate.NewWithDatabaseInstance(
-		migrationsURL, 
-		"sqlite3",
-		driver,
-	)
-	if err != nil {
-		log.Fatalf("could not create migrate instance: %v", err)
+		log.Fatalf("%v", err)
 	}
 
 	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
@@ -79,4 +63,36 @@ func applyMigrations() {
 	}
 
 	log.Println("Database migrations applied successfully.")
-}
\ No newline at end of file
+}
+
+// Migrate applies the migrations db doesn't have yet. Tests use it to get the same
+// schema as the server.
+func Migrate(db *sql.DB) error {
+	m, err := newMigrate(db)
+	if err != nil {
+		return err
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+	return nil
+}
+
+// newMigrate returns a migrate instance for the migrations directory next to this file.
+func newMigrate(db *sql.DB) (*migrate.Migrate, error) {
+	_, b, _, _ := runtime.Caller(0)
+	basepath := filepath.Dir(b)
+	migrationsPath := filepath.Join(basepath, "migrations")
+	// The path must be in file:// format for the migrate library
+	migrationsURL := "file://" + migrationsPath
+
+	driver, err := sqlite3.WithInstance(db, &sqlite3.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("could not create sqlite3 driver instance: %w", err)
+	}
+	m, err := migrate.NewWithDatabaseInstance(migrationsURL, "sqlite3", driver)
+	if err != nil {
+		return nil, fmt.Errorf("could not create migrate instance: %w", err)
+	}
+	return m, nil
+}
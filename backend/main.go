@@ -6,6 +6,7 @@ import (
 
 	"social-network/api"
 	"social-network/database"
+	"social-network/services"
 	"social-network/websocket"
 )
 
@@ -17,12 +18,46 @@ func main() {
 	}
 	defer db.Close()
 
+	// Grant the roles configured in the environment, such as the first admin
+	services.PromoteStaffFromEnv()
+
+	// Periodically delete sessions that have expired
+	services.NewSessionSweeper().Start()
+
 	// Initialize WebSocket hub and run it in a separate goroutine
 	hub := websocket.NewHub()
 	go hub.Run()
 
-	// Setup the API router, passing the hub to it
-	router := api.SetupRouter(hub)
+	// Select where uploaded media is stored (local disk or an S3-compatible bucket)
+	storage, err := services.NewStorageFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure media storage: %v", err)
+	}
+
+	images := services.NewImageService(storage)
+
+	// Periodically remove uploads that nothing refers to any more
+	services.NewUploadGCFromEnv(storage).Start()
+
+	// Erase accounts whose deletion grace period has run out
+	services.NewAccountPurger(images).Start()
+
+	// Build personal data exports in the background and notify users when they are ready
+	exporter := services.NewDataExporterFromEnv(storage, hub.SendLinkNotification)
+	exporter.Start()
+
+	// Select how email is sent (written to disk or the log in development, SMTP in production)
+	mailer, err := services.NewMailerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure mail: %v", err)
+	}
+	resets := services.NewPasswordResetterFromEnv(mailer)
+	verifier := services.NewEmailVerifierFromEnv(mailer)
+	twoFactor := services.NewTwoFactorFromEnv()
+
+	// Setup the API router, passing the hub, image service, exporter, password resetter,
+	// email verifier and two-factor service to it
+	router := api.SetupRouter(hub, images, exporter, resets, verifier, twoFactor)
 
 	// Start the HTTP server
 	log.Println("Server started at http://localhost :8080")
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"social-network/database/models"
+)
+
+// DefaultAccountDeletionGracePeriod is how long a deleted account can still be
+// restored by logging in before it is erased for good.
+const DefaultAccountDeletionGracePeriod = 14 * 24 * time.Hour
+
+// accountPurgeInterval is how often accounts past their grace period are looked for.
+const accountPurgeInterval = time.Hour
+
+// AccountDeletionGracePeriod returns the grace period, overridable with
+// ACCOUNT_DELETION_GRACE_PERIOD (a Go duration such as "72h").
+func AccountDeletionGracePeriod() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD")); err == nil && d > 0 {
+		return d
+	}
+	return DefaultAccountDeletionGracePeriod
+}
+
+// EraseAccount permanently deletes a user's data and then releases the uploaded files
+// it referenced. The database is cleaned in a single transaction first, so a failure
+// there leaves everything in place; files that fail to delete afterwards are left for
+// the orphaned upload collector.
+func EraseAccount(images *ImageService, userID string) error {
+	media, err := models.EraseUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, p := range media {
+		if err := images.ReleaseImage(p); err != nil {
+			log.Printf("Account erasure: could not release %s for user %s: %v", p, userID, err)
+		}
+	}
+	return nil
+}
+
+// AccountPurger erases accounts whose deletion grace period has run out.
+type AccountPurger struct {
+	images      *ImageService
+	gracePeriod time.Duration
+}
+
+// NewAccountPurger creates a purger using AccountDeletionGracePeriod.
+func NewAccountPurger(images *ImageService) *AccountPurger {
+	return &AccountPurger{images: images, gracePeriod: AccountDeletionGracePeriod()}
+}
+
+// PurgeDue erases every account whose deletion was requested more than the grace
+// period ago and returns how many were erased.
+func (p *AccountPurger) PurgeDue() (int, error) {
+	due, err := models.ListAccountsDueForDeletion(time.Now().Add(-p.gracePeriod))
+	if err != nil {
+		return 0, err
+	}
+	erased := 0
+	for _, userID := range due {
+		if err := EraseAccount(p.images, userID); err != nil {
+			log.Printf("Account erasure failed for user %s: %v", userID, err)
+			continue
+		}
+		erased++
+	}
+	return erased, nil
+}
+
+// Start runs PurgeDue immediately and then periodically in a background goroutine.
+func (p *AccountPurger) Start() {
+	go func() {
+		for {
+			n, err := p.PurgeDue()
+			if err != nil {
+				log.Printf("Account purge failed: %v", err)
+			} else if n > 0 {
+				log.Printf("Account purge: erased %d accounts", n)
+			}
+			time.Sleep(accountPurgeInterval)
+		}
+	}()
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"social-network/database/models"
+)
+
+const (
+	// DefaultEmailVerificationLifetime is how long an emailed verification link works.
+	DefaultEmailVerificationLifetime = 48 * time.Hour
+	// emailVerificationCooldown is the shortest time between two verification emails.
+	emailVerificationCooldown = time.Minute
+	// maxEmailVerificationsPerDay caps the verification emails sent to one account.
+	maxEmailVerificationsPerDay = 5
+)
+
+var (
+	ErrEmailAlreadyVerified    = errors.New("your email address is already verified")
+	ErrVerificationRateLimited = errors.New("too many verification emails; please wait before asking for another")
+	ErrEmailUnchanged          = errors.New("this is already your email address")
+)
+
+// EmailVerifier emails links that confirm a user owns their email address, and
+// carries out the confirmation.
+type EmailVerifier struct {
+	mailer   Mailer
+	baseURL  string
+	lifetime time.Duration
+	now      func() time.Time
+}
+
+// NewEmailVerifier creates a verifier whose emails link to baseURL/verify-email.
+func NewEmailVerifier(mailer Mailer, baseURL string, lifetime time.Duration) *EmailVerifier {
+	return &EmailVerifier{
+		mailer:   mailer,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		lifetime: lifetime,
+		now:      time.Now,
+	}
+}
+
+// NewEmailVerifierFromEnv creates a verifier linking to AppBaseURL whose links last
+// EMAIL_VERIFICATION_LIFETIME (a Go duration such as "24h").
+func NewEmailVerifierFromEnv(mailer Mailer) *EmailVerifier {
+	lifetime := DefaultEmailVerificationLifetime
+	if d, err := time.ParseDuration(os.Getenv("EMAIL_VERIFICATION_LIFETIME")); err == nil && d > 0 {
+		lifetime = d
+	}
+	return NewEmailVerifier(mailer, AppBaseURL(), lifetime)
+}
+
+// Send emails user a link verifying their current address. Earlier links stop working.
+func (v *EmailVerifier) Send(user *models.User) error {
+	return v.sendTo(user, user.Email)
+}
+
+// Resend is Send for a user asking for another email. It returns ErrEmailAlreadyVerified
+// if there is nothing to verify, and ErrVerificationRateLimited if the user asked within
+// the last minute or has had too many emails today.
+func (v *EmailVerifier) Resend(user *models.User) error {
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+	if err := v.checkRateLimit(user.ID); err != nil {
+		return err
+	}
+	return v.Send(user)
+}
+
+// RequestEmailChange emails a verification link to newEmail; the user's address only
+// changes once it is opened. The current address is told about the request, so the
+// owner notices if someone else made it. It is rate-limited like Resend.
+func (v *EmailVerifier) RequestEmailChange(user *models.User, newEmail string) error {
+	if strings.EqualFold(newEmail, user.Email) {
+		return ErrEmailUnchanged
+	}
+	if err := v.checkRateLimit(user.ID); err != nil {
+		return err
+	}
+	if err := v.sendTo(user, newEmail); err != nil {
+		return err
+	}
+	return v.mailer.Send(&Email{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to change the email address of your account to %s. The change happens once "+
+			"the link we sent to the new address is opened.\n\n"+
+			"If this wasn't you, change your password straight away; until the link is opened your "+
+			"account keeps using this address.\n", user.FirstName, newEmail),
+	})
+}
+
+// checkRateLimit returns ErrVerificationRateLimited if userID was sent a verification
+// email within the last minute or has had too many today.
+func (v *EmailVerifier) checkRateLimit(userID string) error {
+	now := v.now()
+	sent, err := models.ListEmailVerificationRequests(userID, now.Add(-24*time.Hour))
+	if err != nil {
+		return err
+	}
+	if len(sent) >= maxEmailVerificationsPerDay || (len(sent) > 0 && now.Sub(sent[0]) < emailVerificationCooldown) {
+		return ErrVerificationRateLimited
+	}
+	return nil
+}
+
+func (v *EmailVerifier) sendTo(user *models.User, email string) error {
+	token, err := newSecretToken()
+	if err != nil {
+		return err
+	}
+	now := v.now()
+	if err := models.CreateEmailVerificationToken(user.ID, email, hashSecretToken(token), now, now.Add(v.lifetime)); err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Hi %s,\n\n"+
+		"Please confirm that this is your email address by opening this link:\n\n"+
+		"%s/verify-email?token=%s\n\n"+
+		"The link expires in %s.", user.FirstName, v.baseURL, token, v.lifetime)
+	if !user.EmailVerified {
+		body += " Until you confirm your address you can't post or send messages."
+	}
+	return v.mailer.Send(&Email{To: email, Subject: "Verify your email address", Body: body + "\n"})
+}
+
+// Verify makes the address an emailed token was sent to the user's verified email. It
+// returns models.ErrInvalidVerificationToken if the token is unknown, used or expired,
+// and models.ErrEmailInUse if another account has taken the address since.
+func (v *EmailVerifier) Verify(token string) (*models.VerifiedEmail, error) {
+	if token == "" {
+		return nil, models.ErrInvalidVerificationToken
+	}
+	return models.VerifyEmail(hashSecretToken(token), v.now())
+}
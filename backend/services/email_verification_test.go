@@ -0,0 +1,121 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/database"
+	"social-network/database/models"
+)
+
+var verifyLinkPattern = regexp.MustCompile(`/verify-email\?token=([A-Za-z0-9_-]+)`)
+
+// newTestVerifier returns a verifier using the database of newTestResetter, where u1 has
+// not verified their address.
+func newTestVerifier(t *testing.T) (*EmailVerifier, *recordingMailer) {
+	_, mailer := newTestResetter(t)
+	return NewEmailVerifier(mailer, "https://example.com", time.Hour), mailer
+}
+
+func TestEmailVerification(t *testing.T) {
+	verifier, mailer := newTestVerifier(t)
+	user, _ := models.GetUserByID("u1")
+	if user.EmailVerified {
+		t.Fatal("user should start unverified")
+	}
+
+	if err := verifier.Send(user); err != nil || len(mailer.sent) != 1 || mailer.sent[0].To != "alice@example.com" {
+		t.Fatalf("Send = %v, %+v", err, mailer.sent)
+	}
+	m := verifyLinkPattern.FindStringSubmatch(mailer.sent[0].Body)
+	if m == nil {
+		t.Fatalf("no verification link in email: %q", mailer.sent[0].Body)
+	}
+
+	if _, err := verifier.Verify("not-a-token"); err != models.ErrInvalidVerificationToken {
+		t.Fatalf("unknown token should be refused, got %v", err)
+	}
+	if v, err := verifier.Verify(m[1]); err != nil || v.UserID != "u1" || v.Email != v.PreviousEmail {
+		t.Fatalf("Verify = %+v, %v", v, err)
+	}
+	if verified, _ := models.IsEmailVerified("u1"); !verified {
+		t.Fatal("email should be verified")
+	}
+	if _, err := verifier.Verify(m[1]); err != models.ErrInvalidVerificationToken {
+		t.Fatalf("a token should only work once, got %v", err)
+	}
+
+	user, _ = models.GetUserByID("u1")
+	if err := verifier.Resend(user); err != ErrEmailAlreadyVerified {
+		t.Fatalf("resending to a verified user should fail, got %v", err)
+	}
+}
+
+func TestEmailVerificationResendIsRateLimited(t *testing.T) {
+	verifier, mailer := newTestVerifier(t)
+	user, _ := models.GetUserByID("u1")
+	start := time.Now()
+
+	for i := 0; i < maxEmailVerificationsPerDay; i++ {
+		verifier.now = func() time.Time { return start.Add(time.Duration(i) * 2 * time.Minute) }
+		if err := verifier.Resend(user); err != nil {
+			t.Fatalf("resend %d failed: %v", i+1, err)
+		}
+		if err := verifier.Resend(user); err != ErrVerificationRateLimited {
+			t.Fatalf("resending right away should be refused, got %v", err)
+		}
+	}
+	verifier.now = func() time.Time { return start.Add(time.Hour) }
+	if err := verifier.Resend(user); err != ErrVerificationRateLimited {
+		t.Fatalf("daily limit should apply, got %v", err)
+	}
+	verifier.now = func() time.Time { return start.Add(25 * time.Hour) }
+	if err := verifier.Resend(user); err != nil {
+		t.Fatalf("limit should reset after a day, got %v", err)
+	}
+	if len(mailer.sent) != maxEmailVerificationsPerDay+1 {
+		t.Fatalf("expected %d emails, got %d", maxEmailVerificationsPerDay+1, len(mailer.sent))
+	}
+}
+
+func TestEmailChange(t *testing.T) {
+	verifier, mailer := newTestVerifier(t)
+	database.DB.Exec(`UPDATE users SET email_verified_at = '2024-01-01';
+		INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth, is_public, created_at)
+		VALUES ('u2', 'Bob', 'Jones', 'bob@example.com', 'h', '1990-01-01', 1, '2024-01-01')`)
+	user, _ := models.GetUserByID("u1")
+
+	if err := verifier.RequestEmailChange(user, "ALICE@example.com"); err != ErrEmailUnchanged {
+		t.Fatalf("changing to the same address should fail, got %v", err)
+	}
+	if err := verifier.RequestEmailChange(user, "alice@new.example"); err != nil || len(mailer.sent) != 2 {
+		t.Fatalf("RequestEmailChange = %v, %d sent", err, len(mailer.sent))
+	}
+	if mailer.sent[0].To != "alice@new.example" || mailer.sent[1].To != "alice@example.com" ||
+		!strings.Contains(mailer.sent[1].Body, "alice@new.example") {
+		t.Fatalf("the new address should get the link and the old one a notice: %+v", mailer.sent)
+	}
+	if u, _ := models.GetUserByID("u1"); u.Email != "alice@example.com" || !u.EmailVerified {
+		t.Fatalf("address should not change before it is verified: %+v", u)
+	}
+
+	token := verifyLinkPattern.FindStringSubmatch(mailer.sent[0].Body)[1]
+	v, err := verifier.Verify(token)
+	if err != nil || v.Email != "alice@new.example" || v.PreviousEmail != "alice@example.com" {
+		t.Fatalf("Verify = %+v, %v", v, err)
+	}
+	if u, _ := models.GetUserByEmail("alice@new.example"); u == nil || u.ID != "u1" {
+		t.Fatalf("address should have changed: %+v", u)
+	}
+
+	verifier.now = func() time.Time { return time.Now().Add(time.Hour) }
+	user, _ = models.GetUserByID("u1")
+	verifier.RequestEmailChange(user, "shared@example.com")
+	database.DB.Exec("UPDATE users SET email = 'shared@example.com' WHERE id = 'u2'")
+	token = verifyLinkPattern.FindStringSubmatch(mailer.sent[2].Body)[1]
+	if _, err := verifier.Verify(token); err != models.ErrEmailInUse {
+		t.Fatalf("verifying an address taken in the meantime should fail, got %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"social-network/database/models"
+)
+
+// DefaultDataExportLifetime is how long a finished personal data export can be downloaded.
+const DefaultDataExportLifetime = 48 * time.Hour
+
+const (
+	// dataExportSweepInterval is how often expired exports are removed and pending ones
+	// that never made it onto the queue are picked up again.
+	dataExportSweepInterval = time.Hour
+	dataExportQueueSize     = 64
+)
+
+// Notification types sent when an export finishes.
+const (
+	NotifDataExportReady  = "data_export_ready"
+	NotifDataExportFailed = "data_export_failed"
+)
+
+// ExportNotifier tells a user that their export finished. link is empty on failure.
+type ExportNotifier func(userID, notifType, message, link string)
+
+// DataExportDownloadPath is the API path a finished export is downloaded from.
+func DataExportDownloadPath(exportID string) string {
+	return "/api/v1/exports/" + exportID + "/download"
+}
+
+// DataExporter builds personal data exports in the background: a ZIP archive with one
+// JSON file per kind of data and a media/ folder holding the user's uploads.
+type DataExporter struct {
+	storage  Storage
+	lifetime time.Duration
+	notify   ExportNotifier
+	queue    chan string
+	now      func() time.Time
+}
+
+// NewDataExporter creates an exporter that stores archives in storage and keeps them
+// downloadable for lifetime.
+func NewDataExporter(storage Storage, lifetime time.Duration, notify ExportNotifier) *DataExporter {
+	return &DataExporter{
+		storage:  storage,
+		lifetime: lifetime,
+		notify:   notify,
+		queue:    make(chan string, dataExportQueueSize),
+		now:      time.Now,
+	}
+}
+
+// NewDataExporterFromEnv creates an exporter whose download lifetime can be changed with
+// DATA_EXPORT_LIFETIME (a Go duration such as "72h").
+func NewDataExporterFromEnv(storage Storage, notify ExportNotifier) *DataExporter {
+	lifetime := DefaultDataExportLifetime
+	if d, err := time.ParseDuration(os.Getenv("DATA_EXPORT_LIFETIME")); err == nil && d > 0 {
+		lifetime = d
+	}
+	return NewDataExporter(storage, lifetime, notify)
+}
+
+// Request records a new export for userID and queues it to be built. It returns
+// models.ErrExportInProgress if the user is already waiting for one.
+func (x *DataExporter) Request(userID string) (*models.DataExport, error) {
+	export, err := models.CreateDataExport(userID)
+	if err != nil {
+		return nil, err
+	}
+	x.enqueue(export.ID)
+	return export, nil
+}
+
+func (x *DataExporter) enqueue(exportID string) {
+	select {
+	case x.queue <- exportID:
+	default:
+		// The next sweep picks up exports that are still pending.
+		log.Printf("Data export queue full, deferring export %s", exportID)
+	}
+}
+
+// Build creates the archive for a pending export, stores it and notifies the user.
+// Exports that are no longer pending are skipped, so queuing one twice is harmless.
+func (x *DataExporter) Build(exportID string) error {
+	export, err := models.GetDataExport(exportID)
+	if err != nil {
+		return err
+	}
+	if export == nil || export.Status != models.ExportPending {
+		return nil
+	}
+
+	key, size, err := x.writeArchive(export)
+	if err == nil {
+		expiresAt := x.now().Add(x.lifetime)
+		if err = models.MarkDataExportReady(export.ID, key, size, expiresAt); err != nil {
+			x.storage.Delete(key)
+		} else {
+			x.notify(export.UserID, NotifDataExportReady,
+				fmt.Sprintf("Your data export is ready. The download link works until %s.", expiresAt.UTC().Format("2 January 2006 15:04 MST")),
+				DataExportDownloadPath(export.ID))
+			return nil
+		}
+	}
+
+	if markErr := models.MarkDataExportFailed(export.ID, x.now().Add(x.lifetime)); markErr != nil {
+		log.Printf("Could not mark data export %s as failed: %v", export.ID, markErr)
+	}
+	x.notify(export.UserID, NotifDataExportFailed, "We could not prepare your data export. Please try again later.", "")
+	return err
+}
+
+// writeArchive builds the ZIP in memory and stores it, returning its key and size.
+func (x *DataExporter) writeArchive(export *models.DataExport) (string, int64, error) {
+	sections, err := models.CollectUserData(export.UserID)
+	if err != nil {
+		return "", 0, err
+	}
+	media, err := models.ListUserMediaPaths(export.UserID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, section := range sections {
+		var data interface{} = section.Rows
+		if section.Name == "profile" && len(section.Rows) == 1 {
+			data = section.Rows[0]
+		}
+		content, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return "", 0, err
+		}
+		w, err := zw.Create(section.Name + ".json")
+		if err != nil {
+			return "", 0, err
+		}
+		if _, err := w.Write(content); err != nil {
+			return "", 0, err
+		}
+	}
+	for _, p := range media {
+		if err := x.addMedia(zw, p); err != nil {
+			return "", 0, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return "", 0, err
+	}
+
+	key := "exports/" + export.UserID + "/" + export.ID + ".zip"
+	if err := x.storage.Put(key, buf.Bytes(), "application/zip"); err != nil {
+		return "", 0, err
+	}
+	return key, int64(buf.Len()), nil
+}
+
+// addMedia copies one stored upload into the archive under media/. Files that have
+// gone missing from storage are skipped rather than failing the whole export.
+func (x *DataExporter) addMedia(zw *zip.Writer, relativePath string) error {
+	// Older avatars were stored with the upload directory in front of them.
+	key, err := CleanKey(strings.TrimPrefix(strings.TrimPrefix(relativePath, "/"), "uploads/"))
+	if err != nil {
+		log.Printf("Data export: skipping invalid media path %q", relativePath)
+		return nil
+	}
+	f, _, err := x.storage.Open(key)
+	if errors.Is(err, ErrObjectNotFound) {
+		log.Printf("Data export: media %s is missing from storage", key)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Deduplicated uploads already live under media/, so their archive path matches the
+	// path recorded in the JSON files.
+	w, err := zw.Create(blobPrefix + "/" + strings.TrimPrefix(key, blobPrefix+"/"))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Open returns the archive of a finished export for streaming.
+func (x *DataExporter) Open(export *models.DataExport) (ReadSeekCloser, ObjectInfo, error) {
+	return x.storage.Open(export.StorageKey)
+}
+
+// SignedURL returns a short-lived direct download URL for a finished export, or "" when
+// the storage backend cannot sign URLs and the server must stream the archive itself.
+func (x *DataExporter) SignedURL(export *models.DataExport) (string, error) {
+	lifetime := SignedURLLifetime
+	if export.ExpiresAt != nil {
+		if remaining := export.ExpiresAt.Sub(x.now()); remaining < lifetime {
+			lifetime = remaining
+		}
+	}
+	return x.storage.SignedURL(export.StorageKey, lifetime)
+}
+
+// Sweep deletes expired exports and re-queues pending ones, e.g. after a restart.
+func (x *DataExporter) Sweep() error {
+	expired, err := models.ListExpiredDataExports(x.now())
+	if err != nil {
+		return err
+	}
+	for _, export := range expired {
+		if export.StorageKey != "" {
+			if err := x.storage.Delete(export.StorageKey); err != nil {
+				log.Printf("Data export sweep: could not delete %s: %v", export.StorageKey, err)
+				continue
+			}
+		}
+		if err := models.DeleteDataExport(export.ID); err != nil {
+			return err
+		}
+	}
+
+	pending, err := models.ListPendingDataExports()
+	if err != nil {
+		return err
+	}
+	for _, export := range pending {
+		x.enqueue(export.ID)
+	}
+	return nil
+}
+
+// Start runs the worker that builds queued exports and the periodic sweep in
+// background goroutines.
+func (x *DataExporter) Start() {
+	go func() {
+		for exportID := range x.queue {
+			if err := x.Build(exportID); err != nil {
+				log.Printf("Data export %s failed: %v", exportID, err)
+			}
+		}
+	}()
+	go func() {
+		for {
+			if err := x.Sweep(); err != nil {
+				log.Printf("Data export sweep failed: %v", err)
+			}
+			time.Sleep(dataExportSweepInterval)
+		}
+	}()
+}
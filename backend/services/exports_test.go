@@ -0,0 +1,184 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/database"
+	"social-network/database/dbtest"
+	"social-network/database/models"
+)
+
+type sentNotification struct {
+	userID, notifType, message, link string
+}
+
+// newTestExporter returns a DataExporter backed by temporary storage and an in-memory
+// database holding one user, "u1", with a little of everything.
+func newTestExporter(t *testing.T) (*DataExporter, Storage, *[]sentNotification) {
+	dbtest.Open(t)
+	_, err := database.DB.Exec(`
+		INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth, avatar_path, is_public, created_at)
+			VALUES ('u1', 'Alice', 'Smith', 'alice@example.com', 'secret-hash', '1990-01-01', 'media/aa/avatar.jpg', 1, '2024-01-01'),
+			       ('u2', 'Bob', 'Jones', 'bob@example.com', 'other-hash', '1991-01-01', NULL, 1, '2024-01-01'),
+			       ('mod1', 'Mo', 'Derator', 'mod@example.com', 'mod-hash', '1980-01-01', NULL, 1, '2024-01-01');
+		INSERT INTO posts VALUES (1, 'u1', 'hello', 'media/bb/post.jpg', 'private', '2024-02-01'), (2, 'u2', 'not mine', NULL, 'public', '2024-02-01');
+		INSERT INTO post_allowed_users VALUES (1, 'u2');
+		INSERT INTO comments VALUES (1, 2, 'u1', 'nice', NULL, '2024-02-02');
+		INSERT INTO post_likes VALUES ('u1', 2, 1, '2024-02-02');
+		INSERT INTO followers VALUES ('u2', 'u1', '2024-01-05');
+		INSERT INTO chat_messages (id, sender_id, recipient_id, content, created_at) VALUES ('m1', 'u2', 'u1', 'hi Alice', '2024-02-03');
+		INSERT INTO sessions VALUES ('secret-token', 'u1', '2099-01-01', 's1', '2024-02-01', '2024-02-02', '203.0.113.7', 'Firefox');
+		INSERT INTO user_blocks VALUES ('u1', 'u2', '2024-02-04'), ('u2', 'u1', '2024-02-04');
+		INSERT INTO user_mutes VALUES ('u1', 'u2', '2024-02-04');
+		INSERT INTO muted_keywords VALUES ('u1', '#spoilers', '2024-02-04');
+		INSERT INTO reports (id, reporter_id, target_type, target_id, reason, status, resolution, moderator_id, moderator_note,
+			created_at, resolved_at) VALUES ('r1', 'u1', 'post', '2', 'spam', 'resolved', 'dismissed', 'mod1', 'looks fine',
+			'2024-02-05', '2024-02-06');
+		INSERT INTO audit_log (actor_id, action, subject_user_id, ip_address, user_agent, created_at) VALUES
+			('u1', 'auth.login', 'u1', '203.0.113.7', 'Firefox', '2024-02-01'),
+			(NULL, 'auth.login_failed', 'u1', '192.0.2.9', 'curl', '2024-02-03'),
+			('mod1', 'admin.suspend_user', 'u1', '198.51.100.1', 'StaffBrowser', '2024-02-07');
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed tables: %v", err)
+	}
+
+	storage := NewLocalStorage(t.TempDir())
+	storage.Put("media/aa/avatar.jpg", []byte("avatar bytes"), "image/jpeg")
+	// media/bb/post.jpg is deliberately missing from storage.
+
+	var sent []sentNotification
+	exporter := NewDataExporter(storage, time.Hour, func(userID, notifType, message, link string) {
+		sent = append(sent, sentNotification{userID, notifType, message, link})
+	})
+	return exporter, storage, &sent
+}
+
+func readZip(t *testing.T, storage Storage, key string) map[string][]byte {
+	f, info, err := storage.Open(key)
+	if err != nil {
+		t.Fatalf("export archive not stored: %v", err)
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	zr, err := zip.NewReader(bytes.NewReader(data), info.Size)
+	if err != nil {
+		t.Fatalf("export is not a valid ZIP: %v", err)
+	}
+	files := make(map[string][]byte)
+	for _, zf := range zr.File {
+		rc, err := zf.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", zf.Name, err)
+		}
+		files[zf.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	return files
+}
+
+func TestDataExportBuildsArchiveAndNotifies(t *testing.T) {
+	exporter, storage, sent := newTestExporter(t)
+
+	export, err := exporter.Request("u1")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if _, err := exporter.Request("u1"); err != models.ErrExportInProgress {
+		t.Fatalf("second Request = %v, want ErrExportInProgress", err)
+	}
+	if err := exporter.Build(export.ID); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	export, _ = models.GetDataExport(export.ID)
+	if export.Status != models.ExportReady || export.ExpiresAt == nil || export.Size == 0 {
+		t.Fatalf("export not marked ready: %+v", export)
+	}
+	if len(*sent) != 1 || (*sent)[0].userID != "u1" || (*sent)[0].notifType != NotifDataExportReady ||
+		(*sent)[0].link != DataExportDownloadPath(export.ID) {
+		t.Fatalf("unexpected notifications: %+v", *sent)
+	}
+
+	files := readZip(t, storage, export.StorageKey)
+	for _, name := range []string{"profile.json", "posts.json", "comments.json", "likes.json", "followers.json",
+		"following.json", "follow_requests.json", "notifications.json", "messages.json", "sessions.json", "blocks.json",
+		"mutes.json", "muted_keywords.json", "reports.json", "account_activity.json"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("archive is missing %s", name)
+		}
+	}
+	if strings.Contains(string(files["profile.json"]), "secret-hash") {
+		t.Errorf("profile.json leaks the password hash")
+	}
+	var profile map[string]interface{}
+	if err := json.Unmarshal(files["profile.json"], &profile); err != nil || profile["email"] != "alice@example.com" {
+		t.Errorf("profile.json = %s (%v)", files["profile.json"], err)
+	}
+	var posts []map[string]interface{}
+	if err := json.Unmarshal(files["posts.json"], &posts); err != nil || len(posts) != 1 || posts[0]["allowed_user_ids"] != "u2" {
+		t.Errorf("posts.json = %s (%v)", files["posts.json"], err)
+	}
+	if !strings.Contains(string(files["messages.json"]), "hi Alice") {
+		t.Errorf("messages.json is missing received messages: %s", files["messages.json"])
+	}
+	if strings.Contains(string(files["sessions.json"]), "secret-token") || !strings.Contains(string(files["sessions.json"]), "203.0.113.7") {
+		t.Errorf("sessions.json should list session details without tokens: %s", files["sessions.json"])
+	}
+	var blocks []map[string]interface{}
+	if err := json.Unmarshal(files["blocks.json"], &blocks); err != nil || len(blocks) != 1 || blocks[0]["blocked_id"] != "u2" {
+		t.Errorf("blocks.json should only list users Alice blocked: %s (%v)", files["blocks.json"], err)
+	}
+	if strings.Contains(string(files["reports.json"]), "mod1") || strings.Contains(string(files["reports.json"]), "looks fine") {
+		t.Errorf("reports.json names the moderator: %s", files["reports.json"])
+	}
+	var activity []map[string]interface{}
+	if err := json.Unmarshal(files["account_activity.json"], &activity); err != nil || len(activity) != 3 ||
+		activity[0]["actor_id"] != "u1" || activity[2]["actor_id"] != nil {
+		t.Errorf("account_activity.json should hide staff actors: %s (%v)", files["account_activity.json"], err)
+	}
+	if a := string(files["account_activity.json"]); strings.Contains(a, "198.51.100.1") || strings.Contains(a, "StaffBrowser") {
+		t.Errorf("account_activity.json shows where staff acted from: %s", a)
+	}
+	if a := string(files["account_activity.json"]); !strings.Contains(a, "192.0.2.9") || !strings.Contains(a, "curl") {
+		t.Errorf("account_activity.json should keep the client details of failed logins: %s", a)
+	}
+	if string(files["media/aa/avatar.jpg"]) != "avatar bytes" {
+		t.Errorf("avatar not included in archive")
+	}
+
+	// Building again is a no-op once the export is ready.
+	if err := exporter.Build(export.ID); err != nil || len(*sent) != 1 {
+		t.Fatalf("rebuilding a ready export: err=%v notifications=%d", err, len(*sent))
+	}
+}
+
+func TestDataExportSweepRemovesExpired(t *testing.T) {
+	exporter, storage, _ := newTestExporter(t)
+
+	export, err := exporter.Request("u1")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if err := exporter.Build(export.ID); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	export, _ = models.GetDataExport(export.ID)
+
+	exporter.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if err := exporter.Sweep(); err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if gone, _ := models.GetDataExport(export.ID); gone != nil {
+		t.Fatalf("expired export row was kept")
+	}
+	if _, _, err := storage.Open(export.StorageKey); err != ErrObjectNotFound {
+		t.Fatalf("expired export archive was kept: %v", err)
+	}
+}
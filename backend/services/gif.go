@@ -0,0 +1,127 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+)
+
+// Limits for animated GIFs. Animations are stored as uploaded rather than re-encoded,
+// so they are held to tighter bounds than still images.
+const (
+	// MaxGIFDimension is the largest width or height of a GIF's logical screen.
+	MaxGIFDimension = MaxStoredDimension
+	// MaxGIFFrames is the most frames a single GIF may contain.
+	MaxGIFFrames = 300
+	// MaxGIFTotalPixels caps the pixels summed over every frame, which bounds the
+	// work any client has to do to play the animation.
+	MaxGIFTotalPixels = 50_000_000
+)
+
+var ErrGIFTooManyFrames = errors.New("animated GIF has too many frames")
+
+// validateGIF walks the GIF block structure without decompressing any frame data and
+// checks the logical screen, every frame's bounds, the frame count and the total pixel
+// count. It is cheap enough to run before anything is decoded.
+func validateGIF(data []byte) error {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return ErrInvalidImage
+	}
+	screenW := int(binary.LittleEndian.Uint16(data[6:8]))
+	screenH := int(binary.LittleEndian.Uint16(data[8:10]))
+	if screenW == 0 || screenH == 0 || screenW > MaxGIFDimension || screenH > MaxGIFDimension {
+		return ErrImageDimensions
+	}
+
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << ((flags & 0x07) + 1) // global color table
+	}
+
+	frames, totalPixels := 0, 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // extension: label byte followed by data sub-blocks
+			next, ok := skipSubBlocks(data, pos+2)
+			if !ok {
+				return ErrInvalidImage
+			}
+			pos = next
+		case 0x2C: // image descriptor
+			if pos+10 > len(data) {
+				return ErrInvalidImage
+			}
+			left := int(binary.LittleEndian.Uint16(data[pos+1 : pos+3]))
+			top := int(binary.LittleEndian.Uint16(data[pos+3 : pos+5]))
+			w := int(binary.LittleEndian.Uint16(data[pos+5 : pos+7]))
+			h := int(binary.LittleEndian.Uint16(data[pos+7 : pos+9]))
+			if w == 0 || h == 0 || left+w > screenW || top+h > screenH {
+				return ErrImageDimensions
+			}
+			frames++
+			totalPixels += w * h
+			if frames > MaxGIFFrames {
+				return ErrGIFTooManyFrames
+			}
+			if totalPixels > MaxGIFTotalPixels {
+				return ErrImageDimensions
+			}
+
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << ((flags & 0x07) + 1) // local color table
+			}
+			// Skip the LZW minimum code size byte, then the compressed frame data.
+			next, ok := skipSubBlocks(data, pos+1)
+			if !ok {
+				return ErrInvalidImage
+			}
+			pos = next
+		case 0x3B: // trailer
+			if frames == 0 {
+				return ErrInvalidImage
+			}
+			return nil
+		default:
+			return ErrInvalidImage
+		}
+	}
+	// Some encoders omit the trailer; accept the file as long as it had a frame.
+	if frames == 0 {
+		return ErrInvalidImage
+	}
+	return nil
+}
+
+// skipSubBlocks returns the offset just past the chain of data sub-blocks starting at pos.
+func skipSubBlocks(data []byte, pos int) (int, bool) {
+	for pos < len(data) {
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, true
+		}
+		pos += size
+	}
+	return 0, false
+}
+
+// gifFirstFrame decodes only the first frame of a GIF and draws it onto a canvas the
+// size of the logical screen, giving a static preview of the animation.
+func gifFirstFrame(data []byte) (*image.RGBA, error) {
+	cfg, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	frame, err := gif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, cfg.Width, cfg.Height))
+	draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+	return canvas, nil
+}
@@ -1,85 +1,318 @@
 package services
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
 	"io"
 	"mime/multipart"
-	"os"
-	"path/filepath"
+	"net/http"
+	"path"
 	"strings"
+	"sync"
 	"time"
+
+	"social-network/database/models"
 )
 
-type ImageService struct {
-	uploadDir string
+// MaxImageSize is the largest image upload we accept (5MB).
+const MaxImageSize = 5 << 20
+
+var (
+	ErrImageTooLarge        = errors.New("image exceeds the maximum allowed size")
+	ErrUnsupportedImageType = errors.New("unsupported image type, only JPEG, PNG and GIF are allowed")
+	ErrInvalidImage         = errors.New("image could not be decoded")
+	ErrImageDimensions      = errors.New("image dimensions exceed the allowed maximum")
+	ErrInvalidImagePath     = errors.New("invalid image path")
+)
+
+// Names of the scaled copies generated next to every stored still image.
+const (
+	ThumbnailVariant = "thumb"
+	MediumVariant    = "medium"
+)
+
+// IsImageRejected reports whether err means the upload itself was unacceptable,
+// as opposed to a server-side failure while storing it.
+func IsImageRejected(err error) bool {
+	return errors.Is(err, ErrImageTooLarge) || errors.Is(err, ErrUnsupportedImageType) ||
+		errors.Is(err, ErrInvalidImage) || errors.Is(err, ErrImageDimensions) ||
+		errors.Is(err, ErrGIFTooManyFrames)
 }
 
-func NewImageService(uploadDir string) *ImageService {
-	// Create upload directory if it doesn't exist
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		os.MkdirAll(uploadDir, 0o755)
-	}
+// allowedImageTypes maps the sniffed content types we accept to the extension we store them under.
+var allowedImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
 
+// SignedURLLifetime is how long a signed media URL handed to a client stays valid.
+const SignedURLLifetime = 15 * time.Minute
+
+// blobPrefix is the storage prefix under which deduplicated uploads are kept.
+const blobPrefix = "media"
+
+type ImageService struct {
+	storage Storage
+	// blobMu keeps a blob from being deleted by ReleaseImage while SaveImage is
+	// handing out a new reference to it or writing it back.
+	blobMu sync.Mutex
+}
+
+func NewImageService(storage Storage) *ImageService {
 	return &ImageService{
-		uploadDir: uploadDir,
+		storage: storage,
 	}
 }
 
-func (s *ImageService) ValidateImage(handler *multipart.FileHeader) (bool, error) {
-	// Check file size (max 5MB)
-	if handler.Size > 5<<20 {
-		return false, nil
+// ValidateImage checks the upload's size and sniffs its first bytes to find the real
+// content type. The client-supplied Content-Type header and file name are not trusted.
+// On success the file is rewound and the detected content type is returned.
+func (s *ImageService) ValidateImage(file multipart.File, handler *multipart.FileHeader) (string, error) {
+	if handler.Size > MaxImageSize {
+		return "", ErrImageTooLarge
 	}
 
-	// Check file type
-	contentType := handler.Header.Get("Content-Type")
-	if contentType != "image/jpeg" && contentType != "image/png" && contentType != "image/gif" {
-		return false, nil
+	// DetectContentType considers at most the first 512 bytes.
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
 	}
-
-	// Check file extension
-	ext := filepath.Ext(handler.Filename)
-	ext = strings.ToLower(ext)
-	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".gif" {
-		return false, nil
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
 	}
 
-	return true, nil
+	contentType := http.DetectContentType(buf[:n])
+	if _, ok := allowedImageTypes[contentType]; !ok {
+		return "", ErrUnsupportedImageType
+	}
+	return contentType, nil
 }
 
-func (s *ImageService) SaveImage(file multipart.File, handler *multipart.FileHeader, subdir string) (string, error) {
-	// Create subdirectory if it doesn't exist
-	dirPath := filepath.Join(s.uploadDir, subdir)
-	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
-		os.MkdirAll(dirPath, 0o755)
+// SaveImage stores an already validated image and returns its path relative to the
+// upload directory. JPEG and PNG uploads are decoded, scaled down to MaxStoredDimension
+// and re-encoded, which drops EXIF/GPS metadata. GIFs are checked frame by frame and
+// kept as uploaded so they stay animated. Every image also gets a thumbnail and medium
+// variant; for GIFs these are static PNGs of the first frame.
+//
+// Uploads are content-addressed: identical files are stored once under a name derived
+// from their SHA-256 hash, and each call takes a reference on that blob. Callers must
+// hand the path back to ReleaseImage once the post, comment, avatar or message that
+// uses it is gone (or was never created).
+func (s *ImageService) SaveImage(file multipart.File, contentType string) (string, error) {
+	ext, ok := allowedImageTypes[contentType]
+	if !ok {
+		return "", ErrUnsupportedImageType
 	}
 
-	// Create a new file name to prevent overwriting and directory traversal
-	ext := filepath.Ext(handler.Filename)
-	newFileName := time.Now().Format("20060102150405") + "_" + GenerateRandomString(8) + ext
-	filePath := filepath.Join(dirPath, newFileName)
-
-	// Create the file
-	dst, err := os.Create(filePath)
+	data, err := io.ReadAll(io.LimitReader(file, MaxImageSize+1))
 	if err != nil {
 		return "", err
 	}
-	defer dst.Close()
+	if len(data) > MaxImageSize {
+		return "", ErrImageTooLarge
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if relativePath, found, err := s.acquireBlob(hash); err != nil || found {
+		return relativePath, err
+	}
+
+	// original is what gets written at the returned path, still is what the
+	// variants are scaled from and variantType is how they are encoded.
+	var original []byte
+	var still *image.RGBA
+	variantType := contentType
+	if contentType == "image/gif" {
+		if err := validateGIF(data); err != nil {
+			return "", err
+		}
+		if still, err = gifFirstFrame(data); err != nil {
+			return "", err
+		}
+		original = data
+		variantType = "image/png"
+	} else {
+		img, err := decodeStillImage(data, contentType)
+		if err != nil {
+			return "", err
+		}
+		still = resizeToFit(img, MaxStoredDimension)
+		var buf bytes.Buffer
+		if err := encodeImage(&buf, still, contentType); err != nil {
+			return "", err
+		}
+		original = buf.Bytes()
+	}
+
+	files := map[string][]byte{}
+	for variant, size := range imageVariantSizes {
+		var buf bytes.Buffer
+		if err := encodeImage(&buf, resizeToFit(still, size), variantType); err != nil {
+			return "", err
+		}
+		files[variant] = buf.Bytes()
+	}
+
+	// The name is derived from the content, so it can't collide with other uploads
+	// or be steered by the client.
+	relativePath := path.Join(blobPrefix, hash[:2], hash+ext)
 
-	// Copy the uploaded file to the filesystem
-	if _, err := io.Copy(dst, file); err != nil {
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+	// The same content may have been stored by a concurrent upload since the check
+	// above; writing it again would overwrite, and on failure delete, its files.
+	if existing, found, err := models.AcquireMediaBlob(hash); err != nil || found {
+		return existing, err
+	}
+
+	written := []string{}
+	save := func(relPath string, data []byte, contentType string) error {
+		if err := s.storage.Put(relPath, data, contentType); err != nil {
+			return err
+		}
+		written = append(written, relPath)
+		return nil
+	}
+
+	err = save(relativePath, original, contentType)
+	for variant, data := range files {
+		if err != nil {
+			break
+		}
+		err = save(VariantPath(relativePath, variant), data, variantType)
+	}
+	if err == nil {
+		err = models.RecordMediaBlob(hash, relativePath)
+	}
+	if err != nil {
+		// Don't leave half of a set of variants behind.
+		for _, relPath := range written {
+			s.storage.Delete(relPath)
+		}
 		return "", err
 	}
 
 	// Return the relative path
-	return filepath.Join(subdir, newFileName), nil
+	return relativePath, nil
 }
 
-func (s *ImageService) GetImagePath(relativePath string) string {
-	return filepath.Join(s.uploadDir, relativePath)
+// acquireBlob takes a reference on an already stored upload with the given hash.
+func (s *ImageService) acquireBlob(hash string) (string, bool, error) {
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+	return models.AcquireMediaBlob(hash)
+}
+
+// ReleaseImage drops the reference SaveImage took on an image. The stored files are
+// deleted once nothing references them any more. Images stored before deduplication
+// are never shared, so they are deleted straight away.
+func (s *ImageService) ReleaseImage(relativePath string) error {
+	if relativePath == "" {
+		return nil
+	}
+	// Older avatars were stored with the upload directory in front of them.
+	key, err := CleanKey(strings.TrimPrefix(strings.TrimPrefix(relativePath, "/"), "uploads/"))
+	if err != nil {
+		return err
+	}
+
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+	tracked, last, err := models.ReleaseMediaBlob(key)
+	if err != nil {
+		return err
+	}
+	if tracked && !last {
+		return nil
+	}
+	return s.deleteImage(key)
+}
+
+// gifStillExt is appended to GIF variant names: the variants are PNG stills, and keeping
+// ".gif" in the name lets OriginalPath find the animation they were taken from.
+const gifStillExt = ".gif.png"
+
+// VariantPath returns the relative path of a scaled variant of a stored image,
+// or "" when there is no image.
+func VariantPath(relativePath, variant string) string {
+	if relativePath == "" {
+		return ""
+	}
+	ext := path.Ext(relativePath)
+	base := strings.TrimSuffix(relativePath, ext)
+	if ext == ".gif" {
+		return base + "_" + variant + gifStillExt
+	}
+	return base + "_" + variant + ext
+}
+
+// OriginalPath maps a variant path back to the image it was generated from.
+// Paths that are not variants are returned unchanged.
+func OriginalPath(relativePath string) string {
+	ext := path.Ext(relativePath)
+	if strings.HasSuffix(relativePath, gifStillExt) {
+		ext = gifStillExt
+	}
+	base := strings.TrimSuffix(relativePath, ext)
+	if ext == gifStillExt {
+		ext = ".gif"
+	}
+	for variant := range imageVariantSizes {
+		if strings.HasSuffix(base, "_"+variant) {
+			return strings.TrimSuffix(base, "_"+variant) + ext
+		}
+	}
+	return relativePath
+}
+
+// IsAnimated reports whether the stored image at relativePath may be animated.
+func IsAnimated(relativePath string) bool {
+	return path.Ext(relativePath) == ".gif"
+}
+
+// OpenImage opens a stored image or variant for streaming.
+func (s *ImageService) OpenImage(relativePath string) (ReadSeekCloser, ObjectInfo, error) {
+	key, err := CleanKey(relativePath)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return s.storage.Open(key)
+}
+
+// SignedImageURL returns a short-lived URL the client can fetch the image from directly,
+// or "" when the storage backend requires the server to stream it.
+func (s *ImageService) SignedImageURL(relativePath string) (string, error) {
+	key, err := CleanKey(relativePath)
+	if err != nil {
+		return "", err
+	}
+	return s.storage.SignedURL(key, SignedURLLifetime)
+}
+
+// deleteImage removes a stored image together with its variants.
+func (s *ImageService) deleteImage(relativePath string) error {
+	key, err := CleanKey(relativePath)
+	if err != nil {
+		return err
+	}
+	for variant := range imageVariantSizes {
+		if err := s.storage.Delete(VariantPath(key, variant)); err != nil {
+			return err
+		}
+	}
+	return s.storage.Delete(key)
 }
 
+// GenerateRandomString returns a random hex string of the given length.
 func GenerateRandomString(length int) string {
-	// Implementation of random string generation
-	// You can use a proper random string generator here
-	return "random" // Placeholder
+	b := make([]byte, (length+1)/2)
+	rand.Read(b) // crypto/rand.Read never returns an error since Go 1.24
+	return hex.EncodeToString(b)[:length]
 }
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"social-network/database"
+	"social-network/database/dbtest"
+)
+
+// fakeUpload adapts a byte slice to multipart.File for SaveImage.
+type fakeUpload struct {
+	*bytes.Reader
+}
+
+func (fakeUpload) Close() error { return nil }
+
+// newTestImageService returns an ImageService backed by a temporary directory and an
+// in-memory database.
+func newTestImageService(t *testing.T) (*ImageService, string) {
+	dbtest.Open(t)
+	dir := t.TempDir()
+	return NewImageService(NewLocalStorage(dir)), dir
+}
+
+func newTestImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 100, 255})
+		}
+	}
+	return img
+}
+
+// withExifOrientation splices an APP1 Exif segment carrying the given orientation
+// (and nothing else) right after the SOI marker of a JPEG.
+func withExifOrientation(jpg []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = append(tiff, 0, 1) // one IFD entry
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3) // SHORT
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0) // no next IFD
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func TestResizeToFitKeepsAspectRatio(t *testing.T) {
+	got := resizeToFit(newTestImage(400, 200), 100)
+	if got.Rect.Dx() != 100 || got.Rect.Dy() != 50 {
+		t.Fatalf("resizeToFit produced %dx%d, want 100x50", got.Rect.Dx(), got.Rect.Dy())
+	}
+	small := newTestImage(40, 20)
+	if resizeToFit(small, 100) != small {
+		t.Fatalf("resizeToFit should return images that already fit unchanged")
+	}
+}
+
+func TestJPEGOrientationIsAppliedAndStripped(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, newTestImage(60, 30), nil); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	data := withExifOrientation(buf.Bytes(), 6)
+	if got := jpegOrientation(data); got != 6 {
+		t.Fatalf("jpegOrientation = %d, want 6", got)
+	}
+
+	s, dir := newTestImageService(t)
+	rel, err := s.SaveImage(fakeUpload{bytes.NewReader(data)}, "image/jpeg")
+	if err != nil {
+		t.Fatalf("SaveImage failed: %v", err)
+	}
+
+	stored, err := os.ReadFile(filepath.Join(dir, rel))
+	if err != nil {
+		t.Fatalf("reading stored image: %v", err)
+	}
+	if bytes.Contains(stored, []byte("Exif\x00\x00")) {
+		t.Fatalf("stored image still carries EXIF data")
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatalf("stored image is not a JPEG: %v", err)
+	}
+	// Orientation 6 is a 90 degree rotation, so width and height swap.
+	if cfg.Width != 30 || cfg.Height != 60 {
+		t.Fatalf("stored image is %dx%d, want 30x60", cfg.Width, cfg.Height)
+	}
+
+	for _, variant := range []string{ThumbnailVariant, MediumVariant} {
+		if _, err := os.Stat(filepath.Join(dir, VariantPath(rel, variant))); err != nil {
+			t.Fatalf("%s variant missing: %v", variant, err)
+		}
+	}
+	if OriginalPath(VariantPath(rel, ThumbnailVariant)) != rel {
+		t.Fatalf("OriginalPath did not map the thumbnail back to %s", rel)
+	}
+}
+
+func TestSaveImageDownscalesLargeImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, MaxStoredDimension+500, 10))); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	s, dir := newTestImageService(t)
+	rel, err := s.SaveImage(fakeUpload{bytes.NewReader(buf.Bytes())}, "image/png")
+	if err != nil {
+		t.Fatalf("SaveImage failed: %v", err)
+	}
+	f, err := os.Open(filepath.Join(dir, rel))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	cfg, err := png.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if cfg.Width != MaxStoredDimension {
+		t.Fatalf("stored width = %d, want %d", cfg.Width, MaxStoredDimension)
+	}
+}
+
+func TestSaveImageRejectsGarbage(t *testing.T) {
+	s, _ := newTestImageService(t)
+	_, err := s.SaveImage(fakeUpload{bytes.NewReader([]byte("\xFF\xD8not really a jpeg"))}, "image/jpeg")
+	if !IsImageRejected(err) {
+		t.Fatalf("expected a rejected-image error, got %v", err)
+	}
+}
+
+func TestGIFKeepsAnimationAndGetsStillPreviews(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{}
+	for i := 0; i < 3; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 40, 20), palette))
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	s, dir := newTestImageService(t)
+	rel, err := s.SaveImage(fakeUpload{bytes.NewReader(buf.Bytes())}, "image/gif")
+	if err != nil {
+		t.Fatalf("SaveImage failed: %v", err)
+	}
+	stored, err := os.ReadFile(filepath.Join(dir, rel))
+	if err != nil || !bytes.Equal(stored, buf.Bytes()) {
+		t.Fatalf("animated GIF was not stored unchanged (err %v)", err)
+	}
+
+	thumb := VariantPath(rel, ThumbnailVariant)
+	f, err := os.Open(filepath.Join(dir, thumb))
+	if err != nil {
+		t.Fatalf("preview missing: %v", err)
+	}
+	defer f.Close()
+	if _, err := png.DecodeConfig(f); err != nil {
+		t.Fatalf("preview is not a PNG: %v", err)
+	}
+	if OriginalPath(thumb) != rel {
+		t.Fatalf("OriginalPath(%s) = %s, want %s", thumb, OriginalPath(thumb), rel)
+	}
+}
+
+func TestValidateGIFRejectsTooManyFrames(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{}
+	for i := 0; i < MaxGIFFrames+1; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 2, 2), palette))
+		anim.Delay = append(anim.Delay, 1)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := validateGIF(buf.Bytes()); err != ErrGIFTooManyFrames {
+		t.Fatalf("validateGIF = %v, want ErrGIFTooManyFrames", err)
+	}
+}
+
+func TestSaveImageDeduplicatesAndRefcounts(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, newTestImage(50, 50)); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	s, dir := newTestImageService(t)
+	first, err := s.SaveImage(fakeUpload{bytes.NewReader(buf.Bytes())}, "image/png")
+	if err != nil {
+		t.Fatalf("SaveImage failed: %v", err)
+	}
+	second, err := s.SaveImage(fakeUpload{bytes.NewReader(buf.Bytes())}, "image/png")
+	if err != nil {
+		t.Fatalf("second SaveImage failed: %v", err)
+	}
+	if first != second {
+		t.Fatalf("identical uploads stored twice: %s and %s", first, second)
+	}
+
+	if err := s.ReleaseImage(first); err != nil {
+		t.Fatalf("ReleaseImage: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, first)); err != nil {
+		t.Fatalf("blob removed while still referenced: %v", err)
+	}
+	if err := s.ReleaseImage(second); err != nil {
+		t.Fatalf("ReleaseImage: %v", err)
+	}
+	for _, rel := range []string{first, VariantPath(first, ThumbnailVariant), VariantPath(first, MediumVariant)} {
+		if _, err := os.Stat(filepath.Join(dir, rel)); !os.IsNotExist(err) {
+			t.Fatalf("%s should be gone after the last release (err %v)", rel, err)
+		}
+	}
+}
+
+// flakyStorage allows the first puts writes and fails every Put after them.
+type flakyStorage struct {
+	Storage
+	mu   sync.Mutex
+	puts int
+}
+
+func (f *flakyStorage) Put(key string, data []byte, contentType string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.puts == 0 {
+		return errors.New("storage unavailable")
+	}
+	f.puts--
+	return f.Storage.Put(key, data, contentType)
+}
+
+// TestSaveImageConcurrentIdenticalUploads stores the same upload from several goroutines
+// while storage fails after the first copy is written. The uploads that find the copy
+// must share it rather than write their own and delete it on failure.
+func TestSaveImageConcurrentIdenticalUploads(t *testing.T) {
+	var buf bytes.Buffer
+	// Large enough that the uploads are still being processed when the first one is stored.
+	if err := png.Encode(&buf, newTestImage(600, 600)); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	s, dir := newTestImageService(t)
+	s.storage = &flakyStorage{Storage: s.storage, puts: 1 + len(imageVariantSizes)}
+
+	const uploads = 8
+	paths := make([]string, uploads)
+	errs := make([]error, uploads)
+	var wg sync.WaitGroup
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			paths[i], errs[i] = s.SaveImage(fakeUpload{bytes.NewReader(buf.Bytes())}, "image/png")
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range paths {
+		if errs[i] != nil || paths[i] != paths[0] {
+			t.Fatalf("upload %d = %q, %v; want %q", i, paths[i], errs[i], paths[0])
+		}
+	}
+	var refs int
+	if err := database.DB.QueryRow("SELECT ref_count FROM media_blobs WHERE path = ?", paths[0]).Scan(&refs); err != nil || refs != uploads {
+		t.Fatalf("ref_count = %d, %v; want %d", refs, err, uploads)
+	}
+	if _, err := os.Stat(filepath.Join(dir, paths[0])); err != nil {
+		t.Fatalf("stored blob missing: %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidEmailHeader = errors.New("email headers cannot contain line breaks")
+
+// Email is a plain-text message to a single recipient.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email to users, such as password reset links.
+type Mailer interface {
+	Send(msg *Email) error
+}
+
+// NewMailerFromEnv builds the Mailer selected by the MAIL_BACKEND environment variable:
+// "log" (the default) writes messages to MAIL_DIR, or to the server log if MAIL_DIR is
+// unset, and is meant for local development; "smtp" sends them through the server
+// configured by SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME and SMTP_PASSWORD.
+// MAIL_FROM sets the sender address.
+func NewMailerFromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	switch backend := os.Getenv("MAIL_BACKEND"); backend {
+	case "", "log":
+		return NewLogMailer(os.Getenv("MAIL_DIR"), from), nil
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return NewSMTPMailer(os.Getenv("SMTP_HOST"), port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+	default:
+		return nil, fmt.Errorf("unknown MAIL_BACKEND %q", backend)
+	}
+}
+
+// AppBaseURL returns the address of the web app that links in emails point to, set by
+// APP_BASE_URL (default http://localhost:3000).
+func AppBaseURL() string {
+	if u := os.Getenv("APP_BASE_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "http://localhost:3000"
+}
+
+// newSecretToken returns a random token for a link sent by email or a similar one-off
+// credential.
+func newSecretToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// hashSecretToken returns the form of a secret token kept in the database, so a leaked
+// database can't be used to take over accounts.
+func hashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// formatEmail renders msg as an RFC 5322 message.
+func formatEmail(from string, msg *Email, now time.Time) ([]byte, error) {
+	for _, header := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, ErrInvalidEmailHeader
+		}
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.Bytes(), nil
+}
+
+// SMTPMailer sends email through an SMTP server, using STARTTLS when the server offers it.
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer creates a mailer for the server at host:port. The username and password
+// may be empty for servers that don't require authentication.
+func NewSMTPMailer(host, port, username, password, from string) (*SMTPMailer, error) {
+	if host == "" {
+		return nil, errors.New("SMTP_HOST is required for the smtp mail backend")
+	}
+	m := &SMTPMailer{addr: net.JoinHostPort(host, port), from: from}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m, nil
+}
+
+// Send delivers msg.
+func (m *SMTPMailer) Send(msg *Email) error {
+	data, err := formatEmail(m.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, data)
+}
+
+// LogMailer writes each message to its own .eml file in a directory instead of sending
+// it, or to the server log if no directory is set.
+type LogMailer struct {
+	dir  string
+	from string
+}
+
+// NewLogMailer creates a mailer writing to dir, or to the log if dir is "".
+func NewLogMailer(dir, from string) *LogMailer {
+	return &LogMailer{dir: dir, from: from}
+}
+
+// Send records msg.
+func (m *LogMailer) Send(msg *Email) error {
+	now := time.Now()
+	data, err := formatEmail(m.from, msg, now)
+	if err != nil {
+		return err
+	}
+	if m.dir == "" {
+		log.Printf("Mail to %s:\n%s", msg.To, data)
+		return nil
+	}
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%s.eml", now.UTC().Format("20060102150405"), uuid.NewString()[:8])
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o600)
+}
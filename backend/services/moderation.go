@@ -0,0 +1,24 @@
+package services
+
+import (
+	"log"
+
+	"social-network/database/models"
+)
+
+// RemoveContent deletes a post, comment or chat message for moderation and then
+// releases the uploaded files it referenced, including the images on a removed post's
+// comments. It reports whether the content existed. Like EraseAccount, files that fail
+// to be released are left for the orphaned upload collector.
+func RemoveContent(images *ImageService, targetType, targetID string) (bool, error) {
+	removed, media, err := models.RemoveContent(targetType, targetID)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range media {
+		if err := images.ReleaseImage(p); err != nil {
+			log.Printf("Content removal: could not release %s for %s %s: %v", p, targetType, targetID, err)
+		}
+	}
+	return removed, nil
+}
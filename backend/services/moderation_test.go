@@ -0,0 +1,81 @@
+package services
+
+import (
+	"bytes"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"social-network/database"
+	"social-network/database/models"
+)
+
+func TestRemoveContentReleasesMedia(t *testing.T) {
+	s, dir := newTestImageService(t)
+	_, err := database.DB.Exec(`
+		INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth) VALUES
+			('u1', 'Alice', 'A', 'a@example.com', 'h', '2000-01-01'), ('u2', 'Bob', 'B', 'b@example.com', 'h', '2000-01-01');`)
+	if err != nil {
+		t.Fatalf("failed to seed users: %v", err)
+	}
+
+	save := func(size int) string {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, newTestImage(size, size)); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		rel, err := s.SaveImage(fakeUpload{bytes.NewReader(buf.Bytes())}, "image/png")
+		if err != nil {
+			t.Fatalf("SaveImage failed: %v", err)
+		}
+		return rel
+	}
+	refCount := func(path string) int {
+		var n int
+		if err := database.DB.QueryRow("SELECT COALESCE(SUM(ref_count), 0) FROM media_blobs WHERE path = ?", path).Scan(&n); err != nil {
+			t.Fatalf("reading ref_count: %v", err)
+		}
+		return n
+	}
+
+	// The post's image is also used by a second post, so it must survive the removal.
+	shared, commentImage, attachment := save(40), save(50), save(60)
+	if again := save(40); again != shared {
+		t.Fatalf("identical uploads stored twice: %s and %s", shared, again)
+	}
+	_, err = database.DB.Exec(`
+		INSERT INTO posts (id, user_id, content, image_url) VALUES (1, 'u1', 'a', ?), (2, 'u2', 'b', ?);
+		INSERT INTO comments (id, post_id, user_id, content, image_url) VALUES (10, 1, 'u2', 'c', ?);
+		INSERT INTO chat_messages (id, sender_id, recipient_id, content, attachment_path) VALUES ('20', 'u1', 'u2', 'd', ?);`,
+		shared, shared, commentImage, attachment)
+	if err != nil {
+		t.Fatalf("failed to seed content: %v", err)
+	}
+
+	if removed, err := RemoveContent(s, models.ReportTargetPost, "1"); err != nil || !removed {
+		t.Fatalf("RemoveContent(post) = %v, %v", removed, err)
+	}
+	if n := refCount(shared); n != 1 {
+		t.Fatalf("shared image ref_count = %d, want 1", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, shared)); err != nil {
+		t.Fatalf("image still used by another post was deleted: %v", err)
+	}
+	if n := refCount(commentImage); n != 0 {
+		t.Fatalf("image on a comment of the removed post has ref_count %d, want 0", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, commentImage)); !os.IsNotExist(err) {
+		t.Fatalf("image on a comment of the removed post should be deleted (err %v)", err)
+	}
+
+	if removed, err := RemoveContent(s, models.ReportTargetMessage, "20"); err != nil || !removed {
+		t.Fatalf("RemoveContent(message) = %v, %v", removed, err)
+	}
+	if n := refCount(attachment); n != 0 {
+		t.Fatalf("message attachment has ref_count %d, want 0", n)
+	}
+	if removed, err := RemoveContent(s, models.ReportTargetMessage, "20"); err != nil || removed {
+		t.Fatalf("removing a missing message = %v, %v", removed, err)
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"social-network/database/models"
+)
+
+// MinPasswordLength is the shortest password a user can set.
+const MinPasswordLength = 8
+
+var ErrPasswordTooShort = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+
+const (
+	// DefaultPasswordResetLifetime is how long an emailed reset link works.
+	DefaultPasswordResetLifetime = time.Hour
+	// passwordResetCooldown limits how often reset emails are sent to the same account.
+	passwordResetCooldown = time.Minute
+)
+
+// ValidatePassword checks a new password against the password rules.
+func ValidatePassword(password string) error {
+	if len([]rune(password)) < MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+	return nil
+}
+
+// PasswordResetter emails password reset links and carries out the resets.
+type PasswordResetter struct {
+	mailer   Mailer
+	baseURL  string
+	lifetime time.Duration
+	now      func() time.Time
+	// pending tracks reset emails still being sent in the background.
+	pending sync.WaitGroup
+}
+
+// NewPasswordResetter creates a resetter whose emails link to baseURL/reset-password.
+func NewPasswordResetter(mailer Mailer, baseURL string, lifetime time.Duration) *PasswordResetter {
+	return &PasswordResetter{
+		mailer:   mailer,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		lifetime: lifetime,
+		now:      time.Now,
+	}
+}
+
+// NewPasswordResetterFromEnv creates a resetter linking to AppBaseURL whose links last
+// PASSWORD_RESET_LIFETIME (a Go duration such as "30m").
+func NewPasswordResetterFromEnv(mailer Mailer) *PasswordResetter {
+	lifetime := DefaultPasswordResetLifetime
+	if d, err := time.ParseDuration(os.Getenv("PASSWORD_RESET_LIFETIME")); err == nil && d > 0 {
+		lifetime = d
+	}
+	return NewPasswordResetter(mailer, AppBaseURL(), lifetime)
+}
+
+// Request emails a reset link to the account with the given address and returns its
+// ID. Unknown addresses return "" and no error, so callers can't tell whether an
+// account exists. The link is created and sent in the background, so the call takes
+// about as long whether or not the account exists. Repeated requests within a minute
+// don't send another email.
+func (p *PasswordResetter) Request(email string) (string, error) {
+	user, err := models.GetUserByEmail(strings.TrimSpace(email))
+	if err != nil || user == nil {
+		return "", err
+	}
+
+	p.pending.Add(1)
+	go func() {
+		defer p.pending.Done()
+		if err := p.send(user); err != nil {
+			log.Printf("Error sending password reset email to user %s: %v", user.ID, err)
+		}
+	}()
+	return user.ID, nil
+}
+
+// send emails user a new reset link unless they were sent one within the cooldown.
+func (p *PasswordResetter) send(user *models.User) error {
+	now := p.now()
+	last, err := models.LastPasswordResetRequest(user.ID)
+	if err != nil {
+		return err
+	}
+	if now.Sub(last) < passwordResetCooldown {
+		return nil
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		return err
+	}
+	if err := models.CreatePasswordResetToken(user.ID, hashSecretToken(token), now, now.Add(p.lifetime)); err != nil {
+		return err
+	}
+
+	return p.mailer.Send(&Email{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset the password of your account. To choose a new password, open this link:\n\n"+
+			"%s/reset-password?token=%s\n\n"+
+			"The link works once and expires in %s. If you didn't ask for this, you can ignore this email; "+
+			"your password stays the same.\n", user.FirstName, p.baseURL, token, p.lifetime),
+	})
+}
+
+// wait blocks until the reset emails requested so far have been sent.
+func (p *PasswordResetter) wait() {
+	p.pending.Wait()
+}
+
+// Confirm sets a new password using an emailed token and returns the user's ID. All of
+// the user's sessions are revoked. It returns models.ErrInvalidResetToken if the token
+// is unknown, used or expired.
+func (p *PasswordResetter) Confirm(token, newPassword string) (string, error) {
+	if err := ValidatePassword(newPassword); err != nil {
+		return "", err
+	}
+	if token == "" {
+		return "", models.ErrInvalidResetToken
+	}
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return "", err
+	}
+	userID, err := models.ResetPassword(hashSecretToken(token), hash, p.now())
+	if errors.Is(err, models.ErrInvalidResetToken) {
+		return "", err
+	}
+	if err != nil {
+		return "", fmt.Errorf("resetting password: %w", err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/database"
+	"social-network/database/dbtest"
+	"social-network/database/models"
+)
+
+type recordingMailer struct {
+	sent []*Email
+}
+
+func (m *recordingMailer) Send(msg *Email) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var resetLinkPattern = regexp.MustCompile(`/reset-password\?token=([A-Za-z0-9_-]+)`)
+
+func newTestResetter(t *testing.T) (*PasswordResetter, *recordingMailer) {
+	dbtest.Open(t)
+	_, err := database.DB.Exec(`
+		INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth, is_public, created_at)
+			VALUES ('u1', 'Alice', 'Smith', 'alice@example.com', 'old-hash', '1990-01-01', 1, '2024-01-01');
+		INSERT INTO sessions (token, user_id, expiry) VALUES ('t1', 'u1', '2099-01-01'), ('t2', 'u1', '2099-01-01');
+	`)
+	if err != nil {
+		t.Fatalf("failed to seed tables: %v", err)
+	}
+
+	mailer := &recordingMailer{}
+	return NewPasswordResetter(mailer, "https://example.com/", time.Hour), mailer
+}
+
+func resetToken(t *testing.T, msg *Email) string {
+	m := resetLinkPattern.FindStringSubmatch(msg.Body)
+	if m == nil {
+		t.Fatalf("no reset link in email: %q", msg.Body)
+	}
+	return m[1]
+}
+
+func TestPasswordReset(t *testing.T) {
+	resets, mailer := newTestResetter(t)
+
+	if id, err := resets.Request("nobody@example.com"); err != nil || id != "" || len(mailer.sent) != 0 {
+		t.Fatalf("unknown address should silently do nothing: %q, %v, %d sent", id, err, len(mailer.sent))
+	}
+	id, err := resets.Request("alice@example.com")
+	resets.wait()
+	if err != nil || id != "u1" || len(mailer.sent) != 1 {
+		t.Fatalf("Request = %q, %v, %d sent", id, err, len(mailer.sent))
+	}
+	if mailer.sent[0].To != "alice@example.com" || !strings.Contains(mailer.sent[0].Body, "https://example.com/reset-password?token=") {
+		t.Fatalf("unexpected email: %+v", mailer.sent[0])
+	}
+	resets.Request("alice@example.com")
+	resets.wait()
+	if len(mailer.sent) != 1 {
+		t.Fatal("a second request within the cooldown should not send another email")
+	}
+	token := resetToken(t, mailer.sent[0])
+
+	var stored int
+	database.DB.QueryRow("SELECT COUNT(*) FROM password_reset_tokens WHERE token_hash = ?", token).Scan(&stored)
+	if stored != 0 {
+		t.Fatal("the token must only be stored hashed")
+	}
+
+	if _, err := resets.Confirm(token, "short"); err != ErrPasswordTooShort {
+		t.Fatalf("short password should be refused, got %v", err)
+	}
+	if _, err := resets.Confirm("not-a-token", "a long enough password"); err != models.ErrInvalidResetToken {
+		t.Fatalf("unknown token should be refused, got %v", err)
+	}
+	if id, err := resets.Confirm(token, "a long enough password"); err != nil || id != "u1" {
+		t.Fatalf("Confirm = %q, %v", id, err)
+	}
+
+	var hash string
+	var sessions int
+	database.DB.QueryRow("SELECT password_hash FROM users WHERE id = 'u1'").Scan(&hash)
+	database.DB.QueryRow("SELECT COUNT(*) FROM sessions").Scan(&sessions)
+	if !CheckPasswordHash("a long enough password", hash) || sessions != 0 {
+		t.Fatalf("password should be replaced and sessions revoked (%d left)", sessions)
+	}
+	if _, err := resets.Confirm(token, "another long password"); err != models.ErrInvalidResetToken {
+		t.Fatalf("a token should only work once, got %v", err)
+	}
+}
+
+func TestPasswordResetTokensExpireAndAreSuperseded(t *testing.T) {
+	resets, mailer := newTestResetter(t)
+	start := time.Now()
+	resets.now = func() time.Time { return start }
+	resets.Request("alice@example.com")
+	resets.wait()
+	first := resetToken(t, mailer.sent[0])
+
+	resets.now = func() time.Time { return start.Add(2 * time.Minute) }
+	resets.Request("alice@example.com")
+	resets.wait()
+	second := resetToken(t, mailer.sent[1])
+	if _, err := resets.Confirm(first, "a long enough password"); err != models.ErrInvalidResetToken {
+		t.Fatalf("a newer email should invalidate older links, got %v", err)
+	}
+
+	resets.now = func() time.Time { return start.Add(2 * time.Hour) }
+	if _, err := resets.Confirm(second, "a long enough password"); err != models.ErrInvalidResetToken {
+		t.Fatalf("expired token should be refused, got %v", err)
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := NewLogMailer(dir, "app@example.com")
+
+	if err := mailer.Send(&Email{To: "a@example.com\r\nBcc: b@example.com", Subject: "hi", Body: "x"}); err != ErrInvalidEmailHeader {
+		t.Fatalf("header injection should be refused, got %v", err)
+	}
+	if err := mailer.Send(&Email{To: "a@example.com", Subject: "Hello", Body: "line one\nline two"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected one .eml file, got %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	for _, want := range []string{"From: app@example.com\r\n", "To: a@example.com\r\n", "Subject: Hello\r\n", "line one\r\nline two"} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("message missing %q:\n%s", want, data)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"social-network/database/models"
+)
+
+// PromoteStaffFromEnv gives the users listed by ID, comma-separated, in ADMIN_USER_IDS the
+// admin role and those in MODERATOR_USER_IDS at least the moderator role. It only ever
+// promotes, so roles granted through the admin API are kept across restarts. This is how
+// the first admin of a fresh installation is created.
+func PromoteStaffFromEnv() {
+	for _, staff := range []struct {
+		env  string
+		role string
+	}{
+		{"ADMIN_USER_IDS", models.RoleAdmin},
+		{"MODERATOR_USER_IDS", models.RoleModerator},
+	} {
+		for _, id := range strings.Split(os.Getenv(staff.env), ",") {
+			id = strings.TrimSpace(id)
+			if id == "" {
+				continue
+			}
+			user, err := models.GetUserByID(id)
+			if err != nil || user == nil {
+				log.Printf("Cannot make %s a %s: user not found (%v)", id, staff.role, err)
+				continue
+			}
+			if user.HasRole(staff.role) {
+				continue
+			}
+			if err := models.SetUserRole(id, staff.role); err != nil {
+				log.Printf("Error making %s a %s: %v", id, staff.role, err)
+			}
+		}
+	}
+}
@@ -1,14 +1,13 @@
 package services
 
 import (
+	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"social-network/database/models"
 
-	"io"
-	"os"
-
 	"github.com/google/uuid"
 )
 
@@ -16,19 +15,53 @@ type contextKey string
 
 const (
 	SessionCookieName = "social_network_session"
-	SessionDuration   = 24 * 7 * time.Hour // Sessions last for one week
 	UserContextKey    = contextKey("user")
+
+	// DefaultSessionIdleTimeout signs users out of a session they haven't used for this long.
+	DefaultSessionIdleTimeout = 7 * 24 * time.Hour
+	// DefaultSessionMaxLifetime signs users out of a session this long after they logged
+	// in, however active it is.
+	DefaultSessionMaxLifetime = 30 * 24 * time.Hour
 )
 
+// SessionIdleTimeout returns the idle timeout, overridable with SESSION_IDLE_TIMEOUT
+// (a Go duration such as "72h").
+func SessionIdleTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SESSION_IDLE_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return DefaultSessionIdleTimeout
+}
+
+// SessionMaxLifetime returns the absolute session lifetime, overridable with
+// SESSION_MAX_LIFETIME (a Go duration such as "720h").
+func SessionMaxLifetime() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SESSION_MAX_LIFETIME")); err == nil && d > 0 {
+		return d
+	}
+	return DefaultSessionMaxLifetime
+}
+
+// SessionExpiry returns when a session created at createdAt and last used at lastUsed
+// expires: after the idle timeout, but never later than its absolute lifetime.
+func SessionExpiry(createdAt, lastUsed time.Time) time.Time {
+	expiry := lastUsed.Add(SessionIdleTimeout())
+	if limit := createdAt.Add(SessionMaxLifetime()); limit.Before(expiry) {
+		expiry = limit
+	}
+	return expiry.UTC()
+}
+
 // CreateSession creates a new session for a user and returns the session token.
 func CreateSession(userID string) (string, error) {
 	sessionToken := uuid.NewString()
-	expiresAt := time.Now().Add(SessionDuration)
+	now := time.Now().UTC()
 
 	session := &models.Session{
 		Token:     sessionToken,
 		UserID:    userID,
-		ExpiresAt: expiresAt,
+		ExpiresAt: SessionExpiry(now, now),
+		CreatedAt: now,
 	}
 
 	err := models.CreateSession(session)
@@ -39,16 +72,31 @@ func CreateSession(userID string) (string, error) {
 }
 
 // SetSessionCookie sets the session cookie on the HTTP response.
-func SetSessionCookie(w http.ResponseWriter, token string) {
+func SetSessionCookie(w http.ResponseWriter, token string, expires time.Time) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     SessionCookieName,
 		Value:    token,
-		Expires:  time.Now().Add(SessionDuration),
+		Expires:  expires,
 		HttpOnly: true,
 		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
 	})
 }
 
+// RenewSession slides the expiry of a session that is being used forward and refreshes
+// the cookie to match. It also records where the session was used from. Renewal is
+// throttled to once per models.SessionTouchInterval.
+func RenewSession(w http.ResponseWriter, token string, createdAt time.Time, ipAddress, userAgent string) error {
+	now := time.Now()
+	expiry := SessionExpiry(createdAt, now)
+	renewed, err := models.TouchSession(token, ipAddress, userAgent, now, expiry)
+	if err != nil || !renewed {
+		return err
+	}
+	SetSessionCookie(w, token, expiry)
+	return nil
+}
+
 // GetUserFromSession retrieves the user associated with a session token from a request cookie.
 func GetUserFromSession(r *http.Request) (*models.User, error) {
 	cookie, err := r.Cookie(SessionCookieName)
@@ -95,21 +143,50 @@ func ClearSessionCookie(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// SaveUploadedFile saves an uploaded file to the given path and returns the file handle.
-func SaveUploadedFile(src io.Reader, dstPath string) (*os.File, error) {
-	// Ensure the directory exists
-	dir := "./uploads/avatars"
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return nil, err
+// sessionSweepInterval is how often expired sessions are purged.
+const sessionSweepInterval = time.Hour
+
+// SessionSweeper deletes expired sessions, which are otherwise only removed when their
+// owner logs out, along with abandoned two-factor login challenges.
+type SessionSweeper struct {
+	interval time.Duration
+}
+
+// NewSessionSweeper creates a sweeper running every SESSION_SWEEP_INTERVAL (a Go
+// duration, one hour by default).
+func NewSessionSweeper() *SessionSweeper {
+	interval := sessionSweepInterval
+	if d, err := time.ParseDuration(os.Getenv("SESSION_SWEEP_INTERVAL")); err == nil && d > 0 {
+		interval = d
 	}
-	f, err := os.Create(dstPath)
-	if err != nil {
-		return nil, err
+	return &SessionSweeper{interval: interval}
+}
+
+// Sweep deletes every session and login challenge that has expired and returns how many
+// sessions were deleted and how many are still active.
+func (s *SessionSweeper) Sweep() (expired, active int64, err error) {
+	now := time.Now()
+	if expired, err = models.DeleteExpiredSessions(now); err != nil {
+		return 0, 0, err
 	}
-	_, err = io.Copy(f, src)
-	if err != nil {
-		f.Close()
-		return nil, err
+	if _, err = models.DeleteExpiredLoginChallenges(now); err != nil {
+		return 0, 0, err
 	}
-	return f, nil
+	active, err = models.CountActiveSessions(now)
+	return expired, active, err
+}
+
+// Start runs Sweep immediately and then periodically in a background goroutine.
+func (s *SessionSweeper) Start() {
+	go func() {
+		for {
+			expired, active, err := s.Sweep()
+			if err != nil {
+				log.Printf("Session sweep failed: %v", err)
+			} else {
+				log.Printf("Session sweep: removed %d expired sessions, %d active", expired, active)
+			}
+			time.Sleep(s.interval)
+		}
+	}()
 }
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionExpiry(t *testing.T) {
+	t.Setenv("SESSION_IDLE_TIMEOUT", "24h")
+	t.Setenv("SESSION_MAX_LIFETIME", "72h")
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if got := SessionExpiry(created, created); !got.Equal(created.Add(24 * time.Hour)) {
+		t.Fatalf("a new session should expire after the idle timeout, got %v", got)
+	}
+	if got := SessionExpiry(created, created.Add(36*time.Hour)); !got.Equal(created.Add(60 * time.Hour)) {
+		t.Fatalf("using a session should slide its expiry, got %v", got)
+	}
+	if got := SessionExpiry(created, created.Add(60*time.Hour)); !got.Equal(created.Add(72 * time.Hour)) {
+		t.Fatalf("expiry should be capped at the absolute lifetime, got %v", got)
+	}
+}
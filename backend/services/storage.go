@@ -0,0 +1,188 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrObjectNotFound = errors.New("stored object not found")
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+	ETag    string
+}
+
+// ReadSeekCloser is what Storage.Open returns, so callers can serve Range requests.
+type ReadSeekCloser interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// Storage is where uploaded media lives. Keys are slash-separated relative paths
+// such as "posts/20250101120000_ab12cd34.jpg".
+type Storage interface {
+	// Put stores data under key, replacing anything already there.
+	Put(key string, data []byte, contentType string) error
+	// Open returns the object's content. It returns ErrObjectNotFound if key does not exist.
+	Open(key string) (ReadSeekCloser, ObjectInfo, error)
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(key string) error
+	// List returns every object whose key starts with prefix ("" lists everything).
+	List(prefix string) ([]ObjectInfo, error)
+	// SignedURL returns a time-limited URL a client can fetch key from directly, or ""
+	// if the backend has no such URLs and the server must stream the object itself.
+	SignedURL(key string, expires time.Duration) (string, error)
+}
+
+// NewStorageFromEnv builds the Storage selected by the STORAGE_BACKEND environment
+// variable: "local" (the default) stores files under UPLOAD_DIR (default "uploads"),
+// "s3" uses an S3-compatible bucket configured by the S3_* variables.
+func NewStorageFromEnv() (Storage, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "local":
+		dir := os.Getenv("UPLOAD_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		return NewLocalStorage(dir), nil
+	case "s3":
+		cfg := S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PathStyle: os.Getenv("S3_PATH_STYLE") == "true",
+		}
+		return NewS3Storage(cfg)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+}
+
+// CleanKey validates a client-supplied relative path and returns it as a storage key,
+// refusing anything that could escape the storage root.
+func CleanKey(relativePath string) (string, error) {
+	key := strings.TrimPrefix(filepath.ToSlash(relativePath), "/")
+	if key == "" || strings.Contains(key, "..") || strings.Contains(key, "\\") || path.Clean(key) != key {
+		return "", ErrInvalidImagePath
+	}
+	return key, nil
+}
+
+// LocalStorage keeps objects as files below a root directory.
+type LocalStorage struct {
+	root string
+}
+
+// NewLocalStorage creates a LocalStorage rooted at dir, creating it if needed.
+func NewLocalStorage(dir string) *LocalStorage {
+	// Create upload directory if it doesn't exist
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		os.MkdirAll(dir, 0o755)
+	}
+	return &LocalStorage{root: dir}
+}
+
+func (s *LocalStorage) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(key))
+}
+
+// Put writes the object to a temporary file and renames it into place, so readers
+// never see a partially written file.
+func (s *LocalStorage) Put(key string, data []byte, contentType string) error {
+	dst := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	os.Chmod(tmp.Name(), 0o644)
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (s *LocalStorage) Open(key string) (ReadSeekCloser, ObjectInfo, error) {
+	f, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ObjectInfo{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, ObjectInfo{}, ErrObjectNotFound
+	}
+	return f, ObjectInfo{
+		Key:     key,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		// Stored objects are never modified in place, so size and mtime identify the content.
+		ETag: fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+	}, nil
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStorage) List(prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return objects, err
+}
+
+// SignedURL returns "": local files are always streamed by the media handler.
+func (s *LocalStorage) SignedURL(key string, expires time.Duration) (string, error) {
+	return "", nil
+}
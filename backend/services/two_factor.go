@@ -0,0 +1,294 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"social-network/database/models"
+)
+
+const (
+	// totpPeriod is how long each TOTP code is valid for, in seconds.
+	totpPeriod = 30
+	// totpDigits is the length of a TOTP code.
+	totpDigits = 6
+	// totpSkew is how many periods either side of the current one are accepted, to allow
+	// for clocks that have drifted apart.
+	totpSkew = 1
+	// recoveryCodeCount is how many recovery codes a user gets when enabling 2FA.
+	recoveryCodeCount = 10
+	// DefaultLoginChallengeLifetime is how long a user has to enter their second factor
+	// after entering their password.
+	DefaultLoginChallengeLifetime = 5 * time.Minute
+	// maxLoginChallengeAttempts is how many codes can be tried with one pre-auth token.
+	maxLoginChallengeAttempts = 5
+)
+
+// Ways of passing the second step of a login, as recorded in the audit log.
+const (
+	TwoFactorMethodTOTP         = "totp"
+	TwoFactorMethodRecoveryCode = "recovery_code"
+)
+
+var ErrInvalidTwoFactorCode = errors.New("invalid authentication code")
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// recoveryCodeAlphabet has 32 letters, so each random byte picks one without bias.
+const recoveryCodeAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+
+// TwoFactor manages TOTP two-factor authentication: enrolling authenticator apps,
+// recovery codes and the second step of logging in.
+type TwoFactor struct {
+	issuer            string
+	challengeLifetime time.Duration
+	now               func() time.Time
+}
+
+// NewTwoFactor creates a TwoFactor whose authenticator entries are labelled with issuer.
+func NewTwoFactor(issuer string, challengeLifetime time.Duration) *TwoFactor {
+	return &TwoFactor{issuer: issuer, challengeLifetime: challengeLifetime, now: time.Now}
+}
+
+// NewTwoFactorFromEnv creates a TwoFactor labelled with TOTP_ISSUER (default
+// "Social Network").
+func NewTwoFactorFromEnv() *TwoFactor {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "Social Network"
+	}
+	return NewTwoFactor(issuer, DefaultLoginChallengeLifetime)
+}
+
+// TwoFactorEnrollment is what a user adds to their authenticator app, either by
+// scanning the otpauth URI as a QR code or by typing in the secret.
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauthUri"`
+}
+
+// BeginEnrollment gives user a new TOTP secret. 2FA is only turned on once they confirm
+// a code from it with ConfirmEnrollment. It returns models.ErrTwoFactorEnabled if 2FA is
+// already on.
+func (f *TwoFactor) BeginEnrollment(user *models.User) (*TwoFactorEnrollment, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	secret := totpEncoding.EncodeToString(raw)
+	if err := models.SetPendingTOTPSecret(user.ID, secret); err != nil {
+		return nil, err
+	}
+	return &TwoFactorEnrollment{Secret: secret, URI: TOTPURI(f.issuer, user.Email, secret)}, nil
+}
+
+// ConfirmEnrollment turns on 2FA for userID if code matches their pending secret and
+// returns their recovery codes, which are only ever shown this once.
+func (f *TwoFactor) ConfirmEnrollment(userID, code string) ([]string, error) {
+	state, err := models.GetTOTPState(userID)
+	if err != nil {
+		return nil, err
+	}
+	if state.Enabled {
+		return nil, models.ErrTwoFactorEnabled
+	}
+	if state.Secret == "" {
+		return nil, models.ErrTwoFactorNotEnrolled
+	}
+	now := f.now()
+	step, ok := matchTOTP(state.Secret, code, now, 0)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	if err := models.EnableTOTP(userID, step, hashes, now); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// StartLogin begins the second step of logging in userID, who has entered their
+// password. The returned pre-auth token is exchanged for a session with FinishLogin.
+func (f *TwoFactor) StartLogin(userID string) (string, time.Time, error) {
+	token, err := newSecretToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := f.now()
+	expiresAt := now.Add(f.challengeLifetime)
+	if err := models.CreateLoginChallenge(userID, hashSecretToken(token), now, expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// FinishLogin checks code, a TOTP code or a recovery code, against the user a pre-auth
+// token was issued to and returns the user's ID and which kind of code was used. The
+// token works once. It returns models.ErrInvalidLoginChallenge if the token is unknown,
+// expired or has been tried too often, and ErrInvalidTwoFactorCode, along with the
+// user's ID, if the code is wrong.
+func (f *TwoFactor) FinishLogin(token, code string) (userID, method string, err error) {
+	if token == "" {
+		return "", "", models.ErrInvalidLoginChallenge
+	}
+	tokenHash := hashSecretToken(token)
+	userID, err = models.AttemptLoginChallenge(tokenHash, f.now(), maxLoginChallengeAttempts)
+	if err != nil {
+		return "", "", err
+	}
+	if method, err = f.verify(userID, code); err != nil {
+		return userID, "", err
+	}
+	if deleted, err := models.DeleteLoginChallenge(tokenHash); err != nil {
+		return "", "", err
+	} else if !deleted {
+		return "", "", models.ErrInvalidLoginChallenge
+	}
+	return userID, method, nil
+}
+
+// verify checks code against userID's authenticator or unused recovery codes. Each code
+// is only accepted once.
+func (f *TwoFactor) verify(userID, code string) (string, error) {
+	state, err := models.GetTOTPState(userID)
+	if err != nil {
+		return "", err
+	}
+	if !state.Enabled {
+		return "", ErrInvalidTwoFactorCode
+	}
+	now := f.now()
+
+	code = strings.TrimSpace(code)
+	if isTOTPCode(code) {
+		step, ok := matchTOTP(state.Secret, code, now, state.LastStep)
+		if !ok {
+			return "", ErrInvalidTwoFactorCode
+		}
+		if recorded, err := models.RecordTOTPStep(userID, step); err != nil {
+			return "", err
+		} else if !recorded {
+			return "", ErrInvalidTwoFactorCode
+		}
+		return TwoFactorMethodTOTP, nil
+	}
+
+	used, err := models.UseRecoveryCode(userID, hashRecoveryCode(code), now)
+	if err != nil {
+		return "", err
+	}
+	if !used {
+		return "", ErrInvalidTwoFactorCode
+	}
+	return TwoFactorMethodRecoveryCode, nil
+}
+
+// TOTPURI returns the otpauth URI authenticator apps use to add account's secret.
+func TOTPURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + issuer + ":" + account, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// TOTPCode returns the RFC 6238 code for a base32 secret at time t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, t.Unix()/totpPeriod), nil
+}
+
+// totpCode computes the HOTP value (RFC 4226) of key for a time step.
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// matchTOTP returns the time step near now whose code for secret is code. Steps up to
+// and including lastStep have been used already and don't match.
+func matchTOTP(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if !isTOTPCode(code) {
+		return 0, false
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step > lastStep && hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRecoveryCode returns a random code of the form xxxxx-xxxxx.
+func newRecoveryCode() (string, error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, 11)
+	for i, b := range raw {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, recoveryCodeAlphabet[b%32])
+	}
+	return string(code), nil
+}
+
+// hashRecoveryCode returns the stored form of a recovery code, ignoring case, spaces and
+// dashes so the code can be typed loosely.
+func hashRecoveryCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+	return hashSecretToken(normalized)
+}
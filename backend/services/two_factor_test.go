@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/database"
+	"social-network/database/dbtest"
+	"social-network/database/models"
+)
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	for unix, want := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924"} {
+		got, err := TOTPCode(secret, time.Unix(unix, 0))
+		if err != nil || got != want {
+			t.Errorf("TOTPCode at %d = %q, %v; want %q", unix, got, err, want)
+		}
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	u, err := url.Parse(TOTPURI("Social Network", "alice@example.com", "ABC"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Social Network:alice@example.com" {
+		t.Fatalf("unexpected URI %q", u)
+	}
+	if q := u.Query(); q.Get("secret") != "ABC" || q.Get("issuer") != "Social Network" || q.Get("digits") != "6" {
+		t.Fatalf("unexpected query %q", u.RawQuery)
+	}
+}
+
+func newTestTwoFactor(t *testing.T, now *time.Time) *TwoFactor {
+	dbtest.Open(t)
+	_, err := database.DB.Exec(`INSERT INTO users (id, first_name, last_name, email, password_hash, date_of_birth)
+		VALUES ('u1', 'Alice', 'A', 'alice@example.com', 'h', '2000-01-01')`)
+	if err != nil {
+		t.Fatalf("failed to seed users: %v", err)
+	}
+
+	f := NewTwoFactor("Social Network", 5*time.Minute)
+	f.now = func() time.Time { return *now }
+	return f
+}
+
+func enrollTOTP(t *testing.T, f *TwoFactor, now time.Time) (string, []string) {
+	enrollment, err := f.BeginEnrollment(&models.User{ID: "u1", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("BeginEnrollment failed: %v", err)
+	}
+	code, _ := TOTPCode(enrollment.Secret, now)
+	codes, err := f.ConfirmEnrollment("u1", code)
+	if err != nil {
+		t.Fatalf("ConfirmEnrollment failed: %v", err)
+	}
+	return enrollment.Secret, codes
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	f := newTestTwoFactor(t, &now)
+
+	if _, err := f.ConfirmEnrollment("u1", "123456"); !errors.Is(err, models.ErrTwoFactorNotEnrolled) {
+		t.Fatalf("confirming before enrolling = %v, want ErrTwoFactorNotEnrolled", err)
+	}
+	enrollment, err := f.BeginEnrollment(&models.User{ID: "u1", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("BeginEnrollment failed: %v", err)
+	}
+	if _, err := f.ConfirmEnrollment("u1", "000000"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("wrong code = %v, want ErrInvalidTwoFactorCode", err)
+	}
+	if state, _ := models.GetTOTPState("u1"); state.Enabled {
+		t.Fatal("2FA should stay off until a code is confirmed")
+	}
+
+	code, _ := TOTPCode(enrollment.Secret, now.Add(-totpPeriod*time.Second))
+	codes, err := f.ConfirmEnrollment("u1", code)
+	if err != nil {
+		t.Fatalf("a code from the previous period should be accepted: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	if n, _ := models.CountUnusedRecoveryCodes("u1"); n != recoveryCodeCount {
+		t.Fatalf("%d recovery codes stored, want %d", n, recoveryCodeCount)
+	}
+	if _, err := f.BeginEnrollment(&models.User{ID: "u1"}); !errors.Is(err, models.ErrTwoFactorEnabled) {
+		t.Fatalf("enrolling again = %v, want ErrTwoFactorEnabled", err)
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	f := newTestTwoFactor(t, &now)
+	secret, _ := enrollTOTP(t, f, now)
+
+	// The code used to enroll can't be used again to log in.
+	token, _, err := f.StartLogin("u1")
+	if err != nil {
+		t.Fatalf("StartLogin failed: %v", err)
+	}
+	used, _ := TOTPCode(secret, now)
+	if userID, _, err := f.FinishLogin(token, used); !errors.Is(err, ErrInvalidTwoFactorCode) || userID != "u1" {
+		t.Fatalf("replayed code = %q, %v; want u1, ErrInvalidTwoFactorCode", userID, err)
+	}
+
+	now = now.Add(totpPeriod * time.Second)
+	code, _ := TOTPCode(secret, now)
+	userID, method, err := f.FinishLogin(token, code)
+	if err != nil || userID != "u1" || method != TwoFactorMethodTOTP {
+		t.Fatalf("FinishLogin = %q, %q, %v", userID, method, err)
+	}
+	if _, _, err := f.FinishLogin(token, code); !errors.Is(err, models.ErrInvalidLoginChallenge) {
+		t.Fatalf("reusing the pre-auth token = %v, want ErrInvalidLoginChallenge", err)
+	}
+}
+
+func TestTwoFactorLoginLimitsAttempts(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	f := newTestTwoFactor(t, &now)
+	secret, _ := enrollTOTP(t, f, now)
+
+	token, _, _ := f.StartLogin("u1")
+	for i := 0; i < maxLoginChallengeAttempts; i++ {
+		if _, _, err := f.FinishLogin(token, "000000"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("attempt %d = %v, want ErrInvalidTwoFactorCode", i, err)
+		}
+	}
+	now = now.Add(totpPeriod * time.Second)
+	code, _ := TOTPCode(secret, now)
+	if _, _, err := f.FinishLogin(token, code); !errors.Is(err, models.ErrInvalidLoginChallenge) {
+		t.Fatalf("after too many attempts = %v, want ErrInvalidLoginChallenge", err)
+	}
+
+	token, _, _ = f.StartLogin("u1")
+	now = now.Add(6 * time.Minute)
+	code, _ = TOTPCode(secret, now)
+	if _, _, err := f.FinishLogin(token, code); !errors.Is(err, models.ErrInvalidLoginChallenge) {
+		t.Fatalf("expired pre-auth token = %v, want ErrInvalidLoginChallenge", err)
+	}
+}
+
+func TestTwoFactorRecoveryCodes(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	f := newTestTwoFactor(t, &now)
+	_, codes := enrollTOTP(t, f, now)
+
+	token, _, _ := f.StartLogin("u1")
+	if _, _, err := f.FinishLogin(token, "aaaaa-aaaaa"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("unknown recovery code = %v, want ErrInvalidTwoFactorCode", err)
+	}
+	// Recovery codes can be typed without the dash and in capitals.
+	loose := " " + strings.ToUpper(codes[0][:5]+codes[0][6:]) + " "
+	if _, method, err := f.FinishLogin(token, loose); err != nil || method != TwoFactorMethodRecoveryCode {
+		t.Fatalf("FinishLogin with recovery code = %q, %v", method, err)
+	}
+
+	token, _, _ = f.StartLogin("u1")
+	if _, _, err := f.FinishLogin(token, codes[0]); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("reusing a recovery code = %v, want ErrInvalidTwoFactorCode", err)
+	}
+	if n, _ := models.CountUnusedRecoveryCodes("u1"); n != recoveryCodeCount-1 {
+		t.Fatalf("%d unused recovery codes, want %d", n, recoveryCodeCount-1)
+	}
+
+	if err := models.DisableTOTP("u1"); err != nil {
+		t.Fatalf("DisableTOTP failed: %v", err)
+	}
+	if _, _, err := f.FinishLogin(token, codes[1]); !errors.Is(err, models.ErrInvalidLoginChallenge) {
+		t.Fatalf("pending login after disabling 2FA = %v, want ErrInvalidLoginChallenge", err)
+	}
+	if state, _ := models.GetTOTPState("u1"); state.Enabled || state.Secret != "" {
+		t.Fatalf("2FA should be off with no secret: %+v", state)
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"social-network/database/models"
+)
+
+// Defaults for the orphaned upload collector, overridable through the environment.
+const (
+	DefaultUploadGCInterval = 6 * time.Hour
+	// DefaultUploadGCGracePeriod protects files that were stored moments before the row
+	// referencing them is written, e.g. a post whose image is saved before the INSERT.
+	DefaultUploadGCGracePeriod = 24 * time.Hour
+)
+
+// UploadGCReport summarises one collection pass.
+type UploadGCReport struct {
+	DryRun     bool
+	Scanned    int
+	Referenced int
+	TooRecent  int
+	Orphaned   []ObjectInfo // unreferenced and older than the grace period
+	Removed    int
+	BytesFreed int64
+	Failed     int
+}
+
+// UploadGC removes uploaded files that nothing in the database refers to any more,
+// such as replaced avatars or the media of deleted posts and messages.
+type UploadGC struct {
+	storage     Storage
+	interval    time.Duration
+	gracePeriod time.Duration
+	dryRun      bool
+	// references lists the keys still in use; tests replace it to avoid a database.
+	references func() (map[string]bool, error)
+	now        func() time.Time
+}
+
+// NewUploadGC creates a collector. In dry-run mode it only reports what it would delete.
+func NewUploadGC(storage Storage, gracePeriod time.Duration, dryRun bool) *UploadGC {
+	return &UploadGC{
+		storage:     storage,
+		interval:    DefaultUploadGCInterval,
+		gracePeriod: gracePeriod,
+		dryRun:      dryRun,
+		references:  models.GetReferencedMediaPaths,
+		now:         time.Now,
+	}
+}
+
+// NewUploadGCFromEnv creates a collector configured by UPLOAD_GC_INTERVAL and
+// UPLOAD_GC_GRACE_PERIOD (Go durations such as "48h") and UPLOAD_GC_DRY_RUN
+// ("true" to only report what would be deleted).
+func NewUploadGCFromEnv(storage Storage) *UploadGC {
+	grace := DefaultUploadGCGracePeriod
+	if d, err := time.ParseDuration(os.Getenv("UPLOAD_GC_GRACE_PERIOD")); err == nil && d > 0 {
+		grace = d
+	}
+	dryRun, _ := strconv.ParseBool(os.Getenv("UPLOAD_GC_DRY_RUN"))
+	gc := NewUploadGC(storage, grace, dryRun)
+	if d, err := time.ParseDuration(os.Getenv("UPLOAD_GC_INTERVAL")); err == nil && d > 0 {
+		gc.interval = d
+	}
+	return gc
+}
+
+// Run performs a single pass: it lists every stored object, keeps those whose original
+// is referenced or that are younger than the grace period, and deletes the rest.
+func (gc *UploadGC) Run() (*UploadGCReport, error) {
+	// List before loading references: a file uploaded and referenced between the two
+	// steps is then either missing from the listing or present in the references.
+	objects, err := gc.storage.List("")
+	if err != nil {
+		return nil, err
+	}
+	referenced, err := gc.references()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &UploadGCReport{DryRun: gc.dryRun, Scanned: len(objects)}
+	cutoff := gc.now().Add(-gc.gracePeriod)
+	for _, obj := range objects {
+		switch {
+		case referenced[OriginalPath(obj.Key)]:
+			report.Referenced++
+		case obj.ModTime.After(cutoff):
+			report.TooRecent++
+		default:
+			report.Orphaned = append(report.Orphaned, obj)
+		}
+	}
+	sort.Slice(report.Orphaned, func(i, j int) bool { return report.Orphaned[i].Key < report.Orphaned[j].Key })
+
+	if gc.dryRun {
+		return report, nil
+	}
+	for _, obj := range report.Orphaned {
+		if err := gc.storage.Delete(obj.Key); err != nil {
+			log.Printf("Upload GC: could not delete %s: %v", obj.Key, err)
+			report.Failed++
+			continue
+		}
+		report.Removed++
+		report.BytesFreed += obj.Size
+	}
+	return report, nil
+}
+
+// Start runs the collector immediately and then periodically in a background
+// goroutine, logging a report after each pass.
+func (gc *UploadGC) Start() {
+	go func() {
+		for {
+			gc.runAndLog()
+			time.Sleep(gc.interval)
+		}
+	}()
+}
+
+func (gc *UploadGC) runAndLog() {
+	report, err := gc.Run()
+	if err != nil {
+		log.Printf("Upload GC failed: %v", err)
+		return
+	}
+	if report.DryRun {
+		for _, obj := range report.Orphaned {
+			log.Printf("Upload GC (dry run): would remove %s (%d bytes, modified %s)", obj.Key, obj.Size, obj.ModTime.Format(time.RFC3339))
+		}
+		log.Printf("Upload GC (dry run): scanned %d files, %d referenced, %d within grace period, %d orphaned",
+			report.Scanned, report.Referenced, report.TooRecent, len(report.Orphaned))
+		return
+	}
+	log.Printf("Upload GC: scanned %d files, %d referenced, %d within grace period, removed %d (%d bytes), %d failed",
+		report.Scanned, report.Referenced, report.TooRecent, report.Removed, report.BytesFreed, report.Failed)
+}
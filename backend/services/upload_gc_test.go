@@ -0,0 +1,68 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestUploadGC(t *testing.T, dryRun bool) (*UploadGC, string) {
+	dir := t.TempDir()
+	storage := NewLocalStorage(dir)
+	old := time.Now().Add(-48 * time.Hour)
+	for _, key := range []string{
+		"avatars/kept.jpg", "avatars/kept_thumb.jpg", // referenced, with a variant
+		"avatars/replaced.jpg", "avatars/replaced_thumb.jpg", // orphaned
+		"posts/fresh.png", // orphaned but within the grace period
+	} {
+		if err := storage.Put(key, []byte("data"), "image/jpeg"); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+		if key != "posts/fresh.png" {
+			os.Chtimes(filepath.Join(dir, key), old, old)
+		}
+	}
+	gc := NewUploadGC(storage, 24*time.Hour, dryRun)
+	gc.references = func() (map[string]bool, error) {
+		return map[string]bool{"avatars/kept.jpg": true}, nil
+	}
+	return gc, dir
+}
+
+func TestUploadGCRemovesOldUnreferencedFiles(t *testing.T) {
+	gc, dir := newTestUploadGC(t, false)
+	report, err := gc.Run()
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report.Scanned != 5 || report.Referenced != 2 || report.TooRecent != 1 || report.Removed != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	for key, want := range map[string]bool{
+		"avatars/kept.jpg":           true,
+		"avatars/kept_thumb.jpg":     true,
+		"avatars/replaced.jpg":       false,
+		"avatars/replaced_thumb.jpg": false,
+		"posts/fresh.png":            true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, key))
+		if exists := err == nil; exists != want {
+			t.Errorf("%s exists = %v, want %v", key, exists, want)
+		}
+	}
+}
+
+func TestUploadGCDryRunOnlyReports(t *testing.T) {
+	gc, dir := newTestUploadGC(t, true)
+	report, err := gc.Run()
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(report.Orphaned) != 2 || report.Removed != 0 || report.Orphaned[0].Key != "avatars/replaced.jpg" {
+		t.Fatalf("unexpected dry-run report %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "avatars/replaced.jpg")); err != nil {
+		t.Fatalf("dry run deleted a file: %v", err)
+	}
+}
@@ -24,6 +24,8 @@ type Client struct {
 	send chan []byte
 	// The ID of the authenticated user.
 	UserID string
+	// The session the connection was opened with, so revoking it can drop the connection.
+	sessionToken string
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -4,6 +4,7 @@ import (
 	"log"
 	"net/http"
 	"social-network/services"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -45,12 +46,22 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	user, err := services.GetUserFromSessionToken(sessionToken)
 	if err != nil {
 		http.Error(w, "Unauthorized: Invalid session", http.StatusUnauthorized)
-		log.Printf("Unauthorized WebSocket connection attempt: Error getting user from session token %s: %v", sessionToken, err)
+		log.Printf("Unauthorized WebSocket connection attempt: Error getting user from session token: %v", err)
 		return
 	}
 	if user == nil {
 		http.Error(w, "Unauthorized: Invalid session", http.StatusUnauthorized)
-		log.Printf("Unauthorized WebSocket connection attempt: No user found for session token %s", sessionToken)
+		log.Println("Unauthorized WebSocket connection attempt: No user found for session token")
+		return
+	}
+	if suspension := user.ActiveSuspension(time.Now()); suspension != nil {
+		http.Error(w, "Forbidden: "+suspension.Message(), http.StatusForbidden)
+		log.Printf("Refused WebSocket connection for suspended user %s", user.ID)
+		return
+	}
+	if !user.Active {
+		http.Error(w, "Forbidden: Account is deactivated", http.StatusForbidden)
+		log.Printf("Refused WebSocket connection for deactivated user %s", user.ID)
 		return
 	}
 
@@ -67,6 +78,8 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		conn:   conn,
 		send:   make(chan []byte, 256),
 		UserID: user.ID,
+
+		sessionToken: sessionToken,
 	}
 	client.hub.register <- client
 
@@ -14,12 +14,31 @@ type RoutedMessage struct {
 	Message IncomingMessage
 }
 
-// Hub maintains the set of active clients and broadcasts messages to them.
+// sessionDisconnect asks the hub to drop the connections a user opened with some of
+// their sessions.
+type sessionDisconnect struct {
+	userID string
+	tokens []string
+}
+
+// delivery asks the hub to push a message to every live connection of a user.
+type delivery struct {
+	userID string
+	data   []byte
+}
+
+// Hub maintains the set of active clients and broadcasts messages to them. Only Run
+// touches clients and sends on or closes the clients' send channels; other goroutines
+// go through the hub's channels, so a connection is never written to after it closed.
 type Hub struct {
 	clients      map[string]map[*Client]bool
 	routeMessage chan *RoutedMessage
 	register     chan *Client
 	unregister   chan *Client
+	disconnect   chan string
+	deliver      chan delivery
+
+	disconnectSessions chan sessionDisconnect
 }
 
 func NewHub() *Hub {
@@ -27,7 +46,11 @@ func NewHub() *Hub {
 		routeMessage: make(chan *RoutedMessage),
 		register:     make(chan *Client),
 		unregister:   make(chan *Client),
+		disconnect:   make(chan string),
+		deliver:      make(chan delivery),
 		clients:      make(map[string]map[*Client]bool),
+
+		disconnectSessions: make(chan sessionDisconnect),
 	}
 }
 
@@ -42,16 +65,30 @@ func (h *Hub) Run() {
 			log.Printf("Client registered: UserID %s", client.UserID)
 
 		case client := <-h.unregister:
-			if userClients, ok := h.clients[client.UserID]; ok {
-				if _, ok := userClients[client]; ok {
-					delete(userClients, client)
-					close(client.send)
-					if len(userClients) == 0 {
-						delete(h.clients, client.UserID)
-					}
-					log.Printf("Client unregistered: UserID %s", client.UserID)
+			if h.removeClient(client) {
+				log.Printf("Client unregistered: UserID %s", client.UserID)
+			}
+
+		case userID := <-h.disconnect:
+			for client := range h.clients[userID] {
+				h.removeClient(client)
+			}
+			log.Printf("Disconnected all clients of UserID %s", userID)
+
+		case d := <-h.disconnectSessions:
+			revoked := make(map[string]bool, len(d.tokens))
+			for _, token := range d.tokens {
+				revoked[token] = true
+			}
+			for client := range h.clients[d.userID] {
+				if revoked[client.sessionToken] {
+					h.removeClient(client)
 				}
 			}
+			log.Printf("Disconnected clients of %d revoked sessions of UserID %s", len(d.tokens), d.userID)
+
+		case d := <-h.deliver:
+			h.sendToUser(d.userID, d.data)
 
 		case routedMsg := <-h.routeMessage:
 			switch routedMsg.Message.Type {
@@ -66,12 +103,79 @@ func (h *Hub) Run() {
 	}
 }
 
+// removeClient forgets a connection and closes its send channel, which makes writePump
+// send a close frame and drop the connection. It reports false if the client was
+// already removed, so each channel is closed once. It must only be called from Run.
+func (h *Hub) removeClient(client *Client) bool {
+	userClients, ok := h.clients[client.UserID]
+	if !ok || !userClients[client] {
+		return false
+	}
+	delete(userClients, client)
+	close(client.send)
+	if len(userClients) == 0 {
+		delete(h.clients, client.UserID)
+	}
+	return true
+}
+
+// sendToUser queues data on every live connection of a user. Connections too slow to
+// keep up are dropped. It must only be called from Run.
+func (h *Hub) sendToUser(userID string, data []byte) {
+	for client := range h.clients[userID] {
+		select {
+		case client.send <- data:
+		default:
+			h.removeClient(client)
+		}
+	}
+}
+
+// sendToUserAsync hands data to Run for delivery to a user; it is safe to call from
+// any goroutine except Run itself.
+func (h *Hub) sendToUserAsync(userID string, data []byte) {
+	h.deliver <- delivery{userID: userID, data: data}
+}
+
+// DisconnectUser closes every live websocket connection of a user, e.g. after their
+// account was deleted or their sessions were revoked.
+func (h *Hub) DisconnectUser(userID string) {
+	h.disconnect <- userID
+}
+
+// DisconnectSessions closes the live websocket connections a user opened with any of the
+// given session tokens, leaving their other connections alone.
+func (h *Hub) DisconnectSessions(userID string, tokens []string) {
+	if len(tokens) == 0 {
+		return
+	}
+	h.disconnectSessions <- sessionDisconnect{userID: userID, tokens: tokens}
+}
+
+// senderVerified reports whether a user may send messages, which needs a verified
+// email address.
+func senderVerified(senderID string) bool {
+	verified, err := models.IsEmailVerified(senderID)
+	if err != nil {
+		log.Printf("Error checking email verification of user %s: %v", senderID, err)
+		return false
+	}
+	if !verified {
+		log.Printf("Permission denied: User %s has not verified their email address.", senderID)
+	}
+	return verified
+}
+
 // handlePrivateMessage processes and routes a 1-to-1 message.
 func (h *Hub) handlePrivateMessage(routedMsg *RoutedMessage) {
 	senderID := routedMsg.Client.UserID
 	recipientID := routedMsg.Message.RecipientID
 	content := routedMsg.Message.Content
 
+	if !senderVerified(senderID) {
+		return
+	}
+
 	// AUDIT POINT: Check if users are allowed to message each other.
 	canMessage, err := models.CanUsersMessage(senderID, recipientID)
 	if err != nil {
@@ -111,10 +215,8 @@ func (h *Hub) handlePrivateMessage(routedMsg *RoutedMessage) {
 
 	// Send the message to the recipient's clients only if they should receive instant messages
 	if shouldReceiveInstant {
-		if recipientClients, ok := h.clients[recipientID]; ok {
-			for client := range recipientClients {
-				client.send <- messageBytes
-			}
+		if _, ok := h.clients[recipientID]; ok {
+			h.sendToUser(recipientID, messageBytes)
 			log.Printf("Sent instant private message from %s to %s", senderID, recipientID)
 		} else {
 			log.Printf("Recipient %s is not online. Message saved to DB (instant delivery allowed).", recipientID)
@@ -124,14 +226,7 @@ func (h *Hub) handlePrivateMessage(routedMsg *RoutedMessage) {
 	}
 
 	// Also send the message back to the sender's other devices.
-	if senderClients, ok := h.clients[senderID]; ok {
-		for client := range senderClients {
-			// Don't resend to the originating client tab, though it's often harmless.
-			// if client != routedMsg.Client {
-			client.send <- messageBytes
-			// }
-		}
-	}
+	h.sendToUser(senderID, messageBytes)
 }
 
 // handleGroupMessage processes and routes a group message.
@@ -140,6 +235,10 @@ func (h *Hub) handleGroupMessage(routedMsg *RoutedMessage) {
 	groupID := routedMsg.Message.GroupID
 	content := routedMsg.Message.Content
 
+	if !senderVerified(senderID) {
+		return
+	}
+
 	// AUDIT POINT: Check if the sender is a member of the group.
 	isMember, err := models.IsUserInGroup(senderID, groupID)
 	if err != nil {
@@ -178,191 +277,132 @@ func (h *Hub) handleGroupMessage(routedMsg *RoutedMessage) {
 
 	// AUDIT POINT: Broadcast to all online members of the group.
 	for _, memberID := range memberIDs {
-		if memberClients, ok := h.clients[memberID]; ok {
-			for client := range memberClients {
-				client.send <- messageBytes
-			}
-		}
+		h.sendToUser(memberID, messageBytes)
 	}
 	log.Printf("Broadcast group message from %s to group %s", senderID, groupID)
 }
 
 // SendNotification creates a notification, saves it to the DB, and pushes it to the user if they are online.
 func (h *Hub) SendNotification(userID, actorID, notifType, message string) {
-	// 1. Create and save the notification to the database
-	notification := &models.Notification{
+	h.deliverNotification(&models.Notification{
 		UserID:  userID,
 		ActorID: actorID,
 		Type:    notifType,
 		Message: message,
 		Read:    false, // New notifications are always unread
-	}
+	})
+}
+
+// SendLinkNotification is SendNotification for system notifications that lead somewhere,
+// such as the download link of a finished data export.
+func (h *Hub) SendLinkNotification(userID, notifType, message, link string) {
+	h.deliverNotification(&models.Notification{
+		UserID:  userID,
+		Type:    notifType,
+		Message: message,
+		Link:    link,
+	})
+}
 
+func (h *Hub) deliverNotification(notification *models.Notification) {
+	// 1. Save the notification to the database
 	if err := models.CreateNotification(notification); err != nil {
-		log.Printf("Failed to save notification to DB: %v", err)
+		if err != models.ErrNotificationSuppressed {
+			log.Printf("Failed to save notification to DB: %v", err)
+		}
 		return // Don't send if we can't save it
 	}
 
-	// 2. Check if the target user is online
-	if userClients, ok := h.clients[userID]; ok {
-		// 3. If they are online, create the real-time message payload
-		wsNotif := NotificationMessage{
-			Type: "notification",
-			Payload: struct {
-				ID        string `json:"id"`
-				Message   string `json:"message"`
-				ActorID   string `json:"actorId,omitempty"`
-				NotifType string `json:"notifType"`
-				Read      bool   `json:"read"`
-			}{
-				ID:        notification.ID,
-				Message:   notification.Message,
-				ActorID:   notification.ActorID,
-				NotifType: notification.Type,
-				Read:      notification.Read,
-			},
-			Timestamp: time.Now(),
-		}
-
-		messageBytes, err := json.Marshal(wsNotif)
-		if err != nil {
-			log.Printf("Failed to marshal notification: %v", err)
-			return
-		}
+	// 2. Create the real-time message payload
+	wsNotif := NotificationMessage{
+		Type: "notification",
+		Payload: struct {
+			ID        string `json:"id"`
+			Message   string `json:"message"`
+			ActorID   string `json:"actorId,omitempty"`
+			NotifType string `json:"notifType"`
+			Link      string `json:"link,omitempty"`
+			Read      bool   `json:"read"`
+		}{
+			ID:        notification.ID,
+			Message:   notification.Message,
+			ActorID:   notification.ActorID,
+			NotifType: notification.Type,
+			Link:      notification.Link,
+			Read:      notification.Read,
+		},
+		Timestamp: time.Now(),
+	}
 
-		// 4. Send the notification to all of that user's active connections
-		for client := range userClients {
-			select {
-			case client.send <- messageBytes:
-			default:
-				close(client.send)
-				delete(userClients, client)
-			}
-		}
-		log.Printf("Sent real-time notification of type '%s' to user %s", notifType, userID)
-	} else {
-		// User is not online, notification saved to DB for later retrieval
-		// (removed debug log to reduce noise)
+	messageBytes, err := json.Marshal(wsNotif)
+	if err != nil {
+		log.Printf("Failed to marshal notification: %v", err)
+		return
 	}
+
+	// 3. Push it to the user's active connections, if they are online; otherwise it
+	// waits in the DB for later retrieval.
+	h.sendToUserAsync(notification.UserID, messageBytes)
 }
 
-// SendFollowRequestUpdate sends a message to refresh follow requests for a user
-func (h *Hub) SendFollowRequestUpdate(userID string) {
-	// Check if the target user is online
-	if userClients, ok := h.clients[userID]; ok {
-		// Create the follow request update message
-		updateMsg := struct {
-			Type string `json:"type"`
-			Data struct {
-				Action string `json:"action"`
-			} `json:"data"`
-			Timestamp time.Time `json:"timestamp"`
+// refreshMessage builds a message telling the client to reload some data.
+func refreshMessage(msgType string) ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Data struct {
+			Action string `json:"action"`
+		} `json:"data"`
+		Timestamp time.Time `json:"timestamp"`
+	}{
+		Type: msgType,
+		Data: struct {
+			Action string `json:"action"`
 		}{
-			Type: "follow_request_update",
-			Data: struct {
-				Action string `json:"action"`
-			}{
-				Action: "refresh",
-			},
-			Timestamp: time.Now(),
-		}
-
-		messageBytes, err := json.Marshal(updateMsg)
-		if err != nil {
-			log.Printf("Failed to marshal follow request update: %v", err)
-			return
-		}
+			Action: "refresh",
+		},
+		Timestamp: time.Now(),
+	})
+}
 
-		// Send the update to all of that user's active connections
-		for client := range userClients {
-			select {
-			case client.send <- messageBytes:
-			default:
-				close(client.send)
-				delete(userClients, client)
-			}
-		}
-		log.Printf("Sent follow request update to user %s", userID)
-	} else {
-		// User is not online, update will be handled when they connect
-		// (removed debug log to reduce noise)
+// SendFollowRequestUpdate sends a message to refresh follow requests for a user
+func (h *Hub) SendFollowRequestUpdate(userID string) {
+	messageBytes, err := refreshMessage("follow_request_update")
+	if err != nil {
+		log.Printf("Failed to marshal follow request update: %v", err)
+		return
 	}
+	// If the user is offline, the update is handled when they connect.
+	h.sendToUserAsync(userID, messageBytes)
 }
 
 // SendUserListUpdate sends a message to refresh the user list for a user
 func (h *Hub) SendUserListUpdate(userID string) {
-	// Check if the target user is online
-	if userClients, ok := h.clients[userID]; ok {
-		// Create the user list update message
-		updateMsg := struct {
-			Type string `json:"type"`
-			Data struct {
-				Action string `json:"action"`
-			} `json:"data"`
-			Timestamp time.Time `json:"timestamp"`
-		}{
-			Type: "user_list_update",
-			Data: struct {
-				Action string `json:"action"`
-			}{
-				Action: "refresh",
-			},
-			Timestamp: time.Now(),
-		}
-
-		messageBytes, err := json.Marshal(updateMsg)
-		if err != nil {
-			log.Printf("Failed to marshal user list update: %v", err)
-			return
-		}
-
-		// Send the update to all of that user's active connections
-		for client := range userClients {
-			select {
-			case client.send <- messageBytes:
-			default:
-				close(client.send)
-				delete(userClients, client)
-			}
-		}
-		log.Printf("Sent user list update to user %s", userID)
-	} else {
-		// User is not online, update will be handled when they connect
-		// (removed debug log to reduce noise)
+	messageBytes, err := refreshMessage("user_list_update")
+	if err != nil {
+		log.Printf("Failed to marshal user list update: %v", err)
+		return
 	}
+	// If the user is offline, the update is handled when they connect.
+	h.sendToUserAsync(userID, messageBytes)
 }
 
 // SendMessageToUser sends a message directly to a specific user if they're online
 func (h *Hub) SendMessageToUser(userID string, message *models.Message) {
-	// Check if the target user is online
-	if userClients, ok := h.clients[userID]; ok {
-		// Create the message payload
-		messagePayload := struct {
-			Type string          `json:"type"`
-			Data *models.Message `json:"data"`
-		}{
-			Type: "message",
-			Data: message,
-		}
-
-		// Marshal to JSON
-		jsonData, err := json.Marshal(messagePayload)
-		if err != nil {
-			log.Printf("Error marshaling message to JSON: %v", err)
-			return
-		}
+	// Create the message payload
+	messagePayload := struct {
+		Type string          `json:"type"`
+		Data *models.Message `json:"data"`
+	}{
+		Type: "message",
+		Data: message,
+	}
 
-		// Send to all clients of this user
-		for client := range userClients {
-			select {
-			case client.send <- jsonData:
-			default:
-				close(client.send)
-				delete(userClients, client)
-				if len(userClients) == 0 {
-					delete(h.clients, userID)
-				}
-			}
-		}
+	// Marshal to JSON
+	jsonData, err := json.Marshal(messagePayload)
+	if err != nil {
+		log.Printf("Error marshaling message to JSON: %v", err)
+		return
 	}
+
+	h.sendToUserAsync(userID, jsonData)
 }
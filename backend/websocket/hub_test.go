@@ -0,0 +1,50 @@
+package websocket
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDisconnectDuringDeliveries drops connections while updates are being pushed to
+// them from other goroutines, which used to panic with a send on a closed channel.
+func TestDisconnectDuringDeliveries(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	clients := make([]*Client, 4)
+	for i := range clients {
+		clients[i] = &Client{hub: hub, send: make(chan []byte, 1), UserID: "u1", sessionToken: string(rune('a' + i))}
+		hub.register <- clients[i]
+	}
+	closed := make(chan struct{}, len(clients))
+	for _, c := range clients {
+		go func(c *Client) {
+			for range c.send {
+			}
+			closed <- struct{}{}
+		}(c)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() { defer wg.Done(); hub.SendUserListUpdate("u1") }()
+		go func() { defer wg.Done(); hub.SendFollowRequestUpdate("u1") }()
+	}
+	wg.Add(3)
+	go func() { defer wg.Done(); hub.DisconnectSessions("u1", []string{"a"}) }()
+	go func() { defer wg.Done(); hub.unregister <- clients[1] }()
+	go func() { defer wg.Done(); hub.DisconnectUser("u1") }()
+	wg.Wait()
+	// Unregistering a connection that was already dropped must not close it twice.
+	hub.unregister <- clients[0]
+
+	for range clients {
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Fatal("a connection was not closed")
+		}
+	}
+}
@@ -35,6 +35,7 @@ type NotificationMessage struct {
 		Message   string `json:"message"`
 		ActorID   string `json:"actorId,omitempty"`
 		NotifType string `json:"notifType"`
+		Link      string `json:"link,omitempty"`
 		Read      bool   `json:"read"`
 	} `json:"payload"`
 	Timestamp time.Time `json:"timestamp"`